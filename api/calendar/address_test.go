@@ -0,0 +1,73 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // 執行環境 metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("IsPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalDAVProviderRejectsPrivateServers(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// 主機名稱在連線時才解析，localhost 同樣被擋下
+	for _, serverURL := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		provider, err := NewCalDAVProvider(serverURL, "user", "password", "", false)
+		if err != nil {
+			t.Fatalf("NewCalDAVProvider() error = %v", err)
+		}
+		if _, err := provider.Discover(context.Background()); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Discover(%s) error = %v, want ErrPrivateAddress", serverURL, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("server received %d requests, want 0", requests)
+	}
+
+	// 本地測試開啟 allow_private_networks 時可連線
+	provider, _ := NewCalDAVProvider(server.URL, "user", "password", "", true)
+	_, err := provider.Discover(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Discover() error = %v, want 401 from the server", err)
+	}
+}
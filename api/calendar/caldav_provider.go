@@ -0,0 +1,505 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// maxCalDAVRedirects 跟隨 redirect 的次數上限（/.well-known/caldav 通常會導向實際路徑）
+	maxCalDAVRedirects = 3
+	// maxCalDAVResponse 回應大小上限
+	maxCalDAVResponse = 10 << 20
+)
+
+// ErrNoCalendar CalDAV 帳號沒有可存放事件（VEVENT）的行事曆
+var ErrNoCalendar = errors.New("no calendar supporting events found")
+
+// CalDAVProvider CalDAV（RFC 4791）行事曆，以 basic auth（app password）驗證
+// calendarID 為行事曆集合的 href，primary 為連結帳號時選擇的預設行事曆
+type CalDAVProvider struct {
+	serverURL       *url.URL
+	username        string
+	password        string
+	primaryCalendar string
+	client          *http.Client
+}
+
+// NewCalDAVProvider creates a CalDAV provider, primaryCalendar may be empty before discovery
+// The server is chosen by the user, so unless allowPrivateNetworks is set only public addresses are dialed (SSRF)
+func NewCalDAVProvider(serverURL, username, password, primaryCalendar string, allowPrivateNetworks bool) (*CalDAVProvider, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return nil, fmt.Errorf("invalid CalDAV server url: %s", serverURL)
+	}
+
+	client := newUserServerClient(30*time.Second, allowPrivateNetworks)
+	// PROPFIND、REPORT 遇到 301／302 時 net/http 會改為 GET，改由 do 自行跟隨
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &CalDAVProvider{
+		serverURL:       parsed,
+		username:        username,
+		password:        password,
+		primaryCalendar: primaryCalendar,
+		client:          client,
+	}, nil
+}
+
+func (p *CalDAVProvider) Name() string {
+	return CalDAVProviderName
+}
+
+// davMultistatus WebDAV 207 Multi-Status 回應
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+type davProp struct {
+	CurrentUserPrincipal davHref `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	ResourceType         struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName  string `xml:"DAV: displayname"`
+	ETag         string `xml:"DAV: getetag"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	ComponentSet struct {
+		Components []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+}
+
+// prop 合併 200 的 propstat
+func (r davResponse) prop() davProp {
+	var merged davProp
+	for _, propstat := range r.Propstats {
+		if propstat.Status != "" && !strings.Contains(propstat.Status, " 200 ") {
+			continue
+		}
+		prop := propstat.Prop
+		if prop.CurrentUserPrincipal.Href != "" {
+			merged.CurrentUserPrincipal = prop.CurrentUserPrincipal
+		}
+		if prop.CalendarHomeSet.Href != "" {
+			merged.CalendarHomeSet = prop.CalendarHomeSet
+		}
+		if prop.ResourceType.Calendar != nil {
+			merged.ResourceType = prop.ResourceType
+		}
+		if prop.DisplayName != "" {
+			merged.DisplayName = prop.DisplayName
+		}
+		if prop.ETag != "" {
+			merged.ETag = prop.ETag
+		}
+		if prop.CalendarData != "" {
+			merged.CalendarData = prop.CalendarData
+		}
+		if len(prop.ComponentSet.Components) > 0 {
+			merged.ComponentSet = prop.ComponentSet
+		}
+	}
+	return merged
+}
+
+const (
+	propfindPrincipal = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:current-user-principal/></D:prop></D:propfind>`
+	propfindHomeSet = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><C:calendar-home-set/></D:prop></D:propfind>`
+	propfindCalendars = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:resourcetype/><D:displayname/><C:supported-calendar-component-set/></D:prop></D:propfind>`
+)
+
+// Discover 以 PROPFIND 找出 current-user-principal、calendar-home-set 與其中支援 VEVENT 的行事曆
+// 伺服器網址沒有 principal 時改用 /.well-known/caldav（RFC 6764）
+func (p *CalDAVProvider) Discover(ctx context.Context) ([]model.CalDAVCalendar, error) {
+	principal, err := p.findHref(ctx, p.serverURL.String(), propfindPrincipal, func(prop davProp) string {
+		return prop.CurrentUserPrincipal.Href
+	})
+	if err != nil || principal == "" {
+		wellKnown := p.serverURL.ResolveReference(&url.URL{Path: "/.well-known/caldav"}).String()
+		if principal, err = p.findHref(ctx, wellKnown, propfindPrincipal, func(prop davProp) string {
+			return prop.CurrentUserPrincipal.Href
+		}); err != nil {
+			return nil, err
+		}
+		if principal == "" {
+			return nil, fmt.Errorf("current-user-principal not found")
+		}
+	}
+
+	home, err := p.findHref(ctx, principal, propfindHomeSet, func(prop davProp) string {
+		return prop.CalendarHomeSet.Href
+	})
+	if err != nil {
+		return nil, err
+	}
+	if home == "" {
+		return nil, fmt.Errorf("calendar-home-set not found")
+	}
+
+	multistatus, err := p.multistatus(ctx, "PROPFIND", home, "1", propfindCalendars)
+	if err != nil {
+		return nil, err
+	}
+
+	var calendars []model.CalDAVCalendar
+	for _, response := range multistatus.Responses {
+		prop := response.prop()
+		if prop.ResourceType.Calendar == nil || !supportsEvents(prop) {
+			continue
+		}
+		calendars = append(calendars, model.CalDAVCalendar{
+			Href:        p.resolve(response.Href),
+			DisplayName: prop.DisplayName,
+		})
+	}
+	if len(calendars) == 0 {
+		return nil, ErrNoCalendar
+	}
+	return calendars, nil
+}
+
+// supportsEvents 未宣告 supported-calendar-component-set 時視為支援所有元件
+func supportsEvents(prop davProp) bool {
+	if len(prop.ComponentSet.Components) == 0 {
+		return true
+	}
+	for _, component := range prop.ComponentSet.Components {
+		if strings.EqualFold(component.Name, "VEVENT") {
+			return true
+		}
+	}
+	return false
+}
+
+// findHref PROPFIND Depth 0 並回傳 pick 取出的 href（已轉為絕對網址）
+func (p *CalDAVProvider) findHref(ctx context.Context, target, body string, pick func(davProp) string) (string, error) {
+	multistatus, err := p.multistatus(ctx, "PROPFIND", target, "0", body)
+	if err != nil {
+		return "", err
+	}
+	for _, response := range multistatus.Responses {
+		if href := pick(response.prop()); href != "" {
+			return p.resolve(href), nil
+		}
+	}
+	return "", nil
+}
+
+// ListEvents 以 REPORT calendar-query 查詢時間區間內的 VEVENT
+// SingleEvents 時請伺服器展開週期性事件（expand），同一資源的事件實例使用相同 ID
+func (p *CalDAVProvider) ListEvents(ctx context.Context, _ string, calendarID string, query ListQuery) (*model.CalendarResponse, error) {
+	calendarURL, err := p.calendarURL(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeRange, err := calDAVTimeRange(query)
+	if err != nil {
+		return nil, err
+	}
+	calendarData := "<C:calendar-data/>"
+	if query.SingleEvents {
+		calendarData = "<C:calendar-data><C:expand " + timeRange + "/></C:calendar-data>"
+	}
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/>` + calendarData + `</D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range ` + timeRange + `/></C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+
+	multistatus, err := p.multistatus(ctx, "REPORT", calendarURL, "1", body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.CalendarResponse{
+		Kind:     "caldav#events",
+		TimeZone: "UTC",
+		Items:    []model.CalendarEvent{},
+	}
+	for _, item := range multistatus.Responses {
+		prop := item.prop()
+		if prop.CalendarData == "" {
+			continue
+		}
+		calendar, err := parseICalendar(prop.CalendarData)
+		if err != nil {
+			// 單一事件格式錯誤不影響其他事件
+			continue
+		}
+		for _, vevent := range calendar.components("VEVENT") {
+			response.Items = append(response.Items, vevent.toCalendarEvent(resourceName(item.Href)))
+		}
+	}
+
+	if query.OrderBy == "startTime" {
+		SortEvents(response.Items)
+	}
+	if query.MaxResults > 0 && len(response.Items) > query.MaxResults {
+		response.Items = response.Items[:query.MaxResults]
+	}
+	return response, nil
+}
+
+// CreateEvent 建立 {uuid}.ics，If-None-Match 避免覆寫既有資源
+func (p *CalDAVProvider) CreateEvent(ctx context.Context, _ string, calendarID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	calendarURL, err := p.calendarURL(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 資源名稱一律由此產生，沿用 event.ICalUID 作為 UID
+	resource := uuid.New().String()
+	uid := event.ICalUID
+	if uid == "" {
+		uid = resource
+	}
+	calendar, err := newICalendar(uid, event, utils.GetCurrentTime())
+	if err != nil {
+		return nil, err
+	}
+
+	resource += ".ics"
+	if _, err := p.put(ctx, calendarURL+resource, calendar, map[string]string{"If-None-Match": "*"}); err != nil {
+		return nil, err
+	}
+	created := calendar.Components[0].toCalendarEvent(resource)
+	return &created, nil
+}
+
+func (p *CalDAVProvider) GetEvent(ctx context.Context, _ string, calendarID, eventID string) (*model.CalendarEvent, error) {
+	resourceURL, err := p.resourceURL(calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := p.do(ctx, http.MethodGet, resourceURL, "", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := parseICalendar(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event %s: %w", eventID, err)
+	}
+	master := calendar.masterEvent()
+	if master == nil {
+		return nil, fmt.Errorf("event %s has no VEVENT", eventID)
+	}
+	event := master.toCalendarEvent(eventID)
+	return &event, nil
+}
+
+// UpdateEvent 讀取事件資源後修改主要 VEVENT，以 If-Match 寫回（其他用戶端同時修改時回應 412）
+func (p *CalDAVProvider) UpdateEvent(ctx context.Context, _ string, calendarID, eventID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	resourceURL, err := p.resourceURL(calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, header, err := p.do(ctx, http.MethodGet, resourceURL, "", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := parseICalendar(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event %s: %w", eventID, err)
+	}
+
+	// 週期性事件只修改主要事件
+	master := calendar.masterEvent()
+	if master == nil {
+		return nil, fmt.Errorf("event %s has no VEVENT", eventID)
+	}
+	if err := master.applyEvent(event, utils.GetCurrentTime()); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	if etag := header.Get("ETag"); etag != "" {
+		headers["If-Match"] = etag
+	}
+	if _, err := p.put(ctx, resourceURL, calendar, headers); err != nil {
+		return nil, err
+	}
+	updated := master.toCalendarEvent(eventID)
+	return &updated, nil
+}
+
+func (p *CalDAVProvider) DeleteEvent(ctx context.Context, _ string, calendarID, eventID string) error {
+	resourceURL, err := p.resourceURL(calendarID, eventID)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.do(ctx, http.MethodDelete, resourceURL, "", "", nil, nil)
+	return err
+}
+
+func (p *CalDAVProvider) put(ctx context.Context, resourceURL string, calendar *icalComponent, headers map[string]string) (http.Header, error) {
+	_, header, err := p.do(ctx, http.MethodPut, resourceURL, "", "text/calendar; charset=utf-8", []byte(calendar.String()), headers)
+	return header, err
+}
+
+// calendarURL primary 為預設行事曆，其他 calendarID 必須與伺服器同一個 host
+func (p *CalDAVProvider) calendarURL(calendarID string) (string, error) {
+	if calendarID == "" || calendarID == PrimaryCalendarID {
+		calendarID = p.primaryCalendar
+	}
+	if calendarID == "" {
+		return "", ErrNoCalendar
+	}
+
+	calendarURL, err := url.Parse(p.resolve(calendarID))
+	if err != nil || calendarURL.Host != p.serverURL.Host {
+		return "", fmt.Errorf("calendar %s does not belong to the CalDAV server", calendarID)
+	}
+	if !strings.HasSuffix(calendarURL.Path, "/") {
+		calendarURL.Path += "/"
+	}
+	return calendarURL.String(), nil
+}
+
+func (p *CalDAVProvider) resourceURL(calendarID, eventID string) (string, error) {
+	if eventID == "" || strings.Contains(eventID, "/") || eventID == "." || eventID == ".." {
+		return "", fmt.Errorf("invalid event id: %s", eventID)
+	}
+	calendarURL, err := p.calendarURL(calendarID)
+	if err != nil {
+		return "", err
+	}
+	return calendarURL + url.PathEscape(eventID), nil
+}
+
+// resolve 將 href（通常為絕對路徑）轉為伺服器上的絕對網址
+func (p *CalDAVProvider) resolve(href string) string {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return p.serverURL.ResolveReference(ref).String()
+}
+
+func (p *CalDAVProvider) multistatus(ctx context.Context, method, target, depth, body string) (*davMultistatus, error) {
+	data, _, err := p.do(ctx, method, target, depth, "application/xml; charset=utf-8", []byte(body), nil)
+	if err != nil {
+		return nil, err
+	}
+	var multistatus davMultistatus
+	if err := xml.Unmarshal(data, &multistatus); err != nil {
+		return nil, fmt.Errorf("failed to parse multistatus response: %w", err)
+	}
+	return &multistatus, nil
+}
+
+// do 以 basic auth 發送請求並跟隨 redirect（保留 method 與 body），非 2xx 回應轉換為 APIError
+func (p *CalDAVProvider) do(ctx context.Context, method, target, depth, contentType string, body []byte, headers map[string]string) ([]byte, http.Header, error) {
+	for redirects := 0; ; redirects++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.SetBasicAuth(p.username, p.password)
+		if depth != "" {
+			req.Header.Set("Depth", depth)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to call CalDAV server: %w", err)
+		}
+		data, readErr := io.ReadAll(io.LimitReader(resp.Body, maxCalDAVResponse))
+		utils.CloseResponseBody(resp, "CalDAV")
+		if readErr != nil {
+			return nil, nil, fmt.Errorf("failed to read response body : %w", readErr)
+		}
+
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode <= 399 && resp.Header.Get("Location") != "":
+			if redirects >= maxCalDAVRedirects {
+				return nil, nil, fmt.Errorf("too many redirects from CalDAV server")
+			}
+			location, err := req.URL.Parse(resp.Header.Get("Location"))
+			if err != nil || location.Host != p.serverURL.Host {
+				return nil, nil, fmt.Errorf("CalDAV server redirected to another host")
+			}
+			target = location.String()
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			details := map[string]interface{}{"status": resp.Status}
+			if len(data) > 0 && len(data) <= 1024 {
+				details["body"] = string(data)
+			}
+			return nil, nil, &APIError{StatusCode: resp.StatusCode, Details: details}
+		default:
+			return data, resp.Header, nil
+		}
+	}
+}
+
+// resourceName href 的最後一段（已解碼），作為事件 ID
+func resourceName(href string) string {
+	name := path.Base(strings.TrimSuffix(href, "/"))
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// calDAVTimeRange time-range 的 start、end 屬性（UTC）
+func calDAVTimeRange(query ListQuery) (string, error) {
+	start, err := time.Parse(time.RFC3339, query.TimeMin)
+	if err != nil {
+		return "", fmt.Errorf("invalid timeMin: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, query.TimeMax)
+	if err != nil {
+		return "", fmt.Errorf("invalid timeMax: %w", err)
+	}
+	return fmt.Sprintf(`start="%s" end="%s"`, start.UTC().Format(icalUTCLayout), end.UTC().Format(icalUTCLayout)), nil
+}
+
+// eventStart 排序用的開始時間，全天事件為當天 00:00 UTC
+func eventStart(event model.CalendarEvent) time.Time {
+	if event.Start.DateTime != "" {
+		start, _ := time.Parse(time.RFC3339, event.Start.DateTime)
+		return start
+	}
+	start, _ := time.Parse("2006-01-02", event.Start.Date)
+	return start
+}
@@ -0,0 +1,180 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"glt-calendar-service/api/model"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// googleEventIDPattern Google 只接受 base32hex（a-v、0-9）5 到 1024 字元的自訂事件 ID
+var googleEventIDPattern = regexp.MustCompile(`^[a-v0-9]+$`)
+
+// GoogleProvider Google Calendar API v3
+type GoogleProvider struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewGoogleProvider creates a Google Calendar provider, endpoint defaults to https://www.googleapis.com/calendar/v3
+func NewGoogleProvider(endpoint string) *GoogleProvider {
+	if endpoint == "" {
+		endpoint = "https://www.googleapis.com/calendar/v3"
+	}
+	return &GoogleProvider{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (p *GoogleProvider) Name() string {
+	return GoogleProviderName
+}
+
+func (p *GoogleProvider) ListEvents(ctx context.Context, accessToken, calendarID string, query ListQuery) (*model.CalendarResponse, error) {
+	q := url.Values{}
+	q.Add("timeMin", query.TimeMin)
+	q.Add("timeMax", query.TimeMax)
+	q.Add("maxResults", strconv.Itoa(query.MaxResults))
+	q.Add("singleEvents", strconv.FormatBool(query.SingleEvents))
+	// Google 只允許 singleEvents=true 時以 startTime 排序
+	if query.OrderBy != "" {
+		q.Add("orderBy", query.OrderBy)
+	}
+
+	var calendarData model.CalendarResponse
+	if err := doJSON(ctx, p.client, http.MethodGet, p.eventsURL(calendarID)+"?"+q.Encode(), accessToken, nil, nil, &calendarData); err != nil {
+		return nil, err
+	}
+	return &calendarData, nil
+}
+
+func (p *GoogleProvider) GetEvent(ctx context.Context, accessToken, calendarID, eventID string) (*model.CalendarEvent, error) {
+	if eventID == "" {
+		return nil, fmt.Errorf("event id is required")
+	}
+
+	var event model.CalendarEvent
+	eventURL := p.eventsURL(calendarID) + "/" + url.PathEscape(eventID)
+	if err := doJSON(ctx, p.client, http.MethodGet, eventURL, accessToken, nil, nil, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (p *GoogleProvider) CreateEvent(ctx context.Context, accessToken, calendarID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	body := googleEventBody(event)
+	// ID 與 iCalUID 只能在建立時指定，不符合格式的 ID 由 Google 產生
+	if len(event.ID) >= 5 && len(event.ID) <= 1024 && googleEventIDPattern.MatchString(event.ID) {
+		body["id"] = event.ID
+	}
+	if event.ICalUID != "" {
+		body["iCalUID"] = event.ICalUID
+	}
+
+	var created model.CalendarEvent
+	if err := doJSON(ctx, p.client, http.MethodPost, p.eventsURL(calendarID), accessToken, nil, body, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (p *GoogleProvider) UpdateEvent(ctx context.Context, accessToken, calendarID, eventID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	if eventID == "" {
+		return nil, fmt.Errorf("event id is required")
+	}
+
+	var updated model.CalendarEvent
+	eventURL := p.eventsURL(calendarID) + "/" + url.PathEscape(eventID)
+	if err := doJSON(ctx, p.client, http.MethodPatch, eventURL, accessToken, nil, googleEventBody(event), &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (p *GoogleProvider) DeleteEvent(ctx context.Context, accessToken, calendarID, eventID string) error {
+	if eventID == "" {
+		return fmt.Errorf("event id is required")
+	}
+	eventURL := p.eventsURL(calendarID) + "/" + url.PathEscape(eventID)
+	return doJSON(ctx, p.client, http.MethodDelete, eventURL, accessToken, nil, nil, nil)
+}
+
+// ListCalendars 列出 calendarList（需要 calendar 或 calendar.readonly scope）
+func (p *GoogleProvider) ListCalendars(ctx context.Context, accessToken string) ([]model.CalendarInfo, error) {
+	var calendars []model.CalendarInfo
+	pageToken := ""
+	for {
+		q := url.Values{}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+
+		var page struct {
+			Items []struct {
+				ID         string `json:"id"`
+				Summary    string `json:"summary"`
+				Primary    bool   `json:"primary"`
+				AccessRole string `json:"accessRole"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := doJSON(ctx, p.client, http.MethodGet, p.endpoint+"/users/me/calendarList?"+q.Encode(), accessToken, nil, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			calendars = append(calendars, model.CalendarInfo{
+				ID:       item.ID,
+				Summary:  item.Summary,
+				Primary:  item.Primary,
+				ReadOnly: item.AccessRole != "owner" && item.AccessRole != "writer",
+			})
+		}
+
+		if page.NextPageToken == "" {
+			return calendars, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (p *GoogleProvider) eventsURL(calendarID string) string {
+	if calendarID == "" {
+		calendarID = PrimaryCalendarID
+	}
+	return fmt.Sprintf("%s/calendars/%s/events", p.endpoint, url.PathEscape(calendarID))
+}
+
+// googleEventBody 只送出可寫入的欄位，空值不送出（PATCH 時保留原值）
+func googleEventBody(event model.CalendarEvent) map[string]interface{} {
+	body := map[string]interface{}{}
+	if event.Summary != "" {
+		body["summary"] = event.Summary
+	}
+	if event.Description != "" {
+		body["description"] = event.Description
+	}
+	if event.Location != "" {
+		body["location"] = event.Location
+	}
+	if event.ColorId != "" {
+		body["colorId"] = event.ColorId
+	}
+	if event.Status != "" {
+		body["status"] = event.Status
+	}
+	if event.Start != (model.EventTime{}) {
+		body["start"] = event.Start
+	}
+	if event.End != (model.EventTime{}) {
+		body["end"] = event.End
+	}
+	return body
+}
@@ -0,0 +1,334 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"glt-calendar-service/api/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphDateTimeLayout Microsoft Graph dateTimeTimeZone 的時間格式（不含時區，時區另外指定）
+const graphDateTimeLayout = "2006-01-02T15:04:05"
+
+// graphPreferUTC 要求 Graph 以 UTC 回傳事件時間
+var graphPreferUTC = map[string]string{"Prefer": `outlook.timezone="UTC"`}
+
+// GraphProvider Microsoft 365 / Outlook 行事曆（Microsoft Graph）
+type GraphProvider struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewGraphProvider creates a Microsoft Graph provider, endpoint defaults to https://graph.microsoft.com/v1.0
+func NewGraphProvider(endpoint string) *GraphProvider {
+	if endpoint == "" {
+		endpoint = "https://graph.microsoft.com/v1.0"
+	}
+	return &GraphProvider{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (p *GraphProvider) Name() string {
+	return MicrosoftProviderName
+}
+
+// graphDateTime Graph dateTimeTimeZone
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphEmailAddress struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+type graphRecipient struct {
+	EmailAddress graphEmailAddress `json:"emailAddress"`
+}
+
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphLocation struct {
+	DisplayName string `json:"displayName"`
+}
+
+type graphEvent struct {
+	ID          string          `json:"id,omitempty"`
+	Subject     string          `json:"subject,omitempty"`
+	BodyPreview string          `json:"bodyPreview,omitempty"`
+	Body        *graphItemBody  `json:"body,omitempty"`
+	Start       *graphDateTime  `json:"start,omitempty"`
+	End         *graphDateTime  `json:"end,omitempty"`
+	Location    *graphLocation  `json:"location,omitempty"`
+	IsAllDay    *bool           `json:"isAllDay,omitempty"`
+	IsCancelled bool            `json:"isCancelled,omitempty"`
+	Organizer   *graphRecipient `json:"organizer,omitempty"`
+	// 以下為唯讀欄位
+	ICalUID      string `json:"iCalUId,omitempty"`
+	LastModified string `json:"lastModifiedDateTime,omitempty"`
+}
+
+type graphEventList struct {
+	Value    []graphEvent `json:"value"`
+	NextLink string       `json:"@odata.nextLink"`
+}
+
+type graphCalendar struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	CanEdit           bool   `json:"canEdit"`
+	IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+}
+
+type graphCalendarList struct {
+	Value    []graphCalendar `json:"value"`
+	NextLink string          `json:"@odata.nextLink"`
+}
+
+// ListEvents 以 calendarView 列出區間內的事件（週期性事件一律展開），依 nextLink 讀取至 MaxResults 筆
+func (p *GraphProvider) ListEvents(ctx context.Context, accessToken, calendarID string, query ListQuery) (*model.CalendarResponse, error) {
+	q := url.Values{}
+	q.Set("startDateTime", query.TimeMin)
+	q.Set("endDateTime", query.TimeMax)
+	if query.MaxResults > 0 {
+		q.Set("$top", strconv.Itoa(query.MaxResults))
+	}
+	switch query.OrderBy {
+	case "startTime":
+		q.Set("$orderby", "start/dateTime")
+	case "updated":
+		q.Set("$orderby", "lastModifiedDateTime")
+	}
+
+	response := &model.CalendarResponse{
+		Kind:     "microsoft#events",
+		TimeZone: "UTC",
+		Items:    []model.CalendarEvent{},
+	}
+
+	var calendar graphCalendar
+	if err := doJSON(ctx, p.client, http.MethodGet, p.calendarURL(calendarID), accessToken, nil, nil, &calendar); err != nil {
+		return nil, err
+	}
+	response.Summary = calendar.Name
+
+	nextURL := p.calendarURL(calendarID) + "/calendarView?" + q.Encode()
+	for nextURL != "" {
+		var page graphEventList
+		if err := doJSON(ctx, p.client, http.MethodGet, nextURL, accessToken, graphPreferUTC, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, event := range page.Value {
+			response.Items = append(response.Items, event.toCalendarEvent())
+			if query.MaxResults > 0 && len(response.Items) >= query.MaxResults {
+				return response, nil
+			}
+		}
+		nextURL = page.NextLink
+	}
+	return response, nil
+}
+
+func (p *GraphProvider) GetEvent(ctx context.Context, accessToken, calendarID, eventID string) (*model.CalendarEvent, error) {
+	if eventID == "" {
+		return nil, fmt.Errorf("event id is required")
+	}
+
+	var event graphEvent
+	eventURL := p.calendarURL(calendarID) + "/events/" + url.PathEscape(eventID)
+	if err := doJSON(ctx, p.client, http.MethodGet, eventURL, accessToken, graphPreferUTC, nil, &event); err != nil {
+		return nil, err
+	}
+	result := event.toCalendarEvent()
+	return &result, nil
+}
+
+// CreateEvent Graph 的事件 ID 與 iCalUId 皆由伺服器產生
+func (p *GraphProvider) CreateEvent(ctx context.Context, accessToken, calendarID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	body, err := newGraphEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var created graphEvent
+	if err := doJSON(ctx, p.client, http.MethodPost, p.calendarURL(calendarID)+"/events", accessToken, graphPreferUTC, body, &created); err != nil {
+		return nil, err
+	}
+	result := created.toCalendarEvent()
+	return &result, nil
+}
+
+func (p *GraphProvider) UpdateEvent(ctx context.Context, accessToken, calendarID, eventID string, event model.CalendarEvent) (*model.CalendarEvent, error) {
+	if eventID == "" {
+		return nil, fmt.Errorf("event id is required")
+	}
+	body, err := newGraphEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated graphEvent
+	eventURL := p.calendarURL(calendarID) + "/events/" + url.PathEscape(eventID)
+	if err := doJSON(ctx, p.client, http.MethodPatch, eventURL, accessToken, graphPreferUTC, body, &updated); err != nil {
+		return nil, err
+	}
+	result := updated.toCalendarEvent()
+	return &result, nil
+}
+
+func (p *GraphProvider) DeleteEvent(ctx context.Context, accessToken, calendarID, eventID string) error {
+	if eventID == "" {
+		return fmt.Errorf("event id is required")
+	}
+	eventURL := p.calendarURL(calendarID) + "/events/" + url.PathEscape(eventID)
+	return doJSON(ctx, p.client, http.MethodDelete, eventURL, accessToken, nil, nil, nil)
+}
+
+// ListCalendars 列出 /me/calendars，預設行事曆的 ID 回傳為 primary
+func (p *GraphProvider) ListCalendars(ctx context.Context, accessToken string) ([]model.CalendarInfo, error) {
+	var calendars []model.CalendarInfo
+	nextURL := p.endpoint + "/me/calendars"
+	for nextURL != "" {
+		var page graphCalendarList
+		if err := doJSON(ctx, p.client, http.MethodGet, nextURL, accessToken, nil, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Value {
+			info := model.CalendarInfo{ID: item.ID, Summary: item.Name, Primary: item.IsDefaultCalendar, ReadOnly: !item.CanEdit}
+			if item.IsDefaultCalendar {
+				info.ID = PrimaryCalendarID
+			}
+			calendars = append(calendars, info)
+		}
+		nextURL = page.NextLink
+	}
+	return calendars, nil
+}
+
+// calendarURL primary 對應 /me/calendar，其他為 /me/calendars/{id}
+func (p *GraphProvider) calendarURL(calendarID string) string {
+	if calendarID == "" || calendarID == PrimaryCalendarID {
+		return p.endpoint + "/me/calendar"
+	}
+	return p.endpoint + "/me/calendars/" + url.PathEscape(calendarID)
+}
+
+// toCalendarEvent 轉換為 Google 格式的事件，時間為 UTC（graphPreferUTC）
+func (e graphEvent) toCalendarEvent() model.CalendarEvent {
+	allDay := e.IsAllDay != nil && *e.IsAllDay
+	event := model.CalendarEvent{
+		ID:          e.ID,
+		Summary:     e.Subject,
+		Description: e.BodyPreview,
+		Start:       fromGraphDateTime(e.Start, allDay),
+		End:         fromGraphDateTime(e.End, allDay),
+		Status:      "confirmed",
+		ICalUID:     e.ICalUID,
+		Updated:     e.LastModified,
+	}
+	if e.Body != nil && strings.EqualFold(e.Body.ContentType, "text") {
+		event.Description = e.Body.Content
+	}
+	if e.Location != nil {
+		event.Location = e.Location.DisplayName
+	}
+	if e.IsCancelled {
+		event.Status = "cancelled"
+	}
+	// Graph 沒有建立者欄位，以主辦人代替
+	if e.Organizer != nil {
+		event.Organizer = model.Person{Email: e.Organizer.EmailAddress.Address, DisplayName: e.Organizer.EmailAddress.Name}
+		event.Creator = event.Organizer
+	}
+	return event
+}
+
+func fromGraphDateTime(value *graphDateTime, allDay bool) model.EventTime {
+	if value == nil || value.DateTime == "" {
+		return model.EventTime{}
+	}
+
+	// Graph 回傳 7 位小數秒，例如 2024-01-01T10:00:00.0000000
+	dateTime, _, _ := strings.Cut(value.DateTime, ".")
+	if allDay {
+		date, _, _ := strings.Cut(dateTime, "T")
+		return model.EventTime{Date: date}
+	}
+
+	location := time.UTC
+	if value.TimeZone != "" && !strings.EqualFold(value.TimeZone, "UTC") {
+		if loaded, err := time.LoadLocation(value.TimeZone); err == nil {
+			location = loaded
+		}
+	}
+	parsed, err := time.ParseInLocation(graphDateTimeLayout, dateTime, location)
+	if err != nil {
+		return model.EventTime{DateTime: value.DateTime, TimeZone: value.TimeZone}
+	}
+	return model.EventTime{DateTime: parsed.Format(time.RFC3339)}
+}
+
+// newGraphEvent 轉換為 Graph 事件，只包含有值的欄位（PATCH 時保留原值）
+// 有時間的事件轉為 UTC；全天事件使用 start.timeZone（預設 UTC）
+func newGraphEvent(event model.CalendarEvent) (*graphEvent, error) {
+	body := &graphEvent{Subject: event.Summary}
+	if event.Description != "" {
+		body.Body = &graphItemBody{ContentType: "text", Content: event.Description}
+	}
+	if event.Location != "" {
+		body.Location = &graphLocation{DisplayName: event.Location}
+	}
+
+	start, startAllDay, err := toGraphDateTime(event.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	end, endAllDay, err := toGraphDateTime(event.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end: %w", err)
+	}
+	if start != nil && end != nil && startAllDay != endAllDay {
+		return nil, fmt.Errorf("start and end must both be dates or both be date times")
+	}
+	body.Start = start
+	body.End = end
+	if start != nil {
+		body.IsAllDay = &startAllDay
+	}
+	return body, nil
+}
+
+func toGraphDateTime(value model.EventTime) (*graphDateTime, bool, error) {
+	if value.Date != "" {
+		date, err := time.Parse("2006-01-02", value.Date)
+		if err != nil {
+			return nil, false, err
+		}
+		timeZone := value.TimeZone
+		if timeZone == "" {
+			timeZone = "UTC"
+		}
+		return &graphDateTime{DateTime: date.Format(graphDateTimeLayout), TimeZone: timeZone}, true, nil
+	}
+	if value.DateTime == "" {
+		return nil, false, nil
+	}
+
+	dateTime, err := time.Parse(time.RFC3339, value.DateTime)
+	if err != nil {
+		return nil, false, err
+	}
+	return &graphDateTime{DateTime: dateTime.UTC().Format(graphDateTimeLayout), TimeZone: "UTC"}, false, nil
+}
@@ -0,0 +1,211 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"glt-calendar-service/api/model"
+)
+
+// graphStandIn Microsoft Graph 替代服務，記錄收到的請求
+type graphStandIn struct {
+	t        *testing.T
+	server   *httptest.Server
+	requests []*http.Request
+	bodies   []map[string]interface{}
+}
+
+func newGraphStandIn(t *testing.T) *graphStandIn {
+	s := &graphStandIn{t: t}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *graphStandIn) serve(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r)
+	var body map[string]interface{}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			s.t.Errorf("invalid request body: %v", err)
+		}
+	}
+	s.bodies = append(s.bodies, body)
+
+	if r.Header.Get("Authorization") != "Bearer graph-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error":{"code":"InvalidAuthenticationToken"}}`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1.0/me/calendar":
+		_, _ = io.WriteString(w, `{"id":"AAMk-default","name":"Calendar","canEdit":true,"isDefaultCalendar":true}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1.0/me/calendar/calendarView":
+		_, _ = io.WriteString(w, `{
+			"value": [
+				{"id":"timed","subject":"Standup","bodyPreview":"daily","start":{"dateTime":"2026-10-20T01:30:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2026-10-20T01:45:00.0000000","timeZone":"UTC"},"isAllDay":false,"iCalUId":"040000008200E0","lastModifiedDateTime":"2026-10-18T08:00:00Z","organizer":{"emailAddress":{"name":"Alice","address":"alice@contoso.com"}}},
+				{"id":"allday","subject":"Holiday","start":{"dateTime":"2026-10-21T00:00:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2026-10-22T00:00:00.0000000","timeZone":"UTC"},"isAllDay":true}
+			],
+			"@odata.nextLink": "`+s.server.URL+`/v1.0/me/calendar/calendarView?page=2"
+		}`)
+		if r.URL.Query().Get("page") == "2" {
+			return
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/v1.0/me/calendars/work/calendarView":
+		_, _ = io.WriteString(w, `{"value":[]}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1.0/me/calendars/work":
+		_, _ = io.WriteString(w, `{"id":"work","name":"Work"}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1.0/me/calendar/events":
+		_, _ = io.WriteString(w, `{"id":"created","subject":"Review","body":{"contentType":"text","content":"notes"},"location":{"displayName":"Room 1"},"start":{"dateTime":"2026-10-20T02:00:00.0000000","timeZone":"UTC"},"end":{"dateTime":"2026-10-20T03:00:00.0000000","timeZone":"UTC"},"isAllDay":false}`)
+	case r.Method == http.MethodPatch && r.URL.Path == "/v1.0/me/calendars/work/events/evt 1":
+		_, _ = io.WriteString(w, `{"id":"evt 1","subject":"Renamed","isCancelled":true,"start":{"dateTime":"2026-10-20T09:00:00.0000000","timeZone":"Asia/Taipei"},"end":{"dateTime":"2026-10-20T10:00:00.0000000","timeZone":"Asia/Taipei"}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":{"code":"ErrorItemNotFound"}}`)
+	}
+}
+
+func TestGraphProviderListEvents(t *testing.T) {
+	graph := newGraphStandIn(t)
+	provider := NewGraphProvider(graph.server.URL + "/v1.0/")
+
+	query := ListQuery{TimeMin: "2026-10-19T00:00:00Z", TimeMax: "2026-11-19T00:00:00Z", MaxResults: 3, OrderBy: "startTime"}
+	response, err := provider.ListEvents(context.Background(), "graph-token", PrimaryCalendarID, query)
+	if err != nil {
+		t.Fatalf("ListEvents() error = %v", err)
+	}
+
+	// 第一頁 2 筆，依 nextLink 讀取第二頁後在 MaxResults 停止
+	if len(response.Items) != 3 {
+		t.Fatalf("items = %d, want 3 (paged up to maxResults)", len(response.Items))
+	}
+	if response.Summary != "Calendar" || response.TimeZone != "UTC" {
+		t.Errorf("summary = %q timeZone = %q", response.Summary, response.TimeZone)
+	}
+
+	timed := response.Items[0]
+	want := model.CalendarEvent{
+		ID:          "timed",
+		Summary:     "Standup",
+		Description: "daily",
+		Start:       model.EventTime{DateTime: "2026-10-20T01:30:00Z"},
+		End:         model.EventTime{DateTime: "2026-10-20T01:45:00Z"},
+		Status:      "confirmed",
+		Organizer:   model.Person{Email: "alice@contoso.com", DisplayName: "Alice"},
+		Creator:     model.Person{Email: "alice@contoso.com", DisplayName: "Alice"},
+		ICalUID:     "040000008200E0",
+		Updated:     "2026-10-18T08:00:00Z",
+	}
+	if timed != want {
+		t.Errorf("timed event = %+v\nwant %+v", timed, want)
+	}
+
+	allDay := response.Items[1]
+	if allDay.Start != (model.EventTime{Date: "2026-10-21"}) || allDay.End != (model.EventTime{Date: "2026-10-22"}) {
+		t.Errorf("all-day event start = %+v end = %+v, want dates", allDay.Start, allDay.End)
+	}
+
+	view := graph.requests[1]
+	if view.Header.Get("Prefer") != `outlook.timezone="UTC"` {
+		t.Errorf("Prefer = %q", view.Header.Get("Prefer"))
+	}
+	q := view.URL.Query()
+	if q.Get("startDateTime") != query.TimeMin || q.Get("endDateTime") != query.TimeMax || q.Get("$top") != "3" || q.Get("$orderby") != "start/dateTime" {
+		t.Errorf("calendarView query = %v", q)
+	}
+	if graph.requests[2].URL.Query().Get("page") != "2" {
+		t.Errorf("second page request = %s, want nextLink", graph.requests[2].URL)
+	}
+}
+
+func TestGraphProviderCreateEvent(t *testing.T) {
+	graph := newGraphStandIn(t)
+	provider := NewGraphProvider(graph.server.URL + "/v1.0")
+
+	created, err := provider.CreateEvent(context.Background(), "graph-token", PrimaryCalendarID, model.CalendarEvent{
+		Summary:     "Review",
+		Description: "notes",
+		Location:    "Room 1",
+		Start:       model.EventTime{DateTime: "2026-10-20T10:00:00+08:00"},
+		End:         model.EventTime{DateTime: "2026-10-20T11:00:00+08:00"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent() error = %v", err)
+	}
+
+	// 有時間的事件以 UTC 送出
+	body := graph.bodies[0]
+	start := body["start"].(map[string]interface{})
+	if start["dateTime"] != "2026-10-20T02:00:00" || start["timeZone"] != "UTC" || body["isAllDay"] != false {
+		t.Errorf("request body = %v", body)
+	}
+	if body["body"].(map[string]interface{})["content"] != "notes" || body["location"].(map[string]interface{})["displayName"] != "Room 1" {
+		t.Errorf("request body = %v", body)
+	}
+
+	if created.ID != "created" || created.Description != "notes" || created.Location != "Room 1" || created.Start.DateTime != "2026-10-20T02:00:00Z" {
+		t.Errorf("created = %+v", created)
+	}
+
+	// 全天事件以日期與 start.timeZone 送出
+	_, err = provider.CreateEvent(context.Background(), "graph-token", PrimaryCalendarID, model.CalendarEvent{
+		Summary: "Holiday",
+		Start:   model.EventTime{Date: "2026-10-21", TimeZone: "Asia/Taipei"},
+		End:     model.EventTime{Date: "2026-10-22"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent(all-day) error = %v", err)
+	}
+	body = graph.bodies[1]
+	start = body["start"].(map[string]interface{})
+	if start["dateTime"] != "2026-10-21T00:00:00" || start["timeZone"] != "Asia/Taipei" || body["isAllDay"] != true {
+		t.Errorf("all-day request body = %v", body)
+	}
+
+	// 全天與有時間混用時不送出請求
+	_, err = provider.CreateEvent(context.Background(), "graph-token", PrimaryCalendarID, model.CalendarEvent{
+		Summary: "Mixed",
+		Start:   model.EventTime{Date: "2026-10-21"},
+		End:     model.EventTime{DateTime: "2026-10-21T10:00:00Z"},
+	})
+	if err == nil || len(graph.requests) != 2 {
+		t.Errorf("mixed event error = %v, requests = %d", err, len(graph.requests))
+	}
+}
+
+func TestGraphProviderUpdateEvent(t *testing.T) {
+	graph := newGraphStandIn(t)
+	provider := NewGraphProvider(graph.server.URL + "/v1.0")
+
+	updated, err := provider.UpdateEvent(context.Background(), "graph-token", "work", "evt 1", model.CalendarEvent{Summary: "Renamed"})
+	if err != nil {
+		t.Fatalf("UpdateEvent() error = %v", err)
+	}
+
+	// PATCH 只包含有值的欄位
+	if body := graph.bodies[0]; len(body) != 1 || body["subject"] != "Renamed" {
+		t.Errorf("request body = %v, want only subject", body)
+	}
+	if graph.requests[0].Method != http.MethodPatch || !strings.HasSuffix(graph.requests[0].URL.EscapedPath(), "/me/calendars/work/events/evt%201") {
+		t.Errorf("request = %s %s", graph.requests[0].Method, graph.requests[0].URL.EscapedPath())
+	}
+
+	// 未套用 Prefer 的時區轉為 RFC3339 offset
+	if updated.Status != "cancelled" || updated.Start.DateTime != "2026-10-20T09:00:00+08:00" || updated.End.DateTime != "2026-10-20T10:00:00+08:00" {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	_, err = provider.UpdateEvent(context.Background(), "graph-token", "work", "missing", model.CalendarEvent{Summary: "x"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("UpdateEvent(missing) error = %v, want 404 APIError", err)
+	}
+}
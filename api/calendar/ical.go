@@ -0,0 +1,515 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"glt-calendar-service/api/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	icalDateLayout     = "20060102"
+	icalDateTimeLayout = "20060102T150405"
+	icalUTCLayout      = "20060102T150405Z"
+	// icalLineLimit RFC 5545 3.1 每行最多 75 octets，超過時折行
+	icalLineLimit = 75
+)
+
+// icalProperty iCalendar 屬性，Params 與 Value 保留原始字串以便原樣寫回
+type icalProperty struct {
+	Name   string
+	Params string // 例如 ;TZID=Asia/Taipei;VALUE=DATE-TIME
+	Value  string
+}
+
+// icalComponent VCALENDAR、VEVENT 等元件
+type icalComponent struct {
+	Name       string
+	Properties []*icalProperty
+	Components []*icalComponent
+}
+
+// parseICalendar 解析 iCalendar 文字，回傳最外層元件（VCALENDAR）
+func parseICalendar(data string) (*icalComponent, error) {
+	var root *icalComponent
+	var stack []*icalComponent
+
+	for _, line := range unfoldICalLines(data) {
+		if line == "" {
+			continue
+		}
+		prop, err := parseICalLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			component := &icalComponent{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, component)
+			} else if root == nil {
+				root = component
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("unexpected END:%s", prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("property %s outside of a component", prop.Name)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("invalid iCalendar data")
+	}
+	return root, nil
+}
+
+// unfoldICalLines 合併以空白或 tab 開頭的折行（RFC 5545 3.1）
+func unfoldICalLines(data string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICalLine 拆解 name;params:value，參數值可能以雙引號包含冒號
+func parseICalLine(line string) (*icalProperty, error) {
+	inQuotes := false
+	nameEnd := -1
+	for i, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case (r == ';' || r == ':') && nameEnd < 0:
+			nameEnd = i
+			if r == ':' {
+				return &icalProperty{Name: strings.ToUpper(line[:i]), Value: line[i+1:]}, nil
+			}
+		case r == ':' && !inQuotes:
+			return &icalProperty{Name: strings.ToUpper(line[:nameEnd]), Params: line[nameEnd:i], Value: line[i+1:]}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid iCalendar line: %s", line)
+}
+
+// param 取得參數值（不分大小寫），不存在時回傳空字串
+func (p *icalProperty) param(name string) string {
+	for _, part := range splitICalParams(p.Params) {
+		key, value, ok := strings.Cut(part, "=")
+		if ok && strings.EqualFold(key, name) {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+func splitICalParams(params string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range params {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ';' && !inQuotes:
+			if i > start {
+				parts = append(parts, params[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(params) {
+		parts = append(parts, params[start:])
+	}
+	return parts
+}
+
+func (c *icalComponent) property(name string) *icalProperty {
+	for _, prop := range c.Properties {
+		if prop.Name == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+func (c *icalComponent) text(name string) string {
+	if prop := c.property(name); prop != nil {
+		return unescapeICalText(prop.Value)
+	}
+	return ""
+}
+
+// set 取代第一個同名屬性並移除其他同名屬性，不存在時新增
+func (c *icalComponent) set(name, params, value string) {
+	c.remove(name)
+	c.Properties = append(c.Properties, &icalProperty{Name: name, Params: params, Value: value})
+}
+
+func (c *icalComponent) remove(name string) {
+	properties := c.Properties[:0]
+	for _, prop := range c.Properties {
+		if prop.Name != name {
+			properties = append(properties, prop)
+		}
+	}
+	c.Properties = properties
+}
+
+// components 回傳指定名稱的子元件
+func (c *icalComponent) components(name string) []*icalComponent {
+	var result []*icalComponent
+	for _, component := range c.Components {
+		if component.Name == name {
+			result = append(result, component)
+		}
+	}
+	return result
+}
+
+// masterEvent 第一個沒有 RECURRENCE-ID 的 VEVENT（週期性事件的主要事件）
+func (c *icalComponent) masterEvent() *icalComponent {
+	for _, vevent := range c.components("VEVENT") {
+		if vevent.property("RECURRENCE-ID") == nil {
+			return vevent
+		}
+	}
+	return nil
+}
+
+// String 以 CRLF 與折行輸出
+func (c *icalComponent) String() string {
+	var b strings.Builder
+	c.write(&b)
+	return b.String()
+}
+
+func (c *icalComponent) write(b *strings.Builder) {
+	writeICalLine(b, "BEGIN:"+c.Name)
+	for _, prop := range c.Properties {
+		writeICalLine(b, prop.Name+prop.Params+":"+prop.Value)
+	}
+	for _, component := range c.Components {
+		component.write(b)
+	}
+	writeICalLine(b, "END:"+c.Name)
+}
+
+// writeICalLine 超過 75 octets 時折行，不切開 UTF-8 字元
+func writeICalLine(b *strings.Builder, line string) {
+	limit := icalLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// 後續行開頭的空白佔 1 octet
+		limit = icalLineLimit - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isUTF8Start(c byte) bool {
+	return c&0xC0 != 0x80
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeICalText(value string) string {
+	return icalTextEscaper.Replace(value)
+}
+
+func unescapeICalText(value string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range value {
+		if escaped {
+			switch r {
+			case 'n', 'N':
+				b.WriteRune('\n')
+			default:
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// toCalendarEvent 轉換 VEVENT，id 為事件資源名稱
+func (c *icalComponent) toCalendarEvent(id string) model.CalendarEvent {
+	event := model.CalendarEvent{
+		ID:          id,
+		Summary:     c.text("SUMMARY"),
+		Description: c.text("DESCRIPTION"),
+		Location:    c.text("LOCATION"),
+		Start:       icalEventTime(c.property("DTSTART")),
+		Status:      "confirmed",
+		ICalUID:     c.text("UID"),
+	}
+	if modified := icalEventTime(c.property("LAST-MODIFIED")); modified.DateTime != "" {
+		event.Updated = modified.DateTime
+	}
+
+	if end := c.property("DTEND"); end != nil {
+		event.End = icalEventTime(end)
+	} else {
+		event.End = icalEndFromDuration(event.Start, c.property("DURATION"))
+	}
+
+	switch strings.ToUpper(c.text("STATUS")) {
+	case "CANCELLED":
+		event.Status = "cancelled"
+	case "TENTATIVE":
+		event.Status = "tentative"
+	}
+
+	if organizer := c.property("ORGANIZER"); organizer != nil {
+		email := organizer.Value
+		if len(email) > 7 && strings.EqualFold(email[:7], "mailto:") {
+			email = email[7:]
+		}
+		event.Organizer = model.Person{Email: email, DisplayName: organizer.param("CN")}
+		event.Creator = event.Organizer
+	}
+	return event
+}
+
+// icalEventTime DATE 轉為 Date；UTC 與 TZID 時間轉為 RFC3339；floating time 視為 UTC
+func icalEventTime(prop *icalProperty) model.EventTime {
+	if prop == nil || prop.Value == "" {
+		return model.EventTime{}
+	}
+
+	value := prop.Value
+	if strings.EqualFold(prop.param("VALUE"), "DATE") || len(value) == len(icalDateLayout) {
+		date, err := time.Parse(icalDateLayout, value)
+		if err != nil {
+			return model.EventTime{Date: value}
+		}
+		return model.EventTime{Date: date.Format("2006-01-02")}
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		if parsed, err := time.Parse(icalUTCLayout, value); err == nil {
+			return model.EventTime{DateTime: parsed.Format(time.RFC3339)}
+		}
+		return model.EventTime{DateTime: value}
+	}
+
+	location := time.UTC
+	timeZone := ""
+	if tzid := prop.param("TZID"); tzid != "" {
+		if loaded, err := time.LoadLocation(tzid); err == nil {
+			location = loaded
+			timeZone = tzid
+		}
+	}
+	parsed, err := time.ParseInLocation(icalDateTimeLayout, value, location)
+	if err != nil {
+		return model.EventTime{DateTime: value}
+	}
+	return model.EventTime{DateTime: parsed.Format(time.RFC3339), TimeZone: timeZone}
+}
+
+var icalDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// icalEndFromDuration 沒有 DTEND 時以 DURATION 計算結束時間，都沒有時與開始時間相同
+func icalEndFromDuration(start model.EventTime, prop *icalProperty) model.EventTime {
+	if prop == nil {
+		return start
+	}
+	matches := icalDurationPattern.FindStringSubmatch(prop.Value)
+	if matches == nil || matches[1] == "-" {
+		return start
+	}
+
+	number := func(i int) int {
+		n, _ := strconv.Atoi(matches[i])
+		return n
+	}
+	days := number(2)*7 + number(3)
+	clock := time.Duration(number(4))*time.Hour + time.Duration(number(5))*time.Minute + time.Duration(number(6))*time.Second
+
+	if start.Date != "" {
+		date, err := time.Parse("2006-01-02", start.Date)
+		if err != nil {
+			return start
+		}
+		return model.EventTime{Date: date.AddDate(0, 0, days).Format("2006-01-02")}
+	}
+	begin, err := time.Parse(time.RFC3339, start.DateTime)
+	if err != nil {
+		return start
+	}
+	return model.EventTime{DateTime: begin.AddDate(0, 0, days).Add(clock).Format(time.RFC3339), TimeZone: start.TimeZone}
+}
+
+// setEventTime 將 EventTime 寫入 DTSTART／DTEND，時間一律轉為 UTC
+func (c *icalComponent) setEventTime(name string, value model.EventTime) error {
+	if value.Date != "" {
+		date, err := time.Parse("2006-01-02", value.Date)
+		if err != nil {
+			return err
+		}
+		c.set(name, ";VALUE=DATE", date.Format(icalDateLayout))
+		return nil
+	}
+
+	dateTime, err := time.Parse(time.RFC3339, value.DateTime)
+	if err != nil {
+		return err
+	}
+	c.set(name, "", dateTime.UTC().Format(icalUTCLayout))
+	return nil
+}
+
+// applyEvent 將 event 中有值的欄位寫入 VEVENT，並更新 DTSTAMP 與 SEQUENCE
+func (c *icalComponent) applyEvent(event model.CalendarEvent, now time.Time) error {
+	if err := c.setEventFields(event); err != nil {
+		return err
+	}
+
+	sequence := 0
+	if prop := c.property("SEQUENCE"); prop != nil {
+		sequence, _ = strconv.Atoi(prop.Value)
+		sequence++
+	}
+	c.set("SEQUENCE", "", strconv.Itoa(sequence))
+	c.set("DTSTAMP", "", now.UTC().Format(icalUTCLayout))
+	c.set("LAST-MODIFIED", "", now.UTC().Format(icalUTCLayout))
+	return nil
+}
+
+// setEventFields 將 event 中有值的欄位寫入 VEVENT
+func (c *icalComponent) setEventFields(event model.CalendarEvent) error {
+	if event.Summary != "" {
+		c.set("SUMMARY", "", escapeICalText(event.Summary))
+	}
+	if event.Description != "" {
+		c.set("DESCRIPTION", "", escapeICalText(event.Description))
+	}
+	if event.Location != "" {
+		c.set("LOCATION", "", escapeICalText(event.Location))
+	}
+	switch event.Status {
+	case "confirmed", "tentative", "cancelled":
+		c.set("STATUS", "", strings.ToUpper(event.Status))
+	}
+
+	if event.Start != (model.EventTime{}) {
+		if err := c.setEventTime("DTSTART", event.Start); err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+	}
+	if event.End != (model.EventTime{}) {
+		if err := c.setEventTime("DTEND", event.End); err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+		c.remove("DURATION")
+	}
+	return nil
+}
+
+// newICalendar 建立只包含一個 VEVENT 的 VCALENDAR
+func newICalendar(uid string, event model.CalendarEvent, now time.Time) (*icalComponent, error) {
+	vevent := &icalComponent{Name: "VEVENT", Properties: []*icalProperty{
+		{Name: "UID", Value: uid},
+		{Name: "CREATED", Value: now.UTC().Format(icalUTCLayout)},
+	}}
+	if err := vevent.applyEvent(event, now); err != nil {
+		return nil, err
+	}
+
+	return newVCalendar(vevent), nil
+}
+
+func newVCalendar(vevent *icalComponent) *icalComponent {
+	return &icalComponent{
+		Name: "VCALENDAR",
+		Properties: []*icalProperty{
+			{Name: "VERSION", Value: "2.0"},
+			{Name: "PRODID", Value: "-//glt-calendar-service//CalDAV//EN"},
+		},
+		Components: []*icalComponent{vevent},
+	}
+}
+
+// EventICalendar 將事件轉換為只包含一個 VEVENT 的 iCalendar 文字
+// 相同的事件輸出相同的內容（DTSTAMP 使用事件的最後修改時間），可用於計算 ETag
+func EventICalendar(event model.CalendarEvent) (string, error) {
+	uid := event.ICalUID
+	if uid == "" {
+		uid = event.ID
+	}
+	vevent := &icalComponent{Name: "VEVENT", Properties: []*icalProperty{{Name: "UID", Value: uid}}}
+
+	if updated, err := time.Parse(time.RFC3339, event.Updated); err == nil {
+		vevent.set("DTSTAMP", "", updated.UTC().Format(icalUTCLayout))
+		vevent.set("LAST-MODIFIED", "", updated.UTC().Format(icalUTCLayout))
+	} else if start := eventStart(event); !start.IsZero() {
+		vevent.set("DTSTAMP", "", start.UTC().Format(icalUTCLayout))
+	}
+	// 沒有 status 的事件視為 confirmed，與 toCalendarEvent 一致
+	if event.Status == "" {
+		event.Status = "confirmed"
+	}
+	if err := vevent.setEventFields(event); err != nil {
+		return "", err
+	}
+	if event.Organizer.Email != "" {
+		params := ""
+		if event.Organizer.DisplayName != "" {
+			params = `;CN="` + strings.ReplaceAll(event.Organizer.DisplayName, `"`, "'") + `"`
+		}
+		vevent.set("ORGANIZER", params, "mailto:"+event.Organizer.Email)
+	}
+
+	return newVCalendar(vevent).String(), nil
+}
+
+// ParseEvent 解析 CalDAV 用戶端上傳的 iCalendar，回傳主要 VEVENT（不含 ID）
+func ParseEvent(data string) (model.CalendarEvent, error) {
+	calendar, err := parseICalendar(data)
+	if err != nil {
+		return model.CalendarEvent{}, err
+	}
+	if calendar.Name != "VCALENDAR" {
+		return model.CalendarEvent{}, fmt.Errorf("expected VCALENDAR, got %s", calendar.Name)
+	}
+	master := calendar.masterEvent()
+	if master == nil {
+		return model.CalendarEvent{}, fmt.Errorf("no VEVENT found")
+	}
+	return master.toCalendarEvent(""), nil
+}
@@ -0,0 +1,76 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"glt-calendar-service/api/model"
+	"sort"
+	"time"
+)
+
+const (
+	// GoogleProviderName 與登入提供者名稱相同，依 session 的 provider 選擇行事曆
+	GoogleProviderName = "google"
+	// MicrosoftProviderName Microsoft 365 / Outlook（Microsoft Graph）
+	MicrosoftProviderName = "microsoft"
+	// CalDAVProviderName 使用者連結的 CalDAV 帳號（Nextcloud、Fastmail、Radicale）
+	CalDAVProviderName = "caldav"
+	// PrimaryCalendarID 使用者的預設行事曆
+	PrimaryCalendarID = "primary"
+)
+
+// ListQuery 事件查詢條件，時間為 RFC3339
+type ListQuery struct {
+	TimeMin      string
+	TimeMax      string
+	MaxResults   int
+	SingleEvents bool   // 展開週期性事件，Microsoft Graph 的 calendarView 一律展開
+	OrderBy      string // startTime、updated
+}
+
+// CalendarProvider 行事曆後端，事件統一轉換為 model.CalendarEvent
+// accessToken 為 OAuth access token，以帳密驗證的後端（CalDAV）忽略此參數
+type CalendarProvider interface {
+	Name() string
+	// ListEvents 列出 calendarID（primary 為預設行事曆）中的事件
+	ListEvents(ctx context.Context, accessToken, calendarID string, query ListQuery) (*model.CalendarResponse, error)
+	GetEvent(ctx context.Context, accessToken, calendarID, eventID string) (*model.CalendarEvent, error)
+	// CreateEvent event.ID、event.ICalUID 有值時盡量沿用（後端不支援時由後端產生）
+	CreateEvent(ctx context.Context, accessToken, calendarID string, event model.CalendarEvent) (*model.CalendarEvent, error)
+	// UpdateEvent 只更新 event 中有值的欄位
+	UpdateEvent(ctx context.Context, accessToken, calendarID, eventID string, event model.CalendarEvent) (*model.CalendarEvent, error)
+	DeleteEvent(ctx context.Context, accessToken, calendarID, eventID string) error
+}
+
+// CalendarLister 可列出使用者所有行事曆的後端，不支援時只使用 primary
+type CalendarLister interface {
+	ListCalendars(ctx context.Context, accessToken string) ([]model.CalendarInfo, error)
+}
+
+// APIError 行事曆 API 回傳非 2xx 狀態碼時的錯誤
+type APIError struct {
+	StatusCode int
+	Details    map[string]interface{}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("calendar api failed with status %d: %v", e.StatusCode, e.Details)
+}
+
+// DefaultListQuery 從現在起一個月內的事件
+func DefaultListQuery(now time.Time) ListQuery {
+	return ListQuery{
+		TimeMin:      now.Format(time.RFC3339),
+		TimeMax:      now.AddDate(0, 1, 0).Format(time.RFC3339),
+		MaxResults:   100,
+		SingleEvents: true,
+		OrderBy:      "startTime",
+	}
+}
+
+// SortEvents 依開始時間排序，全天事件以當天 00:00 UTC 比較
+func SortEvents(events []model.CalendarEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventStart(events[i]).Before(eventStart(events[j]))
+	})
+}
@@ -0,0 +1,63 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"glt-calendar-service/utils"
+	"io"
+	"net/http"
+)
+
+// doJSON 以 bearer token 發送 JSON 請求，非 2xx 回應轉換為 APIError
+func doJSON(ctx context.Context, client *http.Client, method, requestURL, accessToken string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call calendar api: %w", err)
+	}
+	defer utils.CloseResponseBody(resp, "Calendar")
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body : %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errorResponse map[string]interface{}
+		if err := json.Unmarshal(respBody, &errorResponse); err != nil {
+			return fmt.Errorf("failed to parse error response => status: %d, body: %s, err: %w", resp.StatusCode, string(respBody), err)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Details: errorResponse}
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse calendar data : %w", err)
+	}
+	return nil
+}
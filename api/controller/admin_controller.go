@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/api/service"
+	"glt-calendar-service/middleware"
+)
+
+func Admin(group *gin.RouterGroup) {
+	adminGroup := group.Group("/admin", middleware.ValidateSessionHandler(), middleware.RequireRole(model.RoleAdmin))
+	{
+		adminGroup.GET("/users", service.AdminListUsers)
+		adminGroup.GET("/users/:id/sessions", service.AdminListUserSessions)
+		adminGroup.POST("/users/:id/signOut", service.AdminForceLogout)
+		adminGroup.GET("/stats", service.AdminGetStats)
+	}
+}
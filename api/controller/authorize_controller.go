@@ -3,6 +3,7 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 	"glt-calendar-service/api/service"
+	"glt-calendar-service/middleware"
 )
 
 func Authorize(group *gin.RouterGroup) {
@@ -11,5 +12,17 @@ func Authorize(group *gin.RouterGroup) {
 		authorizeGroup.GET("/validate", service.ValidateSession)
 		authorizeGroup.POST("/googleLogin", service.GoogleLogin)
 		authorizeGroup.POST("/googleSignOut", service.GoogleSignOut)
+		authorizeGroup.POST("/revoke", service.RevokeGoogleAccess)
+		authorizeGroup.POST("/tokens", service.IssueAPITokens)
+		authorizeGroup.POST("/tokens/refresh", service.RefreshAPITokens)
+		authorizeGroup.POST("/tokens/revoke", service.RevokeAPIToken)
+		authorizeGroup.GET("/scopes", middleware.ValidateSessionHandler(), service.GetGrantedScopes)
+		authorizeGroup.GET("/providers", service.ListIdentityProviders)
+		authorizeGroup.GET("/:provider/start", service.StartAuthorization)
+		authorizeGroup.GET("/:provider/callback", service.AuthorizationCallback)
+		authorizeGroup.POST("/:provider/login", service.ProviderLogin)
+		authorizeGroup.GET("/sessions", middleware.ValidateSessionHandler(), service.ListSessions)
+		authorizeGroup.DELETE("/sessions/:id", middleware.ValidateSessionHandler(), service.RevokeSession)
+		authorizeGroup.POST("/sessions/signOutAll", middleware.ValidateSessionHandler(), service.SignOutEverywhere)
 	}
 }
@@ -9,6 +9,14 @@ import (
 func Calendar(group *gin.RouterGroup) {
 	calendarGroup := group.Group("/calendar", middleware.ValidateSessionHandler())
 	{
-		calendarGroup.GET("/events", service.GetCalendarEvents)
+		calendarGroup.GET("/events", middleware.TokenScopes(service.TokenScopeCalendarRead), middleware.RequireScopesHandler("calendar.read"), service.GetCalendarEvents)
+		calendarGroup.POST("/events", middleware.TokenScopes(service.TokenScopeCalendarWrite), middleware.RequireScopesHandler("calendar.write"), service.CreateCalendarEvent)
+		calendarGroup.PATCH("/events/:id", middleware.TokenScopes(service.TokenScopeCalendarWrite), middleware.RequireScopesHandler("calendar.write"), service.UpdateCalendarEvent)
+		calendarGroup.DELETE("/events/:id", middleware.TokenScopes(service.TokenScopeCalendarWrite), middleware.RequireScopesHandler("calendar.write"), service.DeleteCalendarEvent)
+
+		// CalDAV 帳號（Nextcloud、Fastmail、Radicale），連結後以 ?provider=caldav 存取
+		calendarGroup.GET("/caldav", service.GetCalDAVAccount)
+		calendarGroup.PUT("/caldav", service.ConnectCalDAV)
+		calendarGroup.DELETE("/caldav", service.DisconnectCalDAV)
 	}
 }
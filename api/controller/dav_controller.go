@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dav"
+	"glt-calendar-service/api/service"
+	"glt-calendar-service/middleware"
+)
+
+// DAV CalDAV 伺服器不在 /api 下（原生用戶端不使用 cookie 與 CSRF token）
+func DAV(route *gin.Engine) {
+	davGroup := route.Group(service.DAVPrefix, middleware.APIHandler())
+	for _, method := range dav.Methods {
+		davGroup.Handle(method, "/*path", service.ServeDAV)
+		route.Handle(method, "/.well-known/caldav", service.WellKnownCalDAV)
+	}
+}
@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/service"
+	"glt-calendar-service/middleware"
+)
+
+func Notification(group *gin.RouterGroup) {
+	notificationGroup := group.Group("/user/notifications", middleware.ValidateSessionHandler())
+	{
+		notificationGroup.GET("", service.GetNotificationSettings)
+		notificationGroup.PUT("", service.UpdateNotificationSettings)
+	}
+}
@@ -3,11 +3,22 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 	"glt-calendar-service/api/service"
+	"glt-calendar-service/middleware"
 )
 
 func User(group *gin.RouterGroup) {
-	calendarGroup := group.Group("/user")
+	userGroup := group.Group("/user", middleware.ValidateSessionHandler())
 	{
-		calendarGroup.POST("/userProfile", service.FetchCompleteUserProfile)
+		userGroup.GET("/profile", middleware.TokenScopes(service.TokenScopeProfileRead), service.FetchCompleteUserProfile)
+		userGroup.GET("/me", middleware.TokenScopes(service.TokenScopeProfileRead), service.GetCurrentUser)
+		userGroup.PATCH("/me", service.UpdateCurrentUser)
+		userGroup.POST("/tokens", service.CreatePersonalAccessToken)
+		userGroup.GET("/tokens", service.ListPersonalAccessTokens)
+		userGroup.DELETE("/tokens/:id", service.RevokePersonalAccessToken)
+
+		// 連結其他 Google 帳號，行事曆 API 以 ?accountId= 選擇帳號
+		userGroup.GET("/accounts", service.ListLinkedAccounts)
+		userGroup.GET("/accounts/link", service.StartLinkAccount)
+		userGroup.DELETE("/accounts/:id", service.UnlinkAccount)
 	}
 }
@@ -0,0 +1,92 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+)
+
+// APITokenDaoInterface defines the interface for bearer token data access
+type APITokenDaoInterface interface {
+	InsertToken(token model.APIToken) error
+	GetToken(tokenHash string) (*model.APIToken, error)
+	DeleteToken(tokenHash string) (*model.APIToken, error)
+}
+
+type APITokenDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewAPITokenDao() *APITokenDao {
+	return &APITokenDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+func (a *APITokenDao) InsertToken(token model.APIToken) error {
+	av, err := attributevalue.MarshalMap(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal api token : %w", err)
+	}
+
+	_, err = a.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String("ApiTokens"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(token_hash)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save api token to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+func (a *APITokenDao) GetToken(tokenHash string) (*model.APIToken, error) {
+	result, err := a.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("ApiTokens"),
+		Key: map[string]types.AttributeValue{
+			"token_hash": &types.AttributeValueMemberS{Value: tokenHash},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("no api token found")
+	}
+
+	var token model.APIToken
+	if err := attributevalue.UnmarshalMap(result.Item, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal api token: %w", err)
+	}
+	return &token, nil
+}
+
+// DeleteToken 刪除並回傳 token，不存在時回傳 nil
+func (a *APITokenDao) DeleteToken(tokenHash string) (*model.APIToken, error) {
+	result, err := a.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("ApiTokens"),
+		Key: map[string]types.AttributeValue{
+			"token_hash": &types.AttributeValueMemberS{Value: tokenHash},
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete api token from DynamoDB : %w", err)
+	}
+
+	if len(result.Attributes) == 0 {
+		return nil, nil
+	}
+
+	var token model.APIToken
+	if err := attributevalue.UnmarshalMap(result.Attributes, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal api token: %w", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,111 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/encryption"
+	"glt-calendar-service/api/model"
+)
+
+// ErrEncryptionDisabled CalDAV 密碼必須加密儲存，未設定 encryption.provider 時無法連結帳號
+var ErrEncryptionDisabled = errors.New("encryption is not configured")
+
+// CalDAVAccountDaoInterface defines the interface for CalDAV account data access
+type CalDAVAccountDaoInterface interface {
+	SaveAccount(account model.CalDAVAccount) error
+	GetAccount(userID string) (*model.CalDAVAccount, error)
+	DeleteAccount(userID string) error
+}
+
+type CalDAVAccountDao struct {
+	dynamoClient *dynamodb.Client
+	encryptor    *encryption.Encryptor
+}
+
+func NewCalDAVAccountDao() *CalDAVAccountDao {
+	return &CalDAVAccountDao{
+		dynamoClient: database.GetDynamoDBClient(),
+		encryptor:    encryption.GetEncryptor(),
+	}
+}
+
+// SaveAccount 加密密碼後覆寫使用者的 CalDAV 帳號
+func (c *CalDAVAccountDao) SaveAccount(account model.CalDAVAccount) error {
+	if c.encryptor == nil {
+		return ErrEncryptionDisabled
+	}
+
+	encrypted, err := c.encryptor.Encrypt(context.TODO(), []byte(account.Password))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt CalDAV password: %w", err)
+	}
+	account.EncryptedPassword = encrypted
+
+	av, err := attributevalue.MarshalMap(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CalDAV account : %w", err)
+	}
+
+	_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("CalDAVAccounts"),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save CalDAV account to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+// GetAccount 取得並解密使用者的 CalDAV 帳號，尚未連結時回傳 nil
+func (c *CalDAVAccountDao) GetAccount(userID string) (*model.CalDAVAccount, error) {
+	result, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("CalDAVAccounts"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var account model.CalDAVAccount
+	if err := attributevalue.UnmarshalMap(result.Item, &account); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal CalDAV account: %w", err)
+	}
+
+	if account.EncryptedPassword != nil {
+		if c.encryptor == nil {
+			return nil, ErrEncryptionDisabled
+		}
+		password, err := c.encryptor.Decrypt(context.TODO(), account.EncryptedPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt CalDAV password: %w", err)
+		}
+		account.Password = string(password)
+		account.EncryptedPassword = nil
+	}
+	return &account, nil
+}
+
+func (c *CalDAVAccountDao) DeleteAccount(userID string) error {
+	_, err := c.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("CalDAVAccounts"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete CalDAV account : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/encryption"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+)
+
+// LinkedAccountDaoInterface defines the interface for linked account data access
+type LinkedAccountDaoInterface interface {
+	SaveAccount(account model.LinkedAccount) error
+	GetAccount(userID, accountID string) (*model.LinkedAccount, error)
+	GetAccountsByUserID(userID string) ([]model.LinkedAccount, error)
+	DeleteAccount(userID, accountID string) error
+}
+
+type LinkedAccountDao struct {
+	dynamoClient *dynamodb.Client
+	encryptor    *encryption.Encryptor
+}
+
+func NewLinkedAccountDao() *LinkedAccountDao {
+	return &LinkedAccountDao{
+		dynamoClient: database.GetDynamoDBClient(),
+		encryptor:    encryption.GetEncryptor(),
+	}
+}
+
+// SaveAccount 覆寫連結帳號，啟用加密時 token 以 envelope encryption 儲存
+func (l *LinkedAccountDao) SaveAccount(account model.LinkedAccount) error {
+	account.LinkID = model.LinkedAccountID(account.UserID, account.AccountID)
+	if l.encryptor != nil && account.TokenResponse != nil {
+		token, err := sealToken(l.encryptor, *account.TokenResponse)
+		if err != nil {
+			return fmt.Errorf("failed to seal linked account tokens: %w", err)
+		}
+		account.TokenResponse = token
+	}
+
+	av, err := attributevalue.MarshalMap(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal linked account : %w", err)
+	}
+
+	_, err = l.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("LinkedAccounts"),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save linked account to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+// GetAccount 取得並解密連結帳號，尚未連結時回傳 nil
+func (l *LinkedAccountDao) GetAccount(userID, accountID string) (*model.LinkedAccount, error) {
+	result, err := l.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("LinkedAccounts"),
+		Key: map[string]types.AttributeValue{
+			"link_id": &types.AttributeValueMemberS{Value: model.LinkedAccountID(userID, accountID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var account model.LinkedAccount
+	if err := attributevalue.UnmarshalMap(result.Item, &account); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal linked account: %w", err)
+	}
+	if err := l.openAccount(&account, result.Item["token_response"]); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetAccountsByUserID 透過 user_id GSI 取得使用者所有連結帳號（GSI 為最終一致性）
+func (l *LinkedAccountDao) GetAccountsByUserID(userID string) ([]model.LinkedAccount, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("LinkedAccounts"),
+		IndexName:              aws.String(database.LinkedAccountsUserIndex),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	}
+
+	var accounts []model.LinkedAccount
+	paginator := dynamodb.NewQueryPaginator(l.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("query linked accounts by user error: %w", err)
+		}
+
+		var items []model.LinkedAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal linked accounts: %w", err)
+		}
+		for i := range items {
+			if err := l.openAccount(&items[i], page.Items[i]["token_response"]); err != nil {
+				return nil, err
+			}
+		}
+		accounts = append(accounts, items...)
+	}
+	return accounts, nil
+}
+
+func (l *LinkedAccountDao) DeleteAccount(userID, accountID string) error {
+	_, err := l.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("LinkedAccounts"),
+		Key: map[string]types.AttributeValue{
+			"link_id": &types.AttributeValueMemberS{Value: model.LinkedAccountID(userID, accountID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete linked account : %w", err)
+	}
+	return nil
+}
+
+// openAccount 解密 token，明文或舊金鑰的資料以目前金鑰重新加密寫回（失敗不影響讀取）
+// stored 為讀取到的 token_response 原始值，作為寫回的條件
+func (l *LinkedAccountDao) openAccount(account *model.LinkedAccount, stored types.AttributeValue) error {
+	if account.TokenResponse == nil {
+		return nil
+	}
+
+	stale, err := openToken(l.encryptor, account.TokenResponse)
+	if err != nil {
+		return fmt.Errorf("failed to open linked account tokens: %w", err)
+	}
+	if stale && stored != nil {
+		if err := l.reencryptAccountTokens(*account, stored); err != nil {
+			logger.Warn("Failed to re-encrypt linked account tokens", zap.String("linkID", account.LinkID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// reencryptAccountTokens 以目前金鑰重新加密並只更新 token 欄位
+// 以讀取到的密文為條件，token 已被重新連結等請求更新時放棄（下次讀取再處理）
+func (l *LinkedAccountDao) reencryptAccountTokens(account model.LinkedAccount, stored types.AttributeValue) error {
+	sealed, err := sealToken(l.encryptor, *account.TokenResponse)
+	if err != nil {
+		return fmt.Errorf("failed to seal linked account tokens: %w", err)
+	}
+	token, err := attributevalue.Marshal(sealed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal linked account tokens: %w", err)
+	}
+
+	_, err = l.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("LinkedAccounts"),
+		Key: map[string]types.AttributeValue{
+			"link_id": &types.AttributeValueMemberS{Value: model.LinkedAccountID(account.UserID, account.AccountID)},
+		},
+		UpdateExpression:    aws.String("SET #token = :token"),
+		ConditionExpression: aws.String("#token = :stored"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "token_response",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token":  token,
+			":stored": stored,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt linked account tokens : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+)
+
+// NotificationDaoInterface defines the interface for notification data access
+type NotificationDaoInterface interface {
+	GetSettings(userID string) (*model.NotificationSettings, error)
+	SaveSettings(settings model.NotificationSettings) error
+	ListEnabledSettings() ([]model.NotificationSettings, error)
+	InsertMarker(marker model.NotificationMarker) (bool, error)
+	DeleteMarker(markerID string) error
+}
+
+type NotificationDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewNotificationDao() *NotificationDao {
+	return &NotificationDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+// GetSettings 取得使用者通知設定，尚未設定時回傳 nil
+func (n *NotificationDao) GetSettings(userID string) (*model.NotificationSettings, error) {
+	result, err := n.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("NotificationSettings"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var settings model.NotificationSettings
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notification settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (n *NotificationDao) SaveSettings(settings model.NotificationSettings) error {
+	av, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification settings : %w", err)
+	}
+
+	_, err = n.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("NotificationSettings"),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+// ListEnabledSettings 取得有開啟摘要或提醒、且授權未失效的使用者設定
+func (n *NotificationDao) ListEnabledSettings() ([]model.NotificationSettings, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String("NotificationSettings"),
+		FilterExpression:         aws.String("(digest_enabled = :enabled OR reminders_enabled = :enabled) AND (attribute_not_exists(#status) OR #status <> :disabled)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":enabled":  &types.AttributeValueMemberBOOL{Value: true},
+			":disabled": &types.AttributeValueMemberS{Value: model.NotificationStatusDisabled},
+		},
+	}
+
+	var settingsList []model.NotificationSettings
+	paginator := dynamodb.NewScanPaginator(n.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("scan notification settings error: %w", err)
+		}
+
+		var items []model.NotificationSettings
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notification settings: %w", err)
+		}
+		settingsList = append(settingsList, items...)
+	}
+	return settingsList, nil
+}
+
+// InsertMarker 寫入寄送紀錄，若紀錄已存在則回傳 false
+func (n *NotificationDao) InsertMarker(marker model.NotificationMarker) (bool, error) {
+	av, err := attributevalue.MarshalMap(marker)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal notification marker : %w", err)
+	}
+
+	_, err = n.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String("NotificationMarkers"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(marker_id)"),
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to save notification marker to DynamoDB : %w", err)
+	}
+	return true, nil
+}
+
+func (n *NotificationDao) DeleteMarker(markerID string) error {
+	_, err := n.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("NotificationMarkers"),
+		Key: map[string]types.AttributeValue{
+			"marker_id": &types.AttributeValueMemberS{Value: markerID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete notification marker from DynamoDB : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+)
+
+// OAuthStateDaoInterface defines the interface for OAuth state data access
+type OAuthStateDaoInterface interface {
+	InsertState(state model.OAuthState) error
+	ConsumeState(state string) (*model.OAuthState, error)
+}
+
+type OAuthStateDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewOAuthStateDao() *OAuthStateDao {
+	return &OAuthStateDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+func (o *OAuthStateDao) InsertState(state model.OAuthState) error {
+	av, err := attributevalue.MarshalMap(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oauth state : %w", err)
+	}
+
+	_, err = o.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String("OAuthStates"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#state)"),
+		ExpressionAttributeNames: map[string]string{
+			"#state": "state",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save oauth state to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+// ConsumeState 刪除並回傳 state，確保每個 state 只能使用一次
+func (o *OAuthStateDao) ConsumeState(state string) (*model.OAuthState, error) {
+	result, err := o.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("OAuthStates"),
+		Key: map[string]types.AttributeValue{
+			"state": &types.AttributeValueMemberS{Value: state},
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete oauth state from DynamoDB : %w", err)
+	}
+
+	if len(result.Attributes) == 0 {
+		return nil, fmt.Errorf("no oauth state found")
+	}
+
+	var oauthState model.OAuthState
+	if err := attributevalue.UnmarshalMap(result.Attributes, &oauthState); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal oauth state: %w", err)
+	}
+	return &oauthState, nil
+}
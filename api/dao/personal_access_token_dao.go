@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+)
+
+// PersonalAccessTokenDaoInterface defines the interface for personal access token data access
+type PersonalAccessTokenDaoInterface interface {
+	InsertToken(token model.PersonalAccessToken) error
+	GetToken(tokenHash string) (*model.PersonalAccessToken, error)
+	GetTokensByUserID(userID string) ([]model.PersonalAccessToken, error)
+	DeleteToken(tokenHash string) error
+}
+
+type PersonalAccessTokenDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewPersonalAccessTokenDao() *PersonalAccessTokenDao {
+	return &PersonalAccessTokenDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+func (p *PersonalAccessTokenDao) InsertToken(token model.PersonalAccessToken) error {
+	av, err := attributevalue.MarshalMap(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal personal access token : %w", err)
+	}
+
+	_, err = p.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String("PersonalAccessTokens"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(token_hash)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save personal access token to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+func (p *PersonalAccessTokenDao) GetToken(tokenHash string) (*model.PersonalAccessToken, error) {
+	result, err := p.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("PersonalAccessTokens"),
+		Key: map[string]types.AttributeValue{
+			"token_hash": &types.AttributeValueMemberS{Value: tokenHash},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("no personal access token found")
+	}
+
+	var token model.PersonalAccessToken
+	if err := attributevalue.UnmarshalMap(result.Item, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal personal access token: %w", err)
+	}
+	return &token, nil
+}
+
+// GetTokensByUserID 透過 user_id GSI 取得使用者所有 personal access token（GSI 為最終一致性）
+func (p *PersonalAccessTokenDao) GetTokensByUserID(userID string) ([]model.PersonalAccessToken, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("PersonalAccessTokens"),
+		IndexName:              aws.String(database.PersonalAccessTokensUserIndex),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	}
+
+	var tokens []model.PersonalAccessToken
+	paginator := dynamodb.NewQueryPaginator(p.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("query personal access tokens by user error: %w", err)
+		}
+
+		var items []model.PersonalAccessToken
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal personal access tokens: %w", err)
+		}
+		tokens = append(tokens, items...)
+	}
+	return tokens, nil
+}
+
+func (p *PersonalAccessTokenDao) DeleteToken(tokenHash string) error {
+	_, err := p.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("PersonalAccessTokens"),
+		Key: map[string]types.AttributeValue{
+			"token_hash": &types.AttributeValueMemberS{Value: tokenHash},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete personal access token from DynamoDB : %w", err)
+	}
+	return nil
+}
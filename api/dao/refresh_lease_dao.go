@@ -0,0 +1,81 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+	"strconv"
+	"time"
+)
+
+// RefreshLeaseDaoInterface defines the interface for token refresh lease data access
+type RefreshLeaseDaoInterface interface {
+	AcquireLease(lease model.RefreshLease) (bool, error)
+	ReleaseLease(sessionID, owner string) error
+}
+
+type RefreshLeaseDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewRefreshLeaseDao() *RefreshLeaseDao {
+	return &RefreshLeaseDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+// AcquireLease 取得 session 的 token 更新租約，已有未過期的租約時回傳 false
+func (r *RefreshLeaseDao) AcquireLease(lease model.RefreshLease) (bool, error) {
+	av, err := attributevalue.MarshalMap(lease)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal refresh lease : %w", err)
+	}
+
+	_, err = r.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String("TokenRefreshLeases"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(session_id) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixMilli(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to save refresh lease to DynamoDB : %w", err)
+	}
+	return true, nil
+}
+
+// ReleaseLease 釋放自己持有的租約，租約已被他人取得時不處理
+func (r *RefreshLeaseDao) ReleaseLease(sessionID, owner string) error {
+	_, err := r.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String("TokenRefreshLeases"),
+		Key: map[string]types.AttributeValue{
+			"session_id": &types.AttributeValueMemberS{Value: sessionID},
+		},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete refresh lease from DynamoDB : %w", err)
+	}
+	return nil
+}
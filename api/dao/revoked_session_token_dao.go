@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+	"time"
+)
+
+// RevokedSessionTokenDaoInterface defines the interface for the session token denylist
+type RevokedSessionTokenDaoInterface interface {
+	RevokeToken(token model.RevokedSessionToken) error
+	IsRevoked(jti string) (bool, error)
+}
+
+type RevokedSessionTokenDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewRevokedSessionTokenDao() *RevokedSessionTokenDao {
+	return &RevokedSessionTokenDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+func (r *RevokedSessionTokenDao) RevokeToken(token model.RevokedSessionToken) error {
+	av, err := attributevalue.MarshalMap(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revoked session token : %w", err)
+	}
+
+	_, err = r.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("RevokedSessionTokens"),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save revoked session token to DynamoDB : %w", err)
+	}
+	return nil
+}
+
+// IsRevoked 查詢單一 jti（或 sid: 開頭的 session 項目）是否在撤銷清單中，TTL 刪除有延遲，逾時項目視為未撤銷
+func (r *RevokedSessionTokenDao) IsRevoked(jti string) (bool, error) {
+	result, err := r.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("RevokedSessionTokens"),
+		Key: map[string]types.AttributeValue{
+			"jti": &types.AttributeValueMemberS{Value: jti},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("get revoked session token error: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return false, nil
+	}
+
+	var token model.RevokedSessionToken
+	if err := attributevalue.UnmarshalMap(result.Item, &token); err != nil {
+		return false, fmt.Errorf("failed to unmarshal revoked session token: %w", err)
+	}
+	return token.TTL > time.Now().Unix(), nil
+}
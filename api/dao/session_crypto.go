@@ -0,0 +1,131 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/encryption"
+	"glt-calendar-service/api/model"
+	"strconv"
+)
+
+// sealSessionTokens 回傳 token 欄位已加密的 session 副本，未設定加密時原樣回傳
+func (s *SessionDao) sealSessionTokens(session model.Session) (model.Session, error) {
+	if s.encryptor == nil || session.Data == nil || session.Data.TokenResponse == nil {
+		return session, nil
+	}
+
+	token, err := sealToken(s.encryptor, *session.Data.TokenResponse)
+	if err != nil {
+		return session, fmt.Errorf("failed to seal session tokens: %w", err)
+	}
+
+	data := *session.Data
+	data.TokenResponse = token
+	session.Data = &data
+	return session, nil
+}
+
+// openSessionTokens 解密 session 的 token 欄位
+// 回傳 true 代表資料為明文或以舊金鑰加密，需以目前金鑰重新加密
+func (s *SessionDao) openSessionTokens(session *model.Session) (bool, error) {
+	if session.Data == nil || session.Data.TokenResponse == nil {
+		return false, nil
+	}
+	return openToken(s.encryptor, session.Data.TokenResponse)
+}
+
+// sealToken 回傳 access/refresh/id token 已加密的副本
+func sealToken(encryptor *encryption.Encryptor, token model.GoogleTokenResponse) (*model.GoogleTokenResponse, error) {
+	secrets, err := json.Marshal(model.TokenSecrets{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IdToken:      token.IdToken,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+
+	encrypted, err := encryptor.Encrypt(context.TODO(), secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt tokens: %w", err)
+	}
+
+	token.AccessToken, token.RefreshToken, token.IdToken = "", "", ""
+	token.Encrypted = encrypted
+	return &token, nil
+}
+
+// openToken 就地解密 token 欄位，encryptor 可為 nil（未啟用加密）
+// 回傳 true 代表資料為明文或以舊金鑰加密，需以目前金鑰重新加密
+func openToken(encryptor *encryption.Encryptor, token *model.GoogleTokenResponse) (bool, error) {
+	if token.Encrypted == nil {
+		// 啟用加密前寫入的明文資料
+		return encryptor != nil && (token.AccessToken != "" || token.RefreshToken != ""), nil
+	}
+	if encryptor == nil {
+		return false, fmt.Errorf("tokens are encrypted but encryption is not configured")
+	}
+
+	plaintext, err := encryptor.Decrypt(context.TODO(), token.Encrypted)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt tokens: %w", err)
+	}
+
+	var secrets model.TokenSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return false, fmt.Errorf("failed to unmarshal tokens: %w", err)
+	}
+
+	stale := encryptor.NeedsReencryption(token.Encrypted)
+	token.AccessToken = secrets.AccessToken
+	token.RefreshToken = secrets.RefreshToken
+	token.IdToken = secrets.IdToken
+	token.Encrypted = nil
+	return stale, nil
+}
+
+// reencryptSessionTokens 以目前金鑰重新加密並只更新 token 欄位
+// 以 version 為條件，session 已被其他請求更新時放棄（下次讀取再處理），不遞增 version
+func (s *SessionDao) reencryptSessionTokens(session model.Session) error {
+	sealed, err := s.sealSessionTokens(session)
+	if err != nil {
+		return err
+	}
+
+	token, err := attributevalue.Marshal(sealed.Data.TokenResponse)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session tokens: %w", err)
+	}
+
+	values := map[string]types.AttributeValue{
+		":token": token,
+	}
+	condition := "attribute_exists(session_id) AND attribute_not_exists(version)"
+	if session.Version > 0 {
+		condition = "version = :version"
+		values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(session.Version, 10)}
+	}
+
+	_, err = s.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("Sessions"),
+		Key: map[string]types.AttributeValue{
+			"session_id": &types.AttributeValueMemberS{Value: session.SessionID},
+		},
+		UpdateExpression:    aws.String("SET #data.#token = :token"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#data":  "data",
+			"#token": "TokenResponse",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt session tokens : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"glt-calendar-service/api/encryption"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+)
+
+// newTestEncryptor 建立本地金鑰的 Encryptor，keys 為 key id -> 金鑰字元
+func newTestEncryptor(t *testing.T, currentKeyID string, keys map[string]byte) *encryption.Encryptor {
+	config := env.LocalKeyConfig{CurrentKeyID: currentKeyID, Keys: map[string]string{}}
+	for keyID, b := range keys {
+		config.Keys[keyID] = base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+	}
+	provider, err := encryption.NewLocalKeyProvider(config)
+	if err != nil {
+		t.Fatalf("NewLocalKeyProvider() error = %v", err)
+	}
+	return encryption.NewEncryptor(provider)
+}
+
+func testTokenResponse() model.GoogleTokenResponse {
+	return model.GoogleTokenResponse{
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		IdToken:      "id-1",
+		Scope:        "openid email",
+		ExpiresIn:    3600,
+	}
+}
+
+func TestSealAndOpenToken(t *testing.T) {
+	k1 := newTestEncryptor(t, "k1", map[string]byte{"k1": 'a'})
+	// 輪替後 k2 為目前金鑰，k1 保留供解密
+	rotated := newTestEncryptor(t, "k2", map[string]byte{"k1": 'a', "k2": 'b'})
+	// k1 已移除
+	removed := newTestEncryptor(t, "k2", map[string]byte{"k2": 'b'})
+
+	tests := []struct {
+		name      string
+		sealWith  *encryption.Encryptor // nil 代表以明文儲存
+		openWith  *encryption.Encryptor
+		wantStale bool
+		wantErr   bool
+	}{
+		{"round trip", k1, k1, false, false},
+		{"sealed with an old key", k1, rotated, true, false},
+		{"sealed with the current key after rotation", rotated, rotated, false, false},
+		{"plaintext after enabling encryption", nil, k1, true, false},
+		{"plaintext without encryption", nil, nil, false, false},
+		{"encrypted but encryption disabled", k1, nil, false, true},
+		{"key removed", k1, removed, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := testTokenResponse()
+			stored := &original
+			if tt.sealWith != nil {
+				sealed, err := sealToken(tt.sealWith, original)
+				if err != nil {
+					t.Fatalf("sealToken() error = %v", err)
+				}
+				if sealed.Encrypted == nil || sealed.AccessToken != "" || sealed.RefreshToken != "" || sealed.IdToken != "" {
+					t.Fatalf("sealed = %+v, want secrets only in Encrypted", sealed)
+				}
+				if sealed.Scope != original.Scope || original.AccessToken != "access-1" {
+					t.Errorf("sealed = %+v original = %+v, want other fields kept and the original untouched", sealed, original)
+				}
+				stored = sealed
+			}
+
+			stale, err := openToken(tt.openWith, stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if stale != tt.wantStale {
+				t.Errorf("stale = %v, want %v", stale, tt.wantStale)
+			}
+			if *stored != testTokenResponse() {
+				t.Errorf("opened = %+v, want %+v", *stored, testTokenResponse())
+			}
+		})
+	}
+}
@@ -2,34 +2,49 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/encryption"
 	"glt-calendar-service/api/model"
 	"glt-calendar-service/settings/log"
 	"go.uber.org/zap"
+	"strconv"
+	"time"
 )
 
 var logger = log.GetLogger()
 
+// ErrSessionVersionConflict session 已被其他請求更新（版本不符）
+var ErrSessionVersionConflict = errors.New("session version conflict")
+
+// ErrSessionNotFound session 不存在（已登出、撤銷或逾時刪除）
+var ErrSessionNotFound = errors.New("no session found")
+
 // SessionDaoInterface defines the interface for session data access
 type SessionDaoInterface interface {
 	GetSessionsBySessionID(sessionID string) (*model.Session, error)
+	ListSessionsByUserID(userID string) ([]model.Session, error)
 	InsertSession(session model.Session) error
 	UpdateSession(session model.Session) error
+	TouchSession(session model.Session) (int64, error)
 	DeleteSession(sessionID string) error
+	GetSessionStats(now time.Time) (*model.SessionStats, error)
 }
 
 type SessionDao struct {
 	dynamoClient *dynamodb.Client
+	encryptor    *encryption.Encryptor // nil 代表 token 以明文儲存
 }
 
 func NewSessionDao() *SessionDao {
 	return &SessionDao{
 		dynamoClient: database.GetDynamoDBClient(),
+		encryptor:    encryption.GetEncryptor(),
 	}
 }
 
@@ -51,7 +66,7 @@ func (s *SessionDao) GetSessionsBySessionID(sessionID string) (*model.Session, e
 
 	// 修正 S1009: 移除冗餘的 nil 檢查，直接檢查長度即可
 	if len(result.Item) == 0 {
-		return nil, fmt.Errorf("no session found")
+		return nil, ErrSessionNotFound
 	}
 
 	var session model.Session
@@ -60,10 +75,60 @@ func (s *SessionDao) GetSessionsBySessionID(sessionID string) (*model.Session, e
 		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
+	stale, err := s.openSessionTokens(&session)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		// 金鑰輪替或舊的明文資料，讀取時順便以目前金鑰重新加密
+		if err := s.reencryptSessionTokens(session); err != nil {
+			logger.Warn("Failed to re-encrypt session tokens", zap.String("sessionID", sessionID), zap.Error(err))
+		}
+	}
+
 	return &session, nil
 }
 
+// ListSessionsByUserID 透過 user_id GSI 取得使用者所有 session 的裝置與期限資訊（GSI 為最終一致性）
+// 只投影列表需要的欄位，不讀取也不解密 data 中的 Google token，回傳的 session 不可寫回
+func (s *SessionDao) ListSessionsByUserID(userID string) ([]model.Session, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("Sessions"),
+		IndexName:              aws.String(database.SessionsUserIndex),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ProjectionExpression: aws.String("session_id, user_id, user_agent, ip_address, create_date, update_date, " +
+			"last_seen_date, expiry_date, absolute_expiry_date, remember_me, version, kind, provider, #ttl"),
+		// ttl 為 DynamoDB 保留字
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": "ttl",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	}
+
+	var sessions []model.Session
+	paginator := dynamodb.NewQueryPaginator(s.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("query sessions by user error: %w", err)
+		}
+
+		var items []model.Session
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal sessions: %w", err)
+		}
+		sessions = append(sessions, items...)
+	}
+	return sessions, nil
+}
+
 func (s *SessionDao) InsertSession(session model.Session) error {
+	session, err := s.sealSessionTokens(session)
+	if err != nil {
+		return err
+	}
 
 	// session data convert to DynamoDB Attribute Value
 	av, err := attributevalue.MarshalMap(session)
@@ -73,8 +138,9 @@ func (s *SessionDao) InsertSession(session model.Session) error {
 
 	// Create PutItem Request
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String("Sessions"),
-		Item:      av,
+		TableName:           aws.String("Sessions"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(session_id)"),
 	}
 
 	// save to DynamoDB
@@ -85,7 +151,17 @@ func (s *SessionDao) InsertSession(session model.Session) error {
 	return nil
 }
 
+// UpdateSession 以 version 做樂觀鎖覆寫 session，session.Version 為讀取時的版本
+// 版本不符時回傳 ErrSessionVersionConflict；舊資料沒有 version 欄位時視為版本 0
 func (s *SessionDao) UpdateSession(updatedSession model.Session) error {
+	expectedVersion := updatedSession.Version
+	updatedSession.Version = expectedVersion + 1
+
+	updatedSession, err := s.sealSessionTokens(updatedSession)
+	if err != nil {
+		return err
+	}
+
 	// update session date transfer DynamoDB Attribute
 	av, err := attributevalue.MarshalMap(updatedSession)
 	if err != nil {
@@ -94,19 +170,69 @@ func (s *SessionDao) UpdateSession(updatedSession model.Session) error {
 
 	// create PutItem request
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String("Sessions"),
-		Item:      av,
+		TableName:           aws.String("Sessions"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_exists(session_id) AND (attribute_not_exists(version) OR version = :version)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)},
+		},
 	}
 
 	// save DynamoDB
 	_, err = s.dynamoClient.PutItem(context.TODO(), input)
 	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return ErrSessionVersionConflict
+		}
 		logger.Error("Failed to update session in DynamoDB", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
+// TouchSession 只更新最後使用時間與效期（UpdateItem），避免每次驗證都覆寫整筆 session
+// 同時遞增 version，讓以較舊資料覆寫整筆 session 的 UpdateSession 發生衝突而不會倒退效期；回傳新的 version
+func (s *SessionDao) TouchSession(session model.Session) (int64, error) {
+	values, err := attributevalue.MarshalMap(map[string]interface{}{
+		":last_seen_date": session.LastSeenDate,
+		":expiry_date":    session.ExpiryDate,
+		":update_date":    session.UpdateDate,
+		":ip_address":     session.IPAddress,
+		":ttl":            session.TTL,
+		":zero":           0,
+		":one":            1,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal session expiry : %w", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Sessions"),
+		Key: map[string]types.AttributeValue{
+			"session_id": &types.AttributeValueMemberS{Value: session.SessionID},
+		},
+		UpdateExpression:          aws.String("SET last_seen_date = :last_seen_date, expiry_date = :expiry_date, update_date = :update_date, ip_address = :ip_address, #ttl = :ttl, version = if_not_exists(version, :zero) + :one"),
+		ConditionExpression:       aws.String("attribute_exists(session_id)"),
+		ExpressionAttributeNames:  map[string]string{"#ttl": "ttl"},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	}
+
+	result, err := s.dynamoClient.UpdateItem(context.TODO(), input)
+	if err != nil {
+		return 0, fmt.Errorf("failed to touch session in DynamoDB : %w", err)
+	}
+
+	var updated struct {
+		Version int64 `dynamodbav:"version"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal session version : %w", err)
+	}
+	return updated.Version, nil
+}
+
 func (s *SessionDao) DeleteSession(sessionID string) error {
 
 	// create DeleteItem request
@@ -124,3 +250,44 @@ func (s *SessionDao) DeleteSession(sessionID string) error {
 	}
 	return nil
 }
+
+// GetSessionStats 統計未過期的 session，只讀取效期與類型，不讀取 token
+func (s *SessionDao) GetSessionStats(now time.Time) (*model.SessionStats, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String("Sessions"),
+		ProjectionExpression: aws.String("expiry_date, remember_me, kind"),
+	}
+
+	stats := &model.SessionStats{}
+	paginator := dynamodb.NewScanPaginator(s.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("scan sessions error: %w", err)
+		}
+
+		var sessions []model.Session
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &sessions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal sessions: %w", err)
+		}
+		for _, session := range sessions {
+			// TTL 刪除有延遲，過濾已過期的 session
+			if !session.ExpiryDate.After(now) {
+				continue
+			}
+			if session.Kind == model.SessionKindPAT {
+				stats.PersonalAccessToken++
+				continue
+			}
+			if session.Kind == model.SessionKindNotification {
+				stats.Notification++
+				continue
+			}
+			stats.Active++
+			if session.RememberMe {
+				stats.RememberMe++
+			}
+		}
+	}
+	return stats, nil
+}
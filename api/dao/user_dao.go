@@ -0,0 +1,210 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/model"
+	"time"
+)
+
+// UserDaoInterface defines the interface for user data access
+type UserDaoInterface interface {
+	GetUserByID(userID string) (*model.User, error)
+	UpsertLogin(profile *model.GoogleUserInfo, defaults model.UserPreferences, bootstrapAdmin bool, loginTime time.Time) (*model.User, error)
+	UpdatePreferences(userID string, preferences model.UserPreferences, updateTime time.Time) (*model.User, error)
+	ListUsers(limit int32, cursor string) ([]model.User, string, error)
+	GetUserStats(activeSince time.Time) (*model.UserStats, error)
+}
+
+type UserDao struct {
+	dynamoClient *dynamodb.Client
+}
+
+func NewUserDao() *UserDao {
+	return &UserDao{
+		dynamoClient: database.GetDynamoDBClient(),
+	}
+}
+
+func (u *UserDao) GetUserByID(userID string) (*model.User, error) {
+	result, err := u.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("Users"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get item error: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("no user found")
+	}
+
+	var user model.User
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+// UpsertLogin 登入時新增或更新使用者，首次登入時間、偏好設定與角色只在首次建立時寫入
+// bootstrapAdmin 為 true 時一律設為 admin
+func (u *UserDao) UpsertLogin(profile *model.GoogleUserInfo, defaults model.UserPreferences, bootstrapAdmin bool, loginTime time.Time) (*model.User, error) {
+	profileAv, err := attributevalue.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user profile : %w", err)
+	}
+	preferencesAv, err := attributevalue.Marshal(defaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user preferences : %w", err)
+	}
+	loginTimeAv, err := attributevalue.Marshal(loginTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal login time : %w", err)
+	}
+
+	roleExpression, role := "#role = if_not_exists(#role, :role)", model.RoleUser
+	if bootstrapAdmin {
+		roleExpression, role = "#role = :role", model.RoleAdmin
+	}
+
+	result, err := u.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("Users"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: profile.ID},
+		},
+		UpdateExpression: aws.String("SET email = :email, profile = :profile, last_login_date = :now, update_date = :now, " +
+			"first_login_date = if_not_exists(first_login_date, :now), preferences = if_not_exists(preferences, :preferences), " + roleExpression),
+		ExpressionAttributeNames: map[string]string{
+			"#role": "role",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":email":       &types.AttributeValueMemberS{Value: profile.Email},
+			":profile":     profileAv,
+			":now":         loginTimeAv,
+			":preferences": preferencesAv,
+			":role":        &types.AttributeValueMemberS{Value: role},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert user to DynamoDB : %w", err)
+	}
+
+	var user model.User
+	if err := attributevalue.UnmarshalMap(result.Attributes, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdatePreferences 更新使用者偏好設定，使用者不存在時回傳錯誤
+func (u *UserDao) UpdatePreferences(userID string, preferences model.UserPreferences, updateTime time.Time) (*model.User, error) {
+	preferencesAv, err := attributevalue.Marshal(preferences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user preferences : %w", err)
+	}
+	updateTimeAv, err := attributevalue.Marshal(updateTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update time : %w", err)
+	}
+
+	result, err := u.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("Users"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:    aws.String("SET preferences = :preferences, update_date = :now"),
+		ConditionExpression: aws.String("attribute_exists(user_id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":preferences": preferencesAv,
+			":now":         updateTimeAv,
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return nil, fmt.Errorf("no user found")
+		}
+		return nil, fmt.Errorf("failed to update user preferences in DynamoDB : %w", err)
+	}
+
+	var user model.User
+	if err := attributevalue.UnmarshalMap(result.Attributes, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+// ListUsers 分頁列出使用者，cursor 為上一頁回傳的 user_id，沒有下一頁時回傳空字串
+func (u *UserDao) ListUsers(limit int32, cursor string) ([]model.User, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String("Users"),
+		Limit:     aws.Int32(limit),
+	}
+	if cursor != "" {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: cursor},
+		}
+	}
+
+	result, err := u.dynamoClient.Scan(context.TODO(), input)
+	if err != nil {
+		return nil, "", fmt.Errorf("scan users error: %w", err)
+	}
+
+	var users []model.User
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &users); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal users: %w", err)
+	}
+
+	next := ""
+	if key, ok := result.LastEvaluatedKey["user_id"].(*types.AttributeValueMemberS); ok {
+		next = key.Value
+	}
+	return users, next, nil
+}
+
+// GetUserStats 統計使用者數量，只讀取角色與最後登入時間
+func (u *UserDao) GetUserStats(activeSince time.Time) (*model.UserStats, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String("Users"),
+		ProjectionExpression: aws.String("#role, last_login_date"),
+		ExpressionAttributeNames: map[string]string{
+			"#role": "role",
+		},
+	}
+
+	stats := &model.UserStats{}
+	paginator := dynamodb.NewScanPaginator(u.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("scan users error: %w", err)
+		}
+
+		var users []model.User
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &users); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+		for _, user := range users {
+			stats.Total++
+			if user.Role == model.RoleAdmin {
+				stats.Admins++
+			}
+			if user.LastLoginDate.After(activeSince) {
+				stats.ActiveLast24h++
+			}
+		}
+	}
+	return stats, nil
+}
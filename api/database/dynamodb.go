@@ -23,60 +23,204 @@ var (
 	logger       = log.GetLogger()
 )
 
+// SessionsUserIndex Sessions 以 user_id 查詢的 GSI
+const SessionsUserIndex = "user_id-index"
+
+// PersonalAccessTokensUserIndex PersonalAccessTokens 以 user_id 查詢的 GSI
+const PersonalAccessTokensUserIndex = "user_id-index"
+
+// LinkedAccountsUserIndex LinkedAccounts 以 user_id 查詢的 GSI
+const LinkedAccountsUserIndex = "user_id-index"
+
+// tableDefinition DynamoDB 資料表定義
+type tableDefinition struct {
+	name         string
+	hashKey      string
+	ttlAttribute string // 空字串代表不啟用 TTL
+	indexes      []globalIndex
+}
+
+// globalIndex GSI 定義，投影所有欄位
+type globalIndex struct {
+	name    string
+	hashKey string
+}
+
+var tableDefinitions = []tableDefinition{
+	{name: "Sessions", hashKey: "session_id", ttlAttribute: "ttl", indexes: []globalIndex{
+		{name: SessionsUserIndex, hashKey: "user_id"},
+	}},
+	{name: "Users", hashKey: "user_id"},
+	{name: "OAuthStates", hashKey: "state", ttlAttribute: "ttl"},
+	{name: "NotificationSettings", hashKey: "user_id"},
+	{name: "NotificationMarkers", hashKey: "marker_id", ttlAttribute: "ttl"},
+	{name: "TokenRefreshLeases", hashKey: "session_id", ttlAttribute: "ttl"},
+	{name: "ApiTokens", hashKey: "token_hash", ttlAttribute: "ttl"},
+	{name: "RevokedSessionTokens", hashKey: "jti", ttlAttribute: "ttl"},
+	{name: "CalDAVAccounts", hashKey: "user_id"},
+	{name: "PersonalAccessTokens", hashKey: "token_hash", ttlAttribute: "ttl", indexes: []globalIndex{
+		{name: PersonalAccessTokensUserIndex, hashKey: "user_id"},
+	}},
+	{name: "LinkedAccounts", hashKey: "link_id", indexes: []globalIndex{
+		{name: LinkedAccountsUserIndex, hashKey: "user_id"},
+	}},
+}
+
 // InitDynamoDB Reference : https://pkg.go.dev/github.com/aws/aws-sdk-go-v2
 func InitDynamoDB() error {
+	for _, table := range tableDefinitions {
+		if err := createTableIfNotExists(table); err != nil {
+			return err
+		}
+
+		if table.ttlAttribute == "" {
+			continue
+		}
+
+		// enable TTL
+		if err := enableTTL(table.name, table.ttlAttribute); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("Enabled TTL for the table %s successfully!", table.name))
+	}
+
+	return nil
+}
+
+func createTableIfNotExists(table tableDefinition) error {
 	svc := GetDynamoDBClient()
 
 	// Check table exists
-	exists, err := tableExists(svc, "Sessions")
+	exists, err := tableExists(svc, table.name)
 	if err != nil {
 		return fmt.Errorf("error checking table existence: %v", err)
 	}
 
-	if !exists {
-		// createTable
-		input := &dynamodb.CreateTableInput{
-			TableName: aws.String("Sessions"),
-			AttributeDefinitions: []types.AttributeDefinition{
-				{
-					AttributeName: aws.String("session_id"),
-					AttributeType: types.ScalarAttributeTypeS,
-				},
+	if exists {
+		// 既有資料表補上新增的 GSI
+		return ensureIndexes(svc, table)
+	}
+
+	// createTable
+	input := &dynamodb.CreateTableInput{
+		TableName:            aws.String(table.name),
+		AttributeDefinitions: attributeDefinitions(table),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String(table.hashKey),
+				KeyType:       types.KeyTypeHash,
 			},
-			KeySchema: []types.KeySchemaElement{
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	}
+	for _, index := range table.indexes {
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, globalSecondaryIndex(index))
+	}
+
+	_, err = svc.CreateTable(context.TODO(), input)
+	if err != nil {
+		return fmt.Errorf("error creating table %s: %v", table.name, err)
+	}
+	logger.Info(fmt.Sprintf("Created the table %s successfully!", table.name))
+	return nil
+}
+
+// ensureIndexes 建立既有資料表缺少的 GSI（DynamoDB 每次 UpdateTable 只能建立一個 GSI）
+func ensureIndexes(svc *dynamodb.Client, table tableDefinition) error {
+	if len(table.indexes) == 0 {
+		return nil
+	}
+
+	output, err := svc.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+		TableName: aws.String(table.name),
+	})
+	if err != nil {
+		return fmt.Errorf("error describing table %s: %v", table.name, err)
+	}
+
+	existing := make(map[string]bool)
+	for _, index := range output.Table.GlobalSecondaryIndexes {
+		existing[aws.ToString(index.IndexName)] = true
+	}
+
+	for _, index := range table.indexes {
+		if existing[index.name] {
+			continue
+		}
+
+		gsi := globalSecondaryIndex(index)
+		_, err := svc.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+			TableName:            aws.String(table.name),
+			AttributeDefinitions: attributeDefinitions(table),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
 				{
-					AttributeName: aws.String("session_id"),
-					KeyType:       types.KeyTypeHash,
+					Create: &types.CreateGlobalSecondaryIndexAction{
+						IndexName:             gsi.IndexName,
+						KeySchema:             gsi.KeySchema,
+						Projection:            gsi.Projection,
+						ProvisionedThroughput: gsi.ProvisionedThroughput,
+					},
 				},
 			},
-			ProvisionedThroughput: &types.ProvisionedThroughput{
-				ReadCapacityUnits:  aws.Int64(1),
-				WriteCapacityUnits: aws.Int64(1),
-			},
-		}
-
-		_, err = svc.CreateTable(context.TODO(), input)
+		})
 		if err != nil {
-			return fmt.Errorf("error creating table: %v", err)
+			return fmt.Errorf("error creating index %s on table %s: %v", index.name, table.name, err)
 		}
-		logger.Info("Created the table Sessions successfully!")
+		logger.Info(fmt.Sprintf("Created the index %s on table %s successfully!", index.name, table.name))
 	}
+	return nil
+}
 
-	// enable TTL
-	if err := enableTTL(); err != nil {
-		return err
+func attributeDefinitions(table tableDefinition) []types.AttributeDefinition {
+	definitions := []types.AttributeDefinition{
+		{
+			AttributeName: aws.String(table.hashKey),
+			AttributeType: types.ScalarAttributeTypeS,
+		},
 	}
-	logger.Info("Enabled TTL for the table Sessions successfully!")
 
-	return nil
+	defined := map[string]bool{table.hashKey: true}
+	for _, index := range table.indexes {
+		if defined[index.hashKey] {
+			continue
+		}
+		defined[index.hashKey] = true
+		definitions = append(definitions, types.AttributeDefinition{
+			AttributeName: aws.String(index.hashKey),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	return definitions
 }
 
-func enableTTL() error {
+func globalSecondaryIndex(index globalIndex) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(index.name),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String(index.hashKey),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	}
+}
+
+func enableTTL(tableName, attribute string) error {
 	svc := GetDynamoDBClient()
 
 	// 先檢查 TTL 是否已經啟用
 	ttlResponse, err := svc.DescribeTimeToLive(context.TODO(), &dynamodb.DescribeTimeToLiveInput{
-		TableName: aws.String("Sessions"),
+		TableName: aws.String(tableName),
 	})
 
 	if err != nil {
@@ -89,27 +233,27 @@ func enableTTL() error {
 		status := ttlResponse.TimeToLiveDescription.TimeToLiveStatus
 		attributeName := ttlResponse.TimeToLiveDescription.AttributeName
 
-		// 檢查 TTL 是否已啟用，且使用的屬性名稱是 "ttl"
-		if status == types.TimeToLiveStatusEnabled && *attributeName == "ttl" {
+		// 檢查 TTL 是否已啟用，且使用的屬性名稱一致
+		if status == types.TimeToLiveStatusEnabled && aws.ToString(attributeName) == attribute {
 			ttlEnabled = true
-			logger.Info("TTL is already enabled for Sessions table with attribute 'ttl'")
+			logger.Info(fmt.Sprintf("TTL is already enabled for %s table with attribute '%s'", tableName, attribute))
 		}
 	}
 
 	// 如果 TTL 尚未啟用，則啟用它
 	if !ttlEnabled {
-		logger.Info("Enabling TTL for Sessions table...")
+		logger.Info(fmt.Sprintf("Enabling TTL for %s table...", tableName))
 		_, err = svc.UpdateTimeToLive(context.TODO(), &dynamodb.UpdateTimeToLiveInput{
-			TableName: aws.String("Sessions"),
+			TableName: aws.String(tableName),
 			TimeToLiveSpecification: &types.TimeToLiveSpecification{
-				AttributeName: aws.String("ttl"),
+				AttributeName: aws.String(attribute),
 				Enabled:       aws.Bool(true),
 			},
 		})
 		if err != nil {
 			return fmt.Errorf("error enabling TTL: %v", err)
 		}
-		logger.Info("TTL enabled successfully for Sessions table")
+		logger.Info(fmt.Sprintf("TTL enabled successfully for %s table", tableName))
 	}
 	return nil
 }
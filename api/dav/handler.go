@@ -0,0 +1,563 @@
+package dav
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"glt-calendar-service/api/calendar"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/log"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	// allowedMethods OPTIONS 與 405 回應的 Allow header
+	allowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+	// listPastDays、listFutureDays 沒有 time-range 時列出的事件區間
+	listPastDays   = 90
+	listFutureDays = 365
+	maxListResults = 2500
+
+	eventContentType = "text/calendar; charset=utf-8"
+)
+
+// Methods 需要註冊到路由的 HTTP method，不支援的 method 回應 405
+var Methods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodPost,
+	"PROPFIND", "PROPPATCH", "REPORT", "MKCOL", "MKCALENDAR", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// Account 目前請求的使用者與其行事曆後端
+type Account struct {
+	Provider    calendar.CalendarProvider
+	AccessToken string
+	DisplayName string
+	Email       string
+}
+
+// Handler CalDAV（RFC 4791）伺服器，將行事曆後端的事件以 .ics 資源提供給原生用戶端
+//
+//	{prefix}/                            根目錄
+//	{prefix}/principals/me/              目前使用者的 principal
+//	{prefix}/calendars/                  calendar-home-set
+//	{prefix}/calendars/{calendarId}/     行事曆
+//	{prefix}/calendars/{calendarId}/{eventId}.ics
+//
+// 週期性事件以展開後的單一事件呈現，事件 ETag 為輸出的 iCalendar 內容雜湊
+type Handler struct {
+	prefix string
+}
+
+// NewHandler creates a CalDAV handler mounted at prefix, e.g. /dav
+func NewHandler(prefix string) *Handler {
+	return &Handler{prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+type resourceKind int
+
+const (
+	kindRoot resourceKind = iota
+	kindPrincipal
+	kindHome
+	kindCalendar
+	kindEvent
+)
+
+type resource struct {
+	kind       resourceKind
+	calendarID string
+	eventID    string
+}
+
+// PrincipalPath 目前使用者的 principal（/.well-known/caldav 導向此路徑也可）
+func (h *Handler) PrincipalPath() string {
+	return h.prefix + "/principals/me/"
+}
+
+func (h *Handler) homePath() string {
+	return h.prefix + "/calendars/"
+}
+
+func (h *Handler) calendarPath(calendarID string) string {
+	return h.homePath() + url.PathEscape(calendarID) + "/"
+}
+
+func (h *Handler) eventPath(calendarID, eventID string) string {
+	return h.calendarPath(calendarID) + url.PathEscape(eventID) + ".ics"
+}
+
+// resolve 解析請求路徑（escaped），不在 prefix 下或不存在的路徑回傳 false
+func (h *Handler) resolve(escapedPath string) (resource, bool) {
+	rest, ok := strings.CutPrefix(escapedPath, h.prefix)
+	if !ok {
+		return resource{}, false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(rest, "/") {
+		if segment == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return resource{}, false
+		}
+		segments = append(segments, unescaped)
+	}
+
+	switch {
+	case len(segments) == 0:
+		return resource{kind: kindRoot}, true
+	case len(segments) == 2 && segments[0] == "principals" && segments[1] == "me":
+		return resource{kind: kindPrincipal}, true
+	case len(segments) == 1 && segments[0] == "calendars":
+		return resource{kind: kindHome}, true
+	case len(segments) == 2 && segments[0] == "calendars":
+		return resource{kind: kindCalendar, calendarID: segments[1]}, true
+	case len(segments) == 3 && segments[0] == "calendars" && strings.HasSuffix(segments[2], ".ics") && len(segments[2]) > len(".ics"):
+		return resource{kind: kindEvent, calendarID: segments[1], eventID: strings.TrimSuffix(segments[2], ".ics")}, true
+	}
+	return resource{}, false
+}
+
+// Options 回應支援的 method 與 DAV 能力，不需要驗證
+func (h *Handler) Options(w http.ResponseWriter) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", allowedMethods)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Serve 處理已驗證的 CalDAV 請求
+func (h *Handler) Serve(w http.ResponseWriter, r *http.Request, account Account) {
+	res, ok := h.resolve(r.URL.EscapedPath())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		h.Options(w)
+	case "PROPFIND":
+		h.propfind(w, r, account, res)
+	case "REPORT":
+		h.report(w, r, account, res)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, account, res)
+	case http.MethodPut:
+		h.put(w, r, account, res)
+	case http.MethodDelete:
+		h.delete(w, r, account, res)
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, account Account, res resource) {
+	req, err := parseRequest(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	// Depth: infinity 視為 1，不遞迴列出所有行事曆的事件
+	children := r.Header.Get("Depth") != "0"
+	ctx := r.Context()
+
+	var responses []response
+	switch res.kind {
+	case kindRoot:
+		responses = append(responses, req.selectProps(h.prefix+"/", h.collectionProps("Calendar Service")))
+		if children {
+			responses = append(responses, req.selectProps(h.PrincipalPath(), h.principalProps(account)))
+		}
+	case kindPrincipal:
+		responses = append(responses, req.selectProps(h.PrincipalPath(), h.principalProps(account)))
+	case kindHome:
+		responses = append(responses, req.selectProps(h.homePath(), h.collectionProps("Calendars")))
+		if children {
+			for _, info := range h.calendars(ctx, account) {
+				responses = append(responses, req.selectProps(h.calendarPath(info.ID), h.calendarProps(info)))
+			}
+		}
+	case kindCalendar:
+		info, ok := h.findCalendar(ctx, account, res.calendarID)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		responses = append(responses, req.selectProps(h.calendarPath(res.calendarID), h.calendarProps(info)))
+		if children {
+			events, err := h.listEvents(ctx, account, res.calendarID, time.Time{}, time.Time{})
+			if err != nil {
+				h.fail(w, "Failed to list events", err)
+				return
+			}
+			for _, event := range events {
+				responses = append(responses, req.selectProps(h.eventPath(res.calendarID, event.id), event.props()))
+			}
+		}
+	case kindEvent:
+		event, err := h.getEvent(ctx, account, res)
+		if err != nil {
+			h.fail(w, "Failed to get event", err)
+			return
+		}
+		responses = append(responses, req.selectProps(h.eventPath(res.calendarID, res.eventID), event.props()))
+	}
+	writeMultistatus(w, responses)
+}
+
+// report 支援 calendar-query（time-range）與 calendar-multiget
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, account Account, res resource) {
+	req, err := parseRequest(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	if res.kind != kindCalendar || (req.Root != calName("calendar-query") && req.Root != calName("calendar-multiget")) {
+		writeError(w, http.StatusForbidden, davName("supported-report"))
+		return
+	}
+	ctx := r.Context()
+
+	var responses []response
+	if req.Root == calName("calendar-query") {
+		events, err := h.listEvents(ctx, account, res.calendarID, req.Start, req.End)
+		if err != nil {
+			h.fail(w, "Failed to query events", err)
+			return
+		}
+		for _, event := range events {
+			responses = append(responses, req.selectProps(h.eventPath(res.calendarID, event.id), event.props()))
+		}
+		writeMultistatus(w, responses)
+		return
+	}
+
+	for _, href := range req.Hrefs {
+		target, ok := h.resolveHref(href)
+		if !ok || target.kind != kindEvent {
+			responses = append(responses, response{Href: href, Status: http.StatusNotFound})
+			continue
+		}
+		event, err := h.getEvent(ctx, account, target)
+		if err != nil {
+			responses = append(responses, response{Href: href, Status: errorStatus(err)})
+			continue
+		}
+		responses = append(responses, req.selectProps(href, event.props()))
+	}
+	writeMultistatus(w, responses)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, account Account, res resource) {
+	if res.kind != kindEvent {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	event, err := h.getEvent(r.Context(), account, res)
+	if err != nil {
+		h.fail(w, "Failed to get event", err)
+		return
+	}
+	w.Header().Set("Content-Type", eventContentType)
+	w.Header().Set("ETag", event.etag)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = io.WriteString(w, event.ics)
+	}
+}
+
+// put 已存在的事件以 If-Match 檢查後更新，不存在時建立
+// 事件 ID 由後端決定，與請求的資源名稱不同時不回傳 ETag，用戶端下次同步時會取得新的 href
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, account Account, res resource) {
+	if res.kind != kindEvent {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	event, err := calendar.ParseEvent(string(data))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, calName("valid-calendar-data"))
+		return
+	}
+
+	ctx := r.Context()
+	existing, err := h.getEvent(ctx, account, res)
+	if err != nil && errorStatus(err) != http.StatusNotFound {
+		h.fail(w, "Failed to get event", err)
+		return
+	}
+	if !preconditionsMet(r, existing) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	if existing != nil {
+		updated, err := account.Provider.UpdateEvent(ctx, account.AccessToken, res.calendarID, res.eventID, event)
+		if err != nil {
+			h.fail(w, "Failed to update event", err)
+			return
+		}
+		if written, err := newEventResource(*updated); err == nil {
+			w.Header().Set("ETag", written.etag)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	event.ID = res.eventID
+	created, err := account.Provider.CreateEvent(ctx, account.AccessToken, res.calendarID, event)
+	if err != nil {
+		h.fail(w, "Failed to create event", err)
+		return
+	}
+	if created.ID == res.eventID {
+		if written, err := newEventResource(*created); err == nil {
+			w.Header().Set("ETag", written.etag)
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, account Account, res resource) {
+	if res.kind != kindEvent {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	if r.Header.Get("If-Match") != "" {
+		existing, err := h.getEvent(ctx, account, res)
+		if err != nil {
+			h.fail(w, "Failed to get event", err)
+			return
+		}
+		if !preconditionsMet(r, existing) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+	}
+
+	if err := account.Provider.DeleteEvent(ctx, account.AccessToken, res.calendarID, res.eventID); err != nil {
+		h.fail(w, "Failed to delete event", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preconditionsMet 檢查 If-Match 與 If-None-Match: *
+func preconditionsMet(r *http.Request, existing *eventResource) bool {
+	if r.Header.Get("If-None-Match") == "*" && existing != nil {
+		return false
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if existing == nil {
+			return false
+		}
+		if ifMatch != "*" && !strings.Contains(ifMatch, existing.etag) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveHref multiget 的 href 可能是絕對網址或絕對路徑
+func (h *Handler) resolveHref(href string) (resource, bool) {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return resource{}, false
+	}
+	return h.resolve(parsed.EscapedPath())
+}
+
+func (h *Handler) collectionProps(displayName string) []property {
+	return []property{
+		{Name: davName("resourcetype"), Inner: "<D:collection/>"},
+		{Name: davName("displayname"), Inner: escape(displayName)},
+		{Name: davName("current-user-principal"), Inner: hrefElement(h.PrincipalPath())},
+	}
+}
+
+func (h *Handler) principalProps(account Account) []property {
+	props := []property{
+		{Name: davName("resourcetype"), Inner: "<D:collection/><D:principal/>"},
+		{Name: davName("displayname"), Inner: escape(account.DisplayName)},
+		{Name: davName("current-user-principal"), Inner: hrefElement(h.PrincipalPath())},
+		{Name: davName("principal-URL"), Inner: hrefElement(h.PrincipalPath())},
+		{Name: calName("calendar-home-set"), Inner: hrefElement(h.homePath())},
+	}
+	if account.Email != "" {
+		props = append(props, property{Name: calName("calendar-user-address-set"), Inner: hrefElement("mailto:" + account.Email)})
+	}
+	return props
+}
+
+func (h *Handler) calendarProps(info model.CalendarInfo) []property {
+	privileges := "<D:privilege><D:read/></D:privilege>"
+	if !info.ReadOnly {
+		privileges += "<D:privilege><D:write/></D:privilege><D:privilege><D:write-content/></D:privilege>" +
+			"<D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>"
+	}
+	return []property{
+		{Name: davName("resourcetype"), Inner: "<D:collection/><C:calendar/>"},
+		{Name: davName("displayname"), Inner: escape(info.Summary)},
+		{Name: davName("current-user-principal"), Inner: hrefElement(h.PrincipalPath())},
+		{Name: davName("owner"), Inner: hrefElement(h.PrincipalPath())},
+		{Name: davName("current-user-privilege-set"), Inner: privileges},
+		{Name: davName("supported-report-set"), Inner: "<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>" +
+			"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>"},
+		{Name: calName("supported-calendar-component-set"), Inner: `<C:comp name="VEVENT"/>`},
+	}
+}
+
+// calendars 後端支援 CalendarLister 時列出所有行事曆，否則（或列出失敗時）只有 primary
+func (h *Handler) calendars(ctx context.Context, account Account) []model.CalendarInfo {
+	if lister, ok := account.Provider.(calendar.CalendarLister); ok {
+		calendars, err := lister.ListCalendars(ctx, account.AccessToken)
+		if err == nil && len(calendars) > 0 {
+			return calendars
+		}
+		if err != nil {
+			logger.Warn("Failed to list calendars, using primary only", zap.String("provider", account.Provider.Name()), zap.Error(err))
+		}
+	}
+	return []model.CalendarInfo{{ID: calendar.PrimaryCalendarID, Summary: "Calendar", Primary: true}}
+}
+
+func (h *Handler) findCalendar(ctx context.Context, account Account, calendarID string) (model.CalendarInfo, bool) {
+	calendars := h.calendars(ctx, account)
+	for _, info := range calendars {
+		if info.ID == calendarID {
+			return info, true
+		}
+	}
+	// primary 一律存在，名稱使用後端的預設行事曆
+	if calendarID == calendar.PrimaryCalendarID {
+		for _, info := range calendars {
+			if info.Primary {
+				info.ID = calendar.PrimaryCalendarID
+				return info, true
+			}
+		}
+		return model.CalendarInfo{ID: calendar.PrimaryCalendarID, Summary: "Calendar", Primary: true}, true
+	}
+	return model.CalendarInfo{}, false
+}
+
+// listEvents 列出區間內的事件，未指定區間時為過去 90 天到未來一年
+func (h *Handler) listEvents(ctx context.Context, account Account, calendarID string, start, end time.Time) ([]*eventResource, error) {
+	now := time.Now().UTC()
+	if start.IsZero() {
+		start = now.AddDate(0, 0, -listPastDays)
+	}
+	if end.IsZero() {
+		end = now.AddDate(0, 0, listFutureDays)
+	}
+
+	result, err := account.Provider.ListEvents(ctx, account.AccessToken, calendarID, calendar.ListQuery{
+		TimeMin:      start.Format(time.RFC3339),
+		TimeMax:      end.Format(time.RFC3339),
+		MaxResults:   maxListResults,
+		SingleEvents: true,
+		OrderBy:      "startTime",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*eventResource, 0, len(result.Items))
+	for _, event := range result.Items {
+		if event.Status == "cancelled" {
+			continue
+		}
+		converted, err := newEventResource(event)
+		if err != nil {
+			logger.Warn("Skipping event that cannot be converted to iCalendar", zap.String("eventID", event.ID), zap.Error(err))
+			continue
+		}
+		events = append(events, converted)
+	}
+	return events, nil
+}
+
+func (h *Handler) getEvent(ctx context.Context, account Account, res resource) (*eventResource, error) {
+	event, err := account.Provider.GetEvent(ctx, account.AccessToken, res.calendarID, res.eventID)
+	if err != nil {
+		return nil, err
+	}
+	// 已取消的事件視為已刪除
+	if event.Status == "cancelled" {
+		return nil, &calendar.APIError{StatusCode: http.StatusNotFound, Details: map[string]interface{}{"status": "cancelled"}}
+	}
+	return newEventResource(*event)
+}
+
+// eventResource 事件與其 iCalendar 內容
+type eventResource struct {
+	id   string
+	ics  string
+	etag string
+}
+
+func newEventResource(event model.CalendarEvent) (*eventResource, error) {
+	ics, err := calendar.EventICalendar(event)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(ics))
+	return &eventResource{id: event.ID, ics: ics, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}, nil
+}
+
+func (e *eventResource) props() []property {
+	return []property{
+		{Name: davName("resourcetype"), Inner: ""},
+		{Name: davName("getetag"), Inner: escape(e.etag)},
+		{Name: davName("getcontenttype"), Inner: escape(eventContentType + "; component=VEVENT")},
+		{Name: calName("calendar-data"), Inner: escape(e.ics)},
+	}
+}
+
+// errorStatus 後端錯誤對應的 HTTP 狀態碼
+func errorStatus(err error) int {
+	var apiErr *calendar.APIError
+	if !errors.As(err, &apiErr) {
+		return http.StatusBadGateway
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed:
+		return apiErr.StatusCode
+	case http.StatusGone:
+		return http.StatusNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
+
+func (h *Handler) fail(w http.ResponseWriter, message string, err error) {
+	status := errorStatus(err)
+	if status == http.StatusBadGateway {
+		logger.Error(message, zap.Error(err))
+	} else {
+		logger.Info(message, zap.Int("status", status), zap.Error(err))
+	}
+	http.Error(w, message, status)
+}
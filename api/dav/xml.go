@@ -0,0 +1,221 @@
+package dav
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	davNamespace    = "DAV:"
+	calDAVNamespace = "urn:ietf:params:xml:ns:caldav"
+
+	// timeRangeLayout CalDAV time-range 的 UTC 時間格式
+	timeRangeLayout = "20060102T150405Z"
+	// maxRequestBody PROPFIND、REPORT、PUT 的 body 上限
+	maxRequestBody = 1 << 20
+)
+
+// namespacePrefixes multistatus 根元素宣告的 namespace
+var namespacePrefixes = map[string]string{
+	davNamespace:    "D",
+	calDAVNamespace: "C",
+}
+
+func davName(local string) xml.Name {
+	return xml.Name{Space: davNamespace, Local: local}
+}
+
+func calName(local string) xml.Name {
+	return xml.Name{Space: calDAVNamespace, Local: local}
+}
+
+// request PROPFIND 與 REPORT 的 body
+type request struct {
+	Root    xml.Name
+	AllProp bool       // 沒有 body 或 <allprop/>
+	Props   []xml.Name // <prop> 中要求的屬性
+	Hrefs   []string   // calendar-multiget 的 href
+	Start   time.Time  // calendar-query 的 time-range，未指定時為零值
+	End     time.Time
+}
+
+// parseRequest 只讀取需要的元素，其他篩選條件（prop-filter、text-match）忽略
+func parseRequest(body io.Reader) (*request, error) {
+	req := &request{}
+	decoder := xml.NewDecoder(io.LimitReader(body, maxRequestBody))
+
+	var stack []xml.Name
+	var href strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case len(stack) == 0:
+				req.Root = t.Name
+			case len(stack) == 2 && stack[1] == davName("prop"):
+				req.Props = append(req.Props, t.Name)
+			case t.Name == davName("allprop"):
+				req.AllProp = true
+			case t.Name == davName("href"):
+				href.Reset()
+			case t.Name == calName("time-range") && req.Start.IsZero() && req.End.IsZero():
+				for _, attr := range t.Attr {
+					value, err := time.Parse(timeRangeLayout, attr.Value)
+					if err != nil {
+						continue
+					}
+					switch attr.Name.Local {
+					case "start":
+						req.Start = value
+					case "end":
+						req.End = value
+					}
+				}
+			}
+			stack = append(stack, t.Name)
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1] == davName("href") {
+				href.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name == davName("href") && len(stack) == 2 {
+				req.Hrefs = append(req.Hrefs, strings.TrimSpace(href.String()))
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if req.Root.Local == "" {
+		req.AllProp = true
+	}
+	return req, nil
+}
+
+// property 屬性名稱與已編碼的 XML 內容
+type property struct {
+	Name  xml.Name
+	Inner string
+}
+
+// response multistatus 中的一個資源，Status 非 0 時只回應狀態（例如 multiget 找不到的 href）
+type response struct {
+	Href     string
+	Status   int
+	Found    []property
+	NotFound []xml.Name
+}
+
+// selectProps 依要求挑選屬性，allprop 不包含 calendar-data（RFC 4791 9.6）
+func (r *request) selectProps(href string, available []property) response {
+	resp := response{Href: href}
+	if r.AllProp {
+		for _, prop := range available {
+			if prop.Name != calName("calendar-data") {
+				resp.Found = append(resp.Found, prop)
+			}
+		}
+		return resp
+	}
+
+	for _, name := range r.Props {
+		found := false
+		for _, prop := range available {
+			if prop.Name == name {
+				resp.Found = append(resp.Found, prop)
+				found = true
+				break
+			}
+		}
+		if !found {
+			resp.NotFound = append(resp.NotFound, name)
+		}
+	}
+	return resp
+}
+
+// writeMultistatus 回應 207 Multi-Status
+func writeMultistatus(w http.ResponseWriter, responses []response) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+	for _, resp := range responses {
+		b.WriteString("<D:response><D:href>")
+		b.WriteString(escape(resp.Href))
+		b.WriteString("</D:href>")
+		if resp.Status != 0 {
+			b.WriteString("<D:status>" + statusLine(resp.Status) + "</D:status>")
+		}
+		if len(resp.Found) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for _, prop := range resp.Found {
+				b.WriteString(element(prop.Name, prop.Inner))
+			}
+			b.WriteString("</D:prop><D:status>" + statusLine(http.StatusOK) + "</D:status></D:propstat>")
+		}
+		if len(resp.NotFound) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for _, name := range resp.NotFound {
+				b.WriteString(element(name, ""))
+			}
+			b.WriteString("</D:prop><D:status>" + statusLine(http.StatusNotFound) + "</D:status></D:propstat>")
+		}
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, b.String())
+}
+
+// writeError 回應 WebDAV precondition 錯誤，例如 <D:supported-report/>
+func writeError(w http.ResponseWriter, status int, condition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<D:error xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`+element(condition, "")+`</D:error>`)
+}
+
+// element 已宣告的 namespace 使用前綴，其他 namespace 在元素上宣告
+func element(name xml.Name, inner string) string {
+	tag := name.Local
+	attrs := ""
+	if prefix, ok := namespacePrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag = "X:" + name.Local
+		attrs = ` xmlns:X="` + escape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + attrs + "/>"
+	}
+	return "<" + tag + attrs + ">" + inner + "</" + tag + ">"
+}
+
+func hrefElement(href string) string {
+	return "<D:href>" + escape(href) + "</D:href>"
+}
+
+func statusLine(status int) string {
+	return "HTTP/1.1 " + strconv.Itoa(status) + " " + http.StatusText(status)
+}
+
+func escape(value string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
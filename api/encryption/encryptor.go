@@ -0,0 +1,202 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/settings/log"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// dataKeyReuse 同一把資料金鑰重複使用的時間，避免每次寫入都呼叫 KMS
+	dataKeyReuse = 5 * time.Minute
+	// maxCachedDataKeys 解密後資料金鑰的快取上限
+	maxCachedDataKeys = 1000
+)
+
+var (
+	encryptor     *Encryptor
+	encryptorOnce sync.Once
+)
+
+// Encryptor envelope encryption：資料以資料金鑰 AES-GCM 加密，資料金鑰由 KeyProvider 的主金鑰加密
+type Encryptor struct {
+	provider KeyProvider
+
+	mu            sync.Mutex
+	currentKey    *DataKey
+	currentKeyExp time.Time
+	decryptedKeys map[string][]byte // key id + encrypted key -> plaintext key
+}
+
+// NewEncryptor creates an Encryptor with the given KeyProvider
+func NewEncryptor(provider KeyProvider) *Encryptor {
+	return &Encryptor{
+		provider:      provider,
+		decryptedKeys: make(map[string][]byte),
+	}
+}
+
+// GetEncryptor 依設定建立的 Encryptor，未設定加密時回傳 nil
+func GetEncryptor() *Encryptor {
+	encryptorOnce.Do(func() {
+		logger := log.GetLogger()
+		provider, err := NewKeyProvider(context.TODO(), env.GetConfig().Encryption)
+		if err != nil {
+			// 金鑰設定錯誤時無法讀寫 token，讓部署立即發現錯誤
+			panic(fmt.Sprintf("init encryption key provider failed: %v", err))
+		}
+		if provider == nil {
+			logger.Warn("Token encryption is disabled, tokens are stored in plaintext")
+			return
+		}
+		logger.Info("Token encryption enabled", zap.String("keyID", provider.CurrentKeyID()))
+		encryptor = NewEncryptor(provider)
+	})
+	return encryptor
+}
+
+// Encrypt encrypts plaintext with a data key protected by the current master key
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext []byte) (*model.EncryptedData, error) {
+	dataKey, err := e.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext, err := gcmSeal(dataKey.Plaintext, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.EncryptedData{
+		KeyID:        dataKey.KeyID,
+		EncryptedKey: dataKey.EncryptedKey,
+		Nonce:        nonce,
+		Ciphertext:   ciphertext,
+	}, nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt
+func (e *Encryptor) Decrypt(ctx context.Context, data *model.EncryptedData) ([]byte, error) {
+	key, err := e.decryptDataKey(ctx, data.KeyID, data.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, data.Nonce, data.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// NeedsReencryption 資料不是以目前的主金鑰加密（金鑰已輪替）
+func (e *Encryptor) NeedsReencryption(data *model.EncryptedData) bool {
+	return data == nil || data.KeyID != e.provider.CurrentKeyID()
+}
+
+// dataKey 回傳可重複使用的資料金鑰，逾時或主金鑰變更時重新產生
+func (e *Encryptor) dataKey(ctx context.Context) (*DataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.currentKey != nil && e.currentKey.KeyID == e.provider.CurrentKeyID() && time.Now().Before(e.currentKeyExp) {
+		return e.currentKey, nil
+	}
+
+	dataKey, err := e.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.currentKey = dataKey
+	e.currentKeyExp = time.Now().Add(dataKeyReuse)
+	e.cacheDataKey(dataKey.KeyID, dataKey.EncryptedKey, dataKey.Plaintext)
+	return dataKey, nil
+}
+
+func (e *Encryptor) decryptDataKey(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error) {
+	cacheKey := keyID + ":" + base64.StdEncoding.EncodeToString(encryptedKey)
+
+	e.mu.Lock()
+	key, ok := e.decryptedKeys[cacheKey]
+	e.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := e.provider.DecryptDataKey(ctx, keyID, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.cacheDataKey(keyID, encryptedKey, key)
+	e.mu.Unlock()
+	return key, nil
+}
+
+// cacheDataKey 呼叫前需持有 e.mu
+func (e *Encryptor) cacheDataKey(keyID string, encryptedKey, plaintext []byte) {
+	if len(e.decryptedKeys) >= maxCachedDataKeys {
+		e.decryptedKeys = make(map[string][]byte)
+	}
+	e.decryptedKeys[keyID+":"+base64.StdEncoding.EncodeToString(encryptedKey)] = plaintext
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmSeal AES-GCM 加密，nonce 隨機產生
+func gcmSeal(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// seal AES-GCM 加密，回傳 nonce || ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	nonce, ciphertext, err := gcmSeal(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+// open 解密 seal 的結果
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,38 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"glt-calendar-service/settings/env"
+)
+
+// KeyProvider 管理主金鑰（KEK），產生與解密 envelope encryption 的資料金鑰
+type KeyProvider interface {
+	// CurrentKeyID 新資料加密使用的主金鑰 ID
+	CurrentKeyID() string
+	// GenerateDataKey 產生資料金鑰，回傳明文與以目前主金鑰加密後的密文
+	GenerateDataKey(ctx context.Context) (*DataKey, error)
+	// DecryptDataKey 以 keyID 對應的主金鑰解密資料金鑰
+	DecryptDataKey(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error)
+}
+
+// DataKey 資料金鑰（AES-256）
+type DataKey struct {
+	KeyID        string
+	Plaintext    []byte
+	EncryptedKey []byte
+}
+
+// NewKeyProvider 依設定建立 KeyProvider，provider 為空字串時回傳 nil（不加密）
+func NewKeyProvider(ctx context.Context, config env.EncryptionConfig) (KeyProvider, error) {
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case "local":
+		return NewLocalKeyProvider(config.Local)
+	case "kms":
+		return NewKMSKeyProvider(ctx, config.KMS)
+	default:
+		return nil, fmt.Errorf("unknown encryption provider: %s", config.Provider)
+	}
+}
@@ -0,0 +1,87 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"glt-calendar-service/settings/env"
+)
+
+// KMSAPI KMS 所需的操作，可替換為本地替代實作
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSKeyProvider 以 AWS KMS 的 customer managed key 作為主金鑰
+// 金鑰輪替由 KMS 處理；更換 key_id 後舊資料會在讀取時重新加密
+type KMSKeyProvider struct {
+	client KMSAPI
+	keyID  string
+}
+
+// NewKMSKeyProvider creates a KMSKeyProvider, the endpoint can point to a local stand-in such as local-kms
+func NewKMSKeyProvider(ctx context.Context, config env.KMSConfig) (*KMSKeyProvider, error) {
+	if config.KeyID == "" {
+		return nil, fmt.Errorf("kms key id is required")
+	}
+
+	var cfgOpts []func(*awsconfig.LoadOptions) error
+	if config.Region != "" {
+		cfgOpts = append(cfgOpts, awsconfig.WithRegion(config.Region))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, cfgOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	client := kms.NewFromConfig(awsCfg, func(o *kms.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+	return NewKMSKeyProviderWithClient(client, config.KeyID), nil
+}
+
+// NewKMSKeyProviderWithClient creates a KMSKeyProvider with the given client
+func NewKMSKeyProviderWithClient(client KMSAPI, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client: client,
+		keyID:  keyID,
+	}
+}
+
+func (p *KMSKeyProvider) CurrentKeyID() string {
+	return p.keyID
+}
+
+func (p *KMSKeyProvider) GenerateDataKey(ctx context.Context) (*DataKey, error) {
+	output, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms generate data key failed: %w", err)
+	}
+
+	return &DataKey{
+		KeyID:        p.keyID,
+		Plaintext:    output.Plaintext,
+		EncryptedKey: output.CiphertextBlob,
+	}, nil
+}
+
+func (p *KMSKeyProvider) DecryptDataKey(ctx context.Context, keyID string, encryptedKey []byte) ([]byte, error) {
+	output, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: encryptedKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt failed: %w", err)
+	}
+	return output.Plaintext, nil
+}
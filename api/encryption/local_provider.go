@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"glt-calendar-service/settings/env"
+)
+
+// LocalKeyProvider 以設定（或 SSM）提供的 AES-256 金鑰作為主金鑰
+// 輪替時新增金鑰並修改 current_key_id，舊金鑰保留至所有資料重新加密為止
+type LocalKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewLocalKeyProvider creates a LocalKeyProvider, every key must be a base64 encoded 32 bytes key
+func NewLocalKeyProvider(config env.LocalKeyConfig) (*LocalKeyProvider, error) {
+	keys := make(map[string][]byte, len(config.Keys))
+	for keyID, encoded := range config.Keys {
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %w", keyID, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes, got %d", keyID, len(key))
+		}
+		keys[keyID] = key
+	}
+
+	if _, ok := keys[config.CurrentKeyID]; !ok {
+		return nil, fmt.Errorf("current encryption key %s is not configured", config.CurrentKeyID)
+	}
+
+	return &LocalKeyProvider{
+		currentKeyID: config.CurrentKeyID,
+		keys:         keys,
+	}, nil
+}
+
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.currentKeyID
+}
+
+func (p *LocalKeyProvider) GenerateDataKey(_ context.Context) (*DataKey, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	encryptedKey, err := seal(p.keys[p.currentKeyID], plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key: %w", err)
+	}
+
+	return &DataKey{
+		KeyID:        p.currentKeyID,
+		Plaintext:    plaintext,
+		EncryptedKey: encryptedKey,
+	}, nil
+}
+
+func (p *LocalKeyProvider) DecryptDataKey(_ context.Context, keyID string, encryptedKey []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", keyID)
+	}
+
+	plaintext, err := open(key, encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,248 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"glt-calendar-service/api/idtoken"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCProvider 以 OpenID Connect discovery 取得端點的登入提供者
+type OIDCProvider struct {
+	name   string
+	config env.IdentityProviderConfig
+	params url.Values
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	verifier *idtoken.Verifier
+}
+
+// NewOIDCProvider creates a provider whose endpoints are discovered from the issuer on first use
+func NewOIDCProvider(name string, config env.IdentityProviderConfig) *OIDCProvider {
+	return &OIDCProvider{
+		name:   name,
+		config: config,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// NewGoogleProvider creates the Google provider with static endpoints, the ID token issuers and JWKS come from config
+func NewGoogleProvider(config env.GoogleOAuth2) *OIDCProvider {
+	issuer := "https://accounts.google.com"
+	if len(config.Issuers) > 0 {
+		issuer = config.Issuers[0]
+	}
+
+	provider := NewOIDCProvider(GoogleProviderName, env.IdentityProviderConfig{
+		DisplayName:         "Google",
+		Issuer:              issuer,
+		ClientID:            config.ClientID,
+		ClientSecret:        config.ClientSecret,
+		Scopes:              config.Scopes,
+		CallbackURI:         config.CallbackURI,
+		AllowedRedirectURIs: append([]string{config.RedirectURI}, config.AllowedRedirectURIs...),
+	})
+	provider.metadata = &Metadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: model.GoogleOAuth2AuthUrl,
+		TokenEndpoint:         model.GoogleOAuth2TokenUrl,
+		UserInfoEndpoint:      model.GoogleUserInfoUrl,
+		JWKSURI:               config.JWKSURL,
+		RevocationEndpoint:    model.GoogleOAuth2RevokeUrl,
+	}
+	provider.verifier = idtoken.NewVerifier(config.JWKSURL, config.Issuers, config.ClientID)
+	// 取得 refresh token 並沿用已授權的 scope（incremental consent）
+	provider.params = url.Values{
+		"access_type":            {"offline"},
+		"include_granted_scopes": {"true"},
+		"prompt":                 {"consent"},
+	}
+	return provider
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+func (p *OIDCProvider) DisplayName() string {
+	if p.config.DisplayName == "" {
+		return p.name
+	}
+	return p.config.DisplayName
+}
+
+func (p *OIDCProvider) ClientID() string {
+	return p.config.ClientID
+}
+
+func (p *OIDCProvider) ClientSecret() string {
+	return p.config.ClientSecret
+}
+
+func (p *OIDCProvider) Scopes() []string {
+	if len(p.config.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	return p.config.Scopes
+}
+
+func (p *OIDCProvider) CallbackURI() string {
+	return p.config.CallbackURI
+}
+
+func (p *OIDCProvider) AllowsRedirectURI(redirectURI string) bool {
+	if redirectURI == "" {
+		return false
+	}
+	return redirectURI == p.config.CallbackURI || slices.Contains(p.config.AllowedRedirectURIs, redirectURI)
+}
+
+func (p *OIDCProvider) AuthorizationParams() url.Values {
+	return p.params
+}
+
+func (p *OIDCProvider) TrustEmail() bool {
+	return p.config.TrustEmail
+}
+
+// Metadata 第一次使用時讀取 discovery 文件並快取，失敗時下次重新讀取
+func (p *OIDCProvider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.metadata = metadata
+	p.verifier = idtoken.NewVerifier(metadata.JWKSURI, []string{metadata.Issuer}, p.config.ClientID)
+	return metadata, nil
+}
+
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*idtoken.Claims, error) {
+	if _, err := p.Metadata(ctx); err != nil {
+		return nil, err
+	}
+	return p.verifier.Verify(ctx, rawToken, nonce)
+}
+
+// userInfoResponse 同時支援 OIDC userinfo 與 Google v2 userinfo 的欄位
+type userInfoResponse struct {
+	Subject           string           `json:"sub"`
+	ID                string           `json:"id"`
+	Email             string           `json:"email"`
+	EmailVerified     idtoken.BoolLike `json:"email_verified"`
+	VerifiedEmail     bool             `json:"verified_email"`
+	PreferredUsername string           `json:"preferred_username"`
+	Name              string           `json:"name"`
+	GivenName         string           `json:"given_name"`
+	FamilyName        string           `json:"family_name"`
+	Picture           string           `json:"picture"`
+	Locale            string           `json:"locale"`
+	HostedDomain      string           `json:"hd"`
+}
+
+func (p *OIDCProvider) UserInfo(ctx context.Context, accessToken string) (*model.GoogleUserInfo, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("provider %s has no userinfo endpoint", p.name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request error: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch request error: %w", err)
+	}
+	defer utils.CloseResponseBody(resp, "UserInfo")
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch user info error，statusCode: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var info userInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("error parsing user information: %w", err)
+	}
+
+	userInfo := &model.GoogleUserInfo{
+		ID:            info.Subject,
+		Email:         info.Email,
+		VerifiedEmail: bool(info.EmailVerified) || info.VerifiedEmail,
+		Name:          info.Name,
+		GivenName:     info.GivenName,
+		FamilyName:    info.FamilyName,
+		Picture:       info.Picture,
+		Locale:        info.Locale,
+		HostedDomain:  info.HostedDomain,
+	}
+	if userInfo.ID == "" {
+		userInfo.ID = info.ID
+	}
+	// Entra ID 可能只回傳 preferred_username（UPN）
+	if userInfo.Email == "" && strings.Contains(info.PreferredUsername, "@") {
+		userInfo.Email = info.PreferredUsername
+	}
+	return userInfo, nil
+}
+
+// discover 讀取 {issuer}/.well-known/openid-configuration
+func (p *OIDCProvider) discover(ctx context.Context) (*Metadata, error) {
+	discoveryURL := p.config.DiscoveryURL
+	if discoveryURL == "" {
+		discoveryURL = strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create discovery request error: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch discovery document error: %w", err)
+	}
+	defer utils.CloseResponseBody(resp, "OIDCDiscovery")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch discovery document error, statusCode: %d", resp.StatusCode)
+	}
+
+	var metadata Metadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("error parsing discovery document: %w", err)
+	}
+	// issuer 必須與設定相同（OpenID Connect Discovery 4.3）
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery issuer %s does not match configured issuer %s", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is missing required endpoints", p.name)
+	}
+	return &metadata, nil
+}
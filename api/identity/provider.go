@@ -0,0 +1,46 @@
+package identity
+
+import (
+	"context"
+	"glt-calendar-service/api/idtoken"
+	"glt-calendar-service/api/model"
+	"net/url"
+)
+
+// GoogleProviderName Google 登入提供者名稱，舊 session 沒有 provider 時視為 Google
+const GoogleProviderName = "google"
+
+// Metadata OpenID Connect discovery 文件中使用的端點
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RevocationEndpoint    string `json:"revocation_endpoint,omitempty"`
+}
+
+// IdentityProvider OAuth2 / OpenID Connect 登入提供者
+type IdentityProvider interface {
+	// Name 提供者名稱，用於路由與 session 的 provider 欄位
+	Name() string
+	DisplayName() string
+	ClientID() string
+	ClientSecret() string
+	// Scopes 登入時預設請求的 scope
+	Scopes() []string
+	// CallbackURI 後端授權流程的回呼網址
+	CallbackURI() string
+	// AllowsRedirectURI 檢查 redirect URI 是否在允許清單中（完全相符）
+	AllowsRedirectURI(redirectURI string) bool
+	// Metadata 取得授權、token、userinfo 等端點
+	Metadata(ctx context.Context) (*Metadata, error)
+	// AuthorizationParams 提供者特有的授權參數，例如 Google 的 access_type=offline
+	AuthorizationParams() url.Values
+	// VerifyIDToken 驗證 ID token，nonce 為空字串時不檢查
+	VerifyIDToken(ctx context.Context, rawToken, nonce string) (*idtoken.Claims, error)
+	// UserInfo 以 access token 呼叫 userinfo 端點
+	UserInfo(ctx context.Context, accessToken string) (*model.GoogleUserInfo, error)
+	// TrustEmail 提供者未回傳 email_verified 時是否視為已驗證
+	TrustEmail() bool
+}
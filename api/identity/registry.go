@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/settings/log"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// Registry 已啟用的登入提供者
+type Registry struct {
+	providers map[string]IdentityProvider
+}
+
+// NewRegistry creates a Registry with Google and every configured OpenID Connect provider
+// Providers without client_id or issuer are skipped
+func NewRegistry(google env.GoogleOAuth2, config env.IdentityConfig) *Registry {
+	logger := log.GetLogger()
+	registry := &Registry{providers: map[string]IdentityProvider{
+		GoogleProviderName: NewGoogleProvider(google),
+	}}
+
+	for name, providerConfig := range config.Providers {
+		name = strings.ToLower(name)
+		if name == GoogleProviderName {
+			continue
+		}
+		if providerConfig.ClientID == "" || providerConfig.Issuer == "" {
+			continue
+		}
+		registry.providers[name] = NewOIDCProvider(name, providerConfig)
+		logger.Info("Identity provider enabled", zap.String("provider", name), zap.String("issuer", providerConfig.Issuer))
+	}
+	return registry
+}
+
+// Get 取得提供者，空字串為 Google（provider 欄位加入前的 session）
+func (r *Registry) Get(name string) (IdentityProvider, bool) {
+	if name == "" {
+		name = GoogleProviderName
+	}
+	provider, ok := r.providers[strings.ToLower(name)]
+	return provider, ok
+}
+
+// Google 取得 Google 提供者
+func (r *Registry) Google() IdentityProvider {
+	return r.providers[GoogleProviderName]
+}
+
+// List 依名稱排序的提供者
+func (r *Registry) List() []IdentityProvider {
+	providers := make([]IdentityProvider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
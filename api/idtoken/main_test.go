@@ -0,0 +1,4 @@
+package idtoken
+
+// 設定檔在套件初始化時讀取，需在 settings/env 之前加入專案根目錄的設定檔路徑
+import _ "glt-calendar-service/internal/testenv"
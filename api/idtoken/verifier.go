@@ -0,0 +1,326 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"glt-calendar-service/settings/log"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheTTL JWKS 回應未提供 max-age 時的快取時間
+	defaultCacheTTL = time.Hour
+	// minRefreshInterval 遇到未知 kid 時重新抓取 JWKS 的最短間隔
+	minRefreshInterval = time.Minute
+	// clockSkew 允許的時間誤差
+	clockSkew = time.Minute
+)
+
+var logger = log.GetLogger()
+
+// Claims Google ID token 內容
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      Audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified BoolLike `json:"email_verified,omitempty"`
+	HostedDomain  string   `json:"hd,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	GivenName     string   `json:"given_name,omitempty"`
+	FamilyName    string   `json:"family_name,omitempty"`
+	Picture       string   `json:"picture,omitempty"`
+	Locale        string   `json:"locale,omitempty"`
+}
+
+// Audience aud 可能為字串或字串陣列
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("invalid aud claim: %w", err)
+	}
+	*a = multiple
+	return nil
+}
+
+// BoolLike email_verified 可能為布林值或字串 "true"
+type BoolLike bool
+
+func (b *BoolLike) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = BoolLike(value)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid boolean claim: %w", err)
+	}
+	parsed, err := strconv.ParseBool(text)
+	if err != nil {
+		return fmt.Errorf("invalid boolean claim: %w", err)
+	}
+	*b = BoolLike(parsed)
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier 以 JWKS 驗證 ID token 的簽章、issuer、audience、效期與 nonce
+// jwksURL 可指向本地的 JWKS 模擬伺服器
+type Verifier struct {
+	jwksURL  string
+	issuers  []string
+	audience string
+	client   *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+// NewVerifier creates a new Verifier instance
+func NewVerifier(jwksURL string, issuers []string, audience string) *Verifier {
+	return &Verifier{
+		jwksURL:  jwksURL,
+		issuers:  issuers,
+		audience: audience,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		keys: make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Verify 驗證 ID token 並回傳 claims，nonce 為空字串時不檢查 nonce
+func (v *Verifier) Verify(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+
+	var tokenHeader header
+	if err := decodeSegment(parts[0], &tokenHeader); err != nil {
+		return nil, fmt.Errorf("invalid id token header: %w", err)
+	}
+	if tokenHeader.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id token algorithm: %s", tokenHeader.Alg)
+	}
+
+	key, err := v.getKey(ctx, tokenHeader.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token signature encoding: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid id token signature: %w", err)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid id token payload: %w", err)
+	}
+
+	if err := v.validateClaims(&claims, nonce); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (v *Verifier) validateClaims(claims *Claims, nonce string) error {
+	if !slices.Contains(v.issuers, claims.Issuer) {
+		return fmt.Errorf("invalid id token issuer: %s", claims.Issuer)
+	}
+	if !slices.Contains(claims.Audience, v.audience) {
+		return fmt.Errorf("invalid id token audience: %v", claims.Audience)
+	}
+
+	now := utils.GetCurrentTime()
+	if now.Add(-clockSkew).After(time.Unix(claims.ExpiresAt, 0)) {
+		return fmt.Errorf("id token expired")
+	}
+	if claims.IssuedAt > 0 && now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return fmt.Errorf("id token issued in the future")
+	}
+
+	if nonce != "" && claims.Nonce != nonce {
+		return fmt.Errorf("id token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("id token subject is empty")
+	}
+	return nil
+}
+
+// getKey 取得 kid 對應的公鑰，快取過期或找不到 kid 時重新抓取 JWKS
+func (v *Verifier) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fresh := utils.GetCurrentTime().Before(v.expiresAt)
+	canRefresh := utils.GetCurrentTime().Sub(v.lastFetched) >= minRefreshInterval
+	v.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	// 找不到 kid 但快取仍有效時，限制重新抓取頻率
+	if fresh && !canRefresh {
+		return nil, fmt.Errorf("unknown id token key id: %s", kid)
+	}
+
+	if err := v.refreshKeys(ctx); err != nil {
+		// 抓取失敗時沿用舊的公鑰
+		if ok {
+			logger.Warn("Failed to refresh JWKS, using cached key", zap.Error(err))
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown id token key id: %s", kid)
+	}
+	return key, nil
+}
+
+func (v *Verifier) refreshKeys(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return fmt.Errorf("create jwks request error: %w", err)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks error: %w", err)
+	}
+	defer utils.CloseResponseBody(resp, "FetchJWKS")
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			logger.Warn("Skip invalid JWK", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("no usable keys in jwks")
+	}
+
+	now := utils.GetCurrentTime()
+	v.mu.Lock()
+	v.keys = keys
+	v.lastFetched = now
+	v.expiresAt = now.Add(cacheTTL(resp.Header.Get("Cache-Control")))
+	v.mu.Unlock()
+
+	logger.Info("JWKS refreshed", zap.Int("keys", len(keys)))
+	return nil
+}
+
+// cacheTTL 解析 Cache-Control 的 max-age
+func cacheTTL(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if value, found := strings.CutPrefix(directive, "max-age="); found {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return defaultCacheTTL
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > int64(^uint32(0)>>1) {
+		return nil, fmt.Errorf("exponent too large")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,220 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://accounts.google.com"
+	testAudience = "client-id.apps.googleusercontent.com"
+)
+
+// jwksStandIn 本地 JWKS 端點，可在測試中輪替公鑰
+type jwksStandIn struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+	server  *httptest.Server
+}
+
+func newJWKSStandIn(t *testing.T) *jwksStandIn {
+	s := &jwksStandIn{keys: map[string]*rsa.PrivateKey{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+
+		var jwks struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			jwks.Keys = append(jwks.Keys, jsonWebKey{
+				Kid: kid,
+				Kty: "RSA",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *jwksStandIn) addKey(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	s.mu.Lock()
+	s.keys[kid] = key
+	s.mu.Unlock()
+	return key
+}
+
+func (s *jwksStandIn) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            testIssuer,
+		"sub":            "110169484474386276334",
+		"aud":            testAudience,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          "nonce-1",
+		"email":          "user@example.com",
+		"email_verified": "true",
+	}
+}
+
+func TestVerifierVerify(t *testing.T) {
+	jwks := newJWKSStandIn(t)
+	key := jwks.addKey(t, "key-1")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid", token: signToken(t, key, "key-1", validClaims()), nonce: "nonce-1"},
+		{name: "audience list", token: signToken(t, key, "key-1", with("aud", []string{"other", testAudience})), nonce: "nonce-1"},
+		{name: "nonce not checked", token: signToken(t, key, "key-1", validClaims())},
+		{name: "bad signature", token: signToken(t, otherKey, "key-1", validClaims()), nonce: "nonce-1", wantErr: "invalid id token signature"},
+		{name: "tampered payload", token: tamper(t, signToken(t, key, "key-1", validClaims())), nonce: "nonce-1", wantErr: "invalid id token signature"},
+		{name: "wrong audience", token: signToken(t, key, "key-1", with("aud", "other-client")), nonce: "nonce-1", wantErr: "invalid id token audience"},
+		{name: "wrong issuer", token: signToken(t, key, "key-1", with("iss", "https://evil.example.com")), nonce: "nonce-1", wantErr: "invalid id token issuer"},
+		{name: "expired", token: signToken(t, key, "key-1", with("exp", time.Now().Add(-2*clockSkew).Unix())), nonce: "nonce-1", wantErr: "id token expired"},
+		{name: "issued in the future", token: signToken(t, key, "key-1", with("iat", time.Now().Add(2*clockSkew).Unix())), nonce: "nonce-1", wantErr: "issued in the future"},
+		{name: "nonce mismatch", token: signToken(t, key, "key-1", validClaims()), nonce: "nonce-2", wantErr: "nonce mismatch"},
+		{name: "empty subject", token: signToken(t, key, "key-1", with("sub", "")), nonce: "nonce-1", wantErr: "subject is empty"},
+		{name: "malformed", token: "not-a-jwt", wantErr: "malformed id token"},
+	}
+
+	verifier := NewVerifier(jwks.server.URL, []string{testIssuer, "accounts.google.com"}, testAudience)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token, tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "110169484474386276334" || claims.Email != "user@example.com" || !bool(claims.EmailVerified) {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+
+	// 快取有效期間只抓取一次 JWKS
+	if fetches := jwks.fetchCount(); fetches != 1 {
+		t.Errorf("jwks fetches = %d, want 1", fetches)
+	}
+}
+
+func TestVerifierRefetchesOnUnknownKeyID(t *testing.T) {
+	jwks := newJWKSStandIn(t)
+	oldKey := jwks.addKey(t, "key-1")
+	verifier := NewVerifier(jwks.server.URL, []string{testIssuer}, testAudience)
+
+	if _, err := verifier.Verify(context.Background(), signToken(t, oldKey, "key-1", validClaims()), "nonce-1"); err != nil {
+		t.Fatalf("Verify(key-1) error = %v", err)
+	}
+
+	// 提供者輪替公鑰
+	newKey := jwks.addKey(t, "key-2")
+	rotated := signToken(t, newKey, "key-2", validClaims())
+
+	// 剛抓取過時不立即重新抓取，避免未知 kid 造成大量請求
+	if _, err := verifier.Verify(context.Background(), rotated, "nonce-1"); err == nil || !strings.Contains(err.Error(), "unknown id token key id") {
+		t.Fatalf("Verify(key-2) error = %v, want unknown key id", err)
+	}
+	if fetches := jwks.fetchCount(); fetches != 1 {
+		t.Fatalf("jwks fetches = %d, want 1 within the refresh interval", fetches)
+	}
+
+	// 超過最短間隔後，未知 kid 觸發重新抓取
+	verifier.mu.Lock()
+	verifier.lastFetched = verifier.lastFetched.Add(-minRefreshInterval)
+	verifier.mu.Unlock()
+
+	if _, err := verifier.Verify(context.Background(), rotated, "nonce-1"); err != nil {
+		t.Fatalf("Verify(key-2) after refresh error = %v", err)
+	}
+	if fetches := jwks.fetchCount(); fetches != 2 {
+		t.Errorf("jwks fetches = %d, want 2", fetches)
+	}
+
+	// 仍不存在的 kid 在重新抓取後回報錯誤
+	verifier.mu.Lock()
+	verifier.lastFetched = verifier.lastFetched.Add(-minRefreshInterval)
+	verifier.mu.Unlock()
+	if _, err := verifier.Verify(context.Background(), signToken(t, newKey, "key-3", validClaims()), "nonce-1"); err == nil || !strings.Contains(err.Error(), "unknown id token key id") {
+		t.Errorf("Verify(key-3) error = %v, want unknown key id", err)
+	}
+}
+
+// tamper 修改 payload 但保留原簽章
+func tamper(t *testing.T, token string) string {
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["email"] = "attacker@example.com"
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(data)
+	return strings.Join(parts, ".")
+}
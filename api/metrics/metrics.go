@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Namespace CloudWatch metrics namespace
+const Namespace = "GltCalendarService"
+
+// Session store metric names
+const (
+	SessionRead          = "SessionRead"
+	SessionWrite         = "SessionWrite"
+	SessionCacheHit      = "SessionCacheHit"
+	SessionExtendSkipped = "SessionExtendSkipped"
+	// SessionTokenHit 以 session token（JWT）驗證，未讀取 DynamoDB
+	SessionTokenHit = "SessionTokenHit"
+)
+
+var counters sync.Map // name -> *atomic.Int64
+
+// Incr adds one to the named counter
+func Incr(name string) {
+	Add(name, 1)
+}
+
+// Add adds delta to the named counter
+func Add(name string, delta int64) {
+	counter, _ := counters.LoadOrStore(name, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(delta)
+}
+
+// Snapshot returns the current value of all counters
+func Snapshot() map[string]int64 {
+	snapshot := make(map[string]int64)
+	counters.Range(func(key, value any) bool {
+		snapshot[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+// Delta returns the counters that changed between two snapshots
+func Delta(before, after map[string]int64) map[string]int64 {
+	delta := make(map[string]int64)
+	for name, value := range after {
+		if diff := value - before[name]; diff != 0 {
+			delta[name] = diff
+		}
+	}
+	return delta
+}
+
+// Emit writes the values to stdout in CloudWatch Embedded Metric Format
+// Lambda 會將 stdout 的 EMF 記錄自動轉成 CloudWatch metrics，不需額外呼叫 PutMetricData
+func Emit(values map[string]int64, dimensions map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metricDefinitions := make([]map[string]string, 0, len(names))
+	record := make(map[string]any, len(values)+len(dimensions)+1)
+	for _, name := range names {
+		metricDefinitions = append(metricDefinitions, map[string]string{"Name": name, "Unit": "Count"})
+		record[name] = values[name]
+	}
+
+	dimensionKeys := make([]string, 0, len(dimensions))
+	for key, value := range dimensions {
+		dimensionKeys = append(dimensionKeys, key)
+		record[key] = value
+	}
+	sort.Strings(dimensionKeys)
+
+	record["_aws"] = map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{
+			{
+				"Namespace":  Namespace,
+				"Dimensions": [][]string{dimensionKeys},
+				"Metrics":    metricDefinitions,
+			},
+		},
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stdout, string(line))
+}
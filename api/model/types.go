@@ -3,23 +3,41 @@ package model
 import (
 	"glt-calendar-service/settings/log"
 	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
 // GoogleTokenRequest ==================================== Google OAuth2 ====================================
 
 const (
+	// GoogleOAuth2AuthUrl Google OAuth2 Authorization URL
+	GoogleOAuth2AuthUrl = "https://accounts.google.com/o/oauth2/v2/auth"
 	// GoogleOAuth2TokenUrl Google OAuth2 Token URL
 	GoogleOAuth2TokenUrl = "https://oauth2.googleapis.com/token"
 	// GoogleOAuth2RefreshTokenUrl Google OAuth2 Refresh Token URL
 	GoogleOAuth2RefreshTokenUrl = "https://oauth2.googleapis.com/token"
+	// GoogleOAuth2RevokeUrl Google OAuth2 Revoke Token URL
+	GoogleOAuth2RevokeUrl = "https://oauth2.googleapis.com/revoke"
+	// GoogleUserInfoUrl Google OAuth2 UserInfo URL
+	GoogleUserInfoUrl = "https://www.googleapis.com/oauth2/v2/userinfo"
 )
 
+// Google 以簡寫回傳的 scope 與完整名稱對照
+var scopeAliases = map[string]string{
+	"profile": "https://www.googleapis.com/auth/userinfo.profile",
+	"email":   "https://www.googleapis.com/auth/userinfo.email",
+}
+
 var logger = log.GetLogger()
 
 type GoogleTokenRequest struct {
 	Code        string `json:"code"`
 	RedirectUri string `json:"redirectUri"`
+	RememberMe  bool   `json:"rememberMe"`
+	// Provider 登入提供者，空字串為 Google（僅 /authorize/tokens 使用）
+	Provider string `json:"provider,omitempty"`
 }
 
 type GoogleTokenResponse struct {
@@ -31,15 +49,83 @@ type GoogleTokenResponse struct {
 	Scope                 string    `json:"scope,omitempty"`    // 可選字段
 	IdToken               string    `json:"id_token,omitempty"` // 可選字段
 	CreatedAt             time.Time `json:"-"`                  // 創建時間，不從 JSON 序列化
+	// Encrypted 儲存時加密的 token 欄位（access/refresh/id token），讀取後解密回上方欄位
+	Encrypted *EncryptedData `json:"-" dynamodbav:",omitempty"`
+}
+
+// TokenSecrets 需要加密儲存的 token 欄位
+type TokenSecrets struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+}
+
+// EncryptedData envelope encryption 的密文：資料以資料金鑰 AES-GCM 加密，資料金鑰再以主金鑰加密
+type EncryptedData struct {
+	KeyID        string `dynamodbav:"key_id"`        // 加密資料金鑰的主金鑰 ID，輪替後用來判斷是否需重新加密
+	EncryptedKey []byte `dynamodbav:"encrypted_key"` // 以主金鑰加密的資料金鑰
+	Nonce        []byte `dynamodbav:"nonce"`
+	Ciphertext   []byte `dynamodbav:"ciphertext"`
+}
+
+// OAuthState 後端授權流程的暫存資料（state、PKCE verifier、nonce）
+type OAuthState struct {
+	State        string    `dynamodbav:"state"`
+	CodeVerifier string    `dynamodbav:"code_verifier"`
+	Nonce        string    `dynamodbav:"nonce"`
+	RedirectURI  string    `dynamodbav:"redirect_uri"`
+	ReturnTo     string    `dynamodbav:"return_to"`
+	RememberMe   bool      `dynamodbav:"remember_me"`
+	Provider     string    `dynamodbav:"provider"`
+	CreateDate   time.Time `dynamodbav:"create_date"`
+	ExpiryDate   time.Time `dynamodbav:"expiry_date"`
+	TTL          int64     `dynamodbav:"ttl"`
+	// LinkUserID 連結帳號流程的發起使用者，callback 時不登入而是加入該使用者的連結帳號
+	LinkUserID string `dynamodbav:"link_user_id,omitempty"`
+}
+
+// AuthorizationRequest Google 授權網址參數
+type AuthorizationRequest struct {
+	Scopes        []string
+	RedirectURI   string
+	State         string
+	CodeChallenge string // PKCE S256 code challenge
+	Nonce         string
+	Prompt        string // 覆寫提供者預設的 prompt，例如連結帳號時讓使用者選擇帳號
 }
 
-// GooglePhoneInfo struct google phone info
-type GooglePhoneInfo struct {
+// GooglePersonInfo struct google people api person (people/me)
+type GooglePersonInfo struct {
 	ResourceName string `json:"resourceName"`
 	PhoneNumbers []struct {
 		Value string `json:"value"`
 		Type  string `json:"type"`
 	} `json:"phoneNumbers"`
+	Organizations []struct {
+		Name       string `json:"name"`
+		Title      string `json:"title"`
+		Department string `json:"department"`
+		Type       string `json:"type"`
+	} `json:"organizations"`
+	Birthdays []struct {
+		Date *struct {
+			Year  int `json:"year"`
+			Month int `json:"month"`
+			Day   int `json:"day"`
+		} `json:"date"`
+		Text string `json:"text"`
+	} `json:"birthdays"`
+	Addresses []struct {
+		FormattedValue string `json:"formattedValue"`
+		Type           string `json:"type"`
+	} `json:"addresses"`
+	Locales []struct {
+		Value string `json:"value"`
+	} `json:"locales"`
+	Photos []struct {
+		URL     string `json:"url"`
+		Default bool   `json:"default"`
+	} `json:"photos"`
 }
 
 // GoogleUserInfo struct google user profile
@@ -51,6 +137,43 @@ type GoogleUserInfo struct {
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
 	Picture       string `json:"picture"`
+	Locale        string `json:"locale,omitempty"`
+	HostedDomain  string `json:"hd,omitempty"` // Google Workspace 網域，個人帳號沒有
+	// TrustedEmail VerifiedEmail 來自提供者的 trust_email 設定而非 email_verified claim
+	TrustedEmail bool `json:"-" dynamodbav:"-"`
+}
+
+// UserProfile 完整的用戶資料（基本資訊與 People API），快取於 session
+type UserProfile struct {
+	ID            string                       `json:"id"`
+	Email         string                       `json:"email"`
+	VerifiedEmail bool                         `json:"verified_email"`
+	Name          string                       `json:"name"`
+	GivenName     string                       `json:"given_name"`
+	FamilyName    string                       `json:"family_name"`
+	Picture       string                       `json:"picture"`
+	PhoneNumbers  []string                     `json:"phone_numbers,omitempty"`
+	Organizations []ProfileOrganization        `json:"organizations,omitempty"`
+	Birthdays     []string                     `json:"birthdays,omitempty"`
+	Addresses     []string                     `json:"addresses,omitempty"`
+	Locales       []string                     `json:"locales,omitempty"`
+	Photos        []string                     `json:"photos,omitempty"`
+	PersonFields  []string                     `json:"person_fields"`
+	FieldErrors   map[string]ProfileFieldError `json:"field_errors,omitempty"` // key 為 personFields 欄位名稱
+	FetchedAt     time.Time                    `json:"fetched_at"`
+}
+
+type ProfileOrganization struct {
+	Name       string `json:"name"`
+	Title      string `json:"title,omitempty"`
+	Department string `json:"department,omitempty"`
+}
+
+// ProfileFieldError People API 欄位取得失敗的原因
+type ProfileFieldError struct {
+	Reason        string   `json:"reason"` // missing_scope, request_failed
+	MissingScopes []string `json:"missing_scopes,omitempty"`
+	Message       string   `json:"message,omitempty"`
 }
 
 // Calendar ==================================== Google Calendar ====================================
@@ -66,6 +189,11 @@ type CalendarEvent struct {
 	Creator     Person    `json:"creator"`
 	Organizer   Person    `json:"organizer"`
 	Status      string    `json:"status"`
+	ICalUID     string    `json:"iCalUID,omitempty"` // iCalendar UID，CalDAV 用戶端以此辨識事件
+	Updated     string    `json:"updated,omitempty"` // 最後修改時間（RFC3339）
+	// AccountID、AccountEmail 事件所屬的帳號（登入帳號或連結帳號），由 API 標記
+	AccountID    string `json:"accountId,omitempty"`
+	AccountEmail string `json:"accountEmail,omitempty"`
 }
 
 type EventTime struct {
@@ -88,21 +216,145 @@ type CalendarResponse struct {
 	Items    []CalendarEvent `json:"items"`
 }
 
+// CalendarInfo 使用者可存取的行事曆
+type CalendarInfo struct {
+	ID       string `json:"id"`
+	Summary  string `json:"summary"`
+	Primary  bool   `json:"primary,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
 // Session ==================================== DynamoDB Sessions ====================================
 
 type SessionData struct {
 	TokenResponse *GoogleTokenResponse
 	UserInfo      *GoogleUserInfo
+	Profile       *UserProfile
+	Scopes        []string `dynamodbav:",stringset,omitempty"` // 已授權的 OAuth scope
 }
 
 type Session struct {
-	SessionID  string       `json:"session_id" dynamodbav:"session_id"`
-	UserID     string       `json:"user_id" dynamodbav:"user_id"`
-	Data       *SessionData `json:"data" dynamodbav:"data"`
-	CreateDate time.Time    `json:"create_date" dynamodbav:"create_date"`
-	UpdateDate time.Time    `json:"update_date" dynamodbav:"update_date"`
-	ExpiryDate time.Time    `json:"expiry_date" dynamodbav:"expiry_date"`
-	TTL        int64        `json:"ttl" dynamodbav:"ttl"` // TTL Time To Leave
+	SessionID    string       `json:"session_id" dynamodbav:"session_id"`
+	UserID       string       `json:"user_id" dynamodbav:"user_id"`
+	Data         *SessionData `json:"data" dynamodbav:"data"`
+	UserAgent    string       `json:"user_agent" dynamodbav:"user_agent"`
+	IPAddress    string       `json:"ip_address" dynamodbav:"ip_address"`
+	CreateDate   time.Time    `json:"create_date" dynamodbav:"create_date"`
+	UpdateDate   time.Time    `json:"update_date" dynamodbav:"update_date"`
+	LastSeenDate time.Time    `json:"last_seen_date" dynamodbav:"last_seen_date"`
+	ExpiryDate   time.Time    `json:"expiry_date" dynamodbav:"expiry_date"`
+	// AbsoluteExpiryDate 最長有效時間，滑動延長不會超過此時間
+	AbsoluteExpiryDate time.Time `json:"absolute_expiry_date" dynamodbav:"absolute_expiry_date"`
+	RememberMe         bool      `json:"remember_me" dynamodbav:"remember_me"`
+	// Version 樂觀鎖版本，每次 UpdateSession 遞增
+	Version int64 `json:"version" dynamodbav:"version"`
+	// Kind session 類型，空字串為一般登入，pat 為 personal access token 專用，notification 為通知排程專用
+	Kind string `json:"kind,omitempty" dynamodbav:"kind,omitempty"`
+	// Provider 登入提供者，空字串為 Google（加入此欄位前建立的 session）
+	Provider string `json:"provider,omitempty" dynamodbav:"provider,omitempty"`
+	// CSRFToken synchronizer token，cookie 驗證的狀態變更請求需於 X-CSRF-Token header 帶上
+	CSRFToken string `json:"-" dynamodbav:"csrf_token,omitempty"`
+	TTL       int64  `json:"ttl" dynamodbav:"ttl"` // TTL Time To Leave
+	// Stateless 由 session token（JWT）還原的 session，只有識別資訊，不可寫回 DynamoDB
+	Stateless bool `json:"-" dynamodbav:"-"`
+}
+
+// RefreshLease 跨 Lambda 的 token 更新租約，同一時間只有一個執行個體向 Google 更新 token
+type RefreshLease struct {
+	SessionID string `dynamodbav:"session_id"`
+	Owner     string `dynamodbav:"owner"`
+	ExpiresAt int64  `dynamodbav:"expires_at"` // unix 毫秒，供條件式比較
+	TTL       int64  `dynamodbav:"ttl"`
+}
+
+// RevokedSessionToken 已撤銷的 session token，保留至 token 逾時為止
+// JTI 為撤銷單一 token；以 sid: 開頭時撤銷該 session 簽發的所有 token
+type RevokedSessionToken struct {
+	JTI       string    `dynamodbav:"jti"`
+	RevokedAt time.Time `dynamodbav:"revoked_at"`
+	TTL       int64     `dynamodbav:"ttl"`
+}
+
+// APIToken 服務核發給非瀏覽器用戶端的 bearer token，只儲存雜湊值
+type APIToken struct {
+	TokenHash  string    `dynamodbav:"token_hash"`
+	Kind       string    `dynamodbav:"kind"` // access、refresh
+	SessionID  string    `dynamodbav:"session_id"`
+	UserID     string    `dynamodbav:"user_id"`
+	PairHash   string    `dynamodbav:"pair_hash,omitempty"` // refresh token 對應的 access token，撤銷時一併刪除
+	CreateDate time.Time `dynamodbav:"create_date"`
+	ExpiryDate time.Time `dynamodbav:"expiry_date"`
+	TTL        int64     `dynamodbav:"ttl"`
+}
+
+// APITokenResponse 核發 bearer token 的回應
+type APITokenResponse struct {
+	AccessToken           string `json:"access_token"`
+	TokenType             string `json:"token_type"`
+	ExpiresIn             int    `json:"expires_in"`
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"`
+}
+
+// APITokenRequest refresh / revoke bearer token 的請求
+type APITokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	Token        string `json:"token"`
+}
+
+// SessionKindPAT personal access token 專用的 session，不會滑動延長，也不列在裝置清單
+const SessionKindPAT = "pat"
+
+// SessionKindNotification 通知排程專用的 session，登出瀏覽器不影響通知
+const SessionKindNotification = "notification"
+
+// IsCredentialSession 非瀏覽器登入的 session（personal access token、通知排程）
+func (s *Session) IsCredentialSession() bool {
+	return s.Kind == SessionKindPAT || s.Kind == SessionKindNotification
+}
+
+// PersonalAccessToken 使用者建立的長效 token，只儲存雜湊值
+// 每個 token 有專屬的 session 保存 Google token，與瀏覽器登入的 session 分開
+type PersonalAccessToken struct {
+	TokenHash  string    `json:"-" dynamodbav:"token_hash"`
+	ID         string    `json:"id" dynamodbav:"token_id"`
+	UserID     string    `json:"-" dynamodbav:"user_id"`
+	SessionID  string    `json:"-" dynamodbav:"session_id"`
+	Name       string    `json:"name" dynamodbav:"name"`
+	Scopes     []string  `json:"scopes" dynamodbav:"scopes,stringset"`
+	CreateDate time.Time `json:"create_date" dynamodbav:"create_date"`
+	ExpiryDate time.Time `json:"expiry_date" dynamodbav:"expiry_date"`
+	TTL        int64     `json:"-" dynamodbav:"ttl"`
+}
+
+// PersonalAccessTokenRequest 建立 personal access token 的請求
+type PersonalAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	ExpiresInDays int      `json:"expiresInDays"`
+	Scopes        []string `json:"scopes"`
+}
+
+// PersonalAccessTokenResponse 建立後回傳的 token 明文只會出現這一次
+type PersonalAccessTokenResponse struct {
+	Token string `json:"token"`
+	PersonalAccessToken
+}
+
+// SessionDevice 建立 session 的裝置資訊
+type SessionDevice struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionSummary 提供給使用者查看的 session 資訊，不包含 token 與 session id
+type SessionSummary struct {
+	ID           string    `json:"id"` // session id 的雜湊值
+	UserAgent    string    `json:"userAgent"`
+	IPAddress    string    `json:"ipAddress"`
+	CreateDate   time.Time `json:"createDate"`
+	LastSeenDate time.Time `json:"lastSeenDate"`
+	ExpiryDate   time.Time `json:"expiryDate"`
+	Current      bool      `json:"current"`
 }
 
 func (s *Session) IsSessionExpired() bool {
@@ -179,6 +431,241 @@ func (s *Session) IsTokenExpired() bool {
 	return isExpired
 }
 
+// User ==================================== DynamoDB Users ====================================
+
+type UserPreferences struct {
+	TimeZone        string `json:"timeZone" dynamodbav:"time_zone"`
+	DefaultCalendar string `json:"defaultCalendar" dynamodbav:"default_calendar"`
+	Locale          string `json:"locale" dynamodbav:"locale"`
+	WeekStart       int    `json:"weekStart" dynamodbav:"week_start"` // 0: Sunday, 1: Monday ... 6: Saturday
+}
+
+type User struct {
+	UserID         string          `json:"userId" dynamodbav:"user_id"`
+	Email          string          `json:"email" dynamodbav:"email"`
+	Profile        *GoogleUserInfo `json:"profile" dynamodbav:"profile"`
+	Preferences    UserPreferences `json:"preferences" dynamodbav:"preferences"`
+	Role           string          `json:"role" dynamodbav:"role"`
+	FirstLoginDate time.Time       `json:"firstLoginDate" dynamodbav:"first_login_date"`
+	LastLoginDate  time.Time       `json:"lastLoginDate" dynamodbav:"last_login_date"`
+	UpdateDate     time.Time       `json:"updateDate" dynamodbav:"update_date"`
+}
+
+// 使用者角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// HasRole admin 可使用所有角色的功能；舊資料沒有角色時視為一般使用者
+func (u *User) HasRole(role string) bool {
+	current := u.Role
+	if current == "" {
+		current = RoleUser
+	}
+	return current == role || current == RoleAdmin
+}
+
+// Principal 目前請求的身分，由 ValidateSession 放入 context
+type Principal struct {
+	UserID    string
+	SessionID string
+	Role      string // RequireRole 讀取使用者資料後填入
+}
+
+// UserStats 使用者統計
+type UserStats struct {
+	Total         int `json:"total"`
+	Admins        int `json:"admins"`
+	ActiveLast24h int `json:"activeLast24h"`
+}
+
+// SessionStats session 統計（不含已過期但尚未被 TTL 刪除的 session）
+type SessionStats struct {
+	Active              int `json:"active"`
+	RememberMe          int `json:"rememberMe"`
+	PersonalAccessToken int `json:"personalAccessToken"`
+	Notification        int `json:"notification"`
+}
+
+type UserPreferencesRequest struct {
+	TimeZone        *string `json:"timeZone"`
+	DefaultCalendar *string `json:"defaultCalendar"`
+	Locale          *string `json:"locale"`
+	WeekStart       *int    `json:"weekStart"`
+}
+
+// LinkedAccount ==================================== Linked Accounts ====================================
+
+// LinkedAccount 使用者額外連結的 Google 帳號，token 與登入 session 分開儲存
+type LinkedAccount struct {
+	LinkID        string               `json:"-" dynamodbav:"link_id"` // user_id#account_id
+	UserID        string               `json:"-" dynamodbav:"user_id"`
+	AccountID     string               `json:"accountId" dynamodbav:"account_id"` // Google 帳號的 sub
+	Provider      string               `json:"provider" dynamodbav:"provider"`
+	Email         string               `json:"email" dynamodbav:"email"`
+	Name          string               `json:"name" dynamodbav:"name"`
+	Picture       string               `json:"picture,omitempty" dynamodbav:"picture,omitempty"`
+	TokenResponse *GoogleTokenResponse `json:"-" dynamodbav:"token_response"`
+	Scopes        []string             `json:"scopes" dynamodbav:"scopes,stringset,omitempty"`
+	CreateDate    time.Time            `json:"createDate" dynamodbav:"create_date"`
+	UpdateDate    time.Time            `json:"updateDate" dynamodbav:"update_date"`
+}
+
+// LinkedAccountID 連結帳號資料表的 key
+func LinkedAccountID(userID, accountID string) string {
+	return userID + "#" + accountID
+}
+
+// IsTokenExpired access token 已過期或將在 5 分鐘內過期
+func (a *LinkedAccount) IsTokenExpired() bool {
+	if a == nil || a.TokenResponse == nil || a.TokenResponse.AccessToken == "" || a.TokenResponse.ExpiresIn <= 0 {
+		return true
+	}
+
+	createdAt := a.TokenResponse.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = a.UpdateDate
+	}
+	expiresAt := createdAt.Add(time.Duration(a.TokenResponse.ExpiresIn) * time.Second)
+	return time.Now().Add(5 * time.Minute).After(expiresAt)
+}
+
+// LinkedAccountSummary GET /user/accounts 的帳號，Primary 為目前登入的帳號
+type LinkedAccountSummary struct {
+	AccountID string   `json:"accountId"`
+	Provider  string   `json:"provider"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+	Picture   string   `json:"picture,omitempty"`
+	Primary   bool     `json:"primary,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+// CalDAV ==================================== CalDAV Accounts ====================================
+
+// CalDAVAccount 使用者連結的 CalDAV 帳號，密碼以 envelope encryption 加密儲存
+type CalDAVAccount struct {
+	UserID            string           `json:"-" dynamodbav:"user_id"`
+	ServerURL         string           `json:"serverUrl" dynamodbav:"server_url"`
+	Username          string           `json:"username" dynamodbav:"username"`
+	Password          string           `json:"-" dynamodbav:"-"`
+	EncryptedPassword *EncryptedData   `json:"-" dynamodbav:"encrypted_password"`
+	PrimaryCalendar   string           `json:"primaryCalendar" dynamodbav:"primary_calendar"` // calendarId=primary 使用的行事曆 href
+	Calendars         []CalDAVCalendar `json:"calendars" dynamodbav:"calendars"`
+	CreateDate        time.Time        `json:"createDate" dynamodbav:"create_date"`
+	UpdateDate        time.Time        `json:"updateDate" dynamodbav:"update_date"`
+}
+
+// CalDAVCalendar PROPFIND 找到的行事曆，Href 即 API 的 calendarId
+type CalDAVCalendar struct {
+	Href        string `json:"href" dynamodbav:"href"`
+	DisplayName string `json:"displayName" dynamodbav:"display_name"`
+}
+
+// CalDAVAccountRequest 連結 CalDAV 帳號，password 建議使用 app password
+type CalDAVAccountRequest struct {
+	ServerURL       string `json:"serverUrl" binding:"required"`
+	Username        string `json:"username" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	PrimaryCalendar string `json:"primaryCalendar"`
+}
+
+// Notification ==================================== Notification ====================================
+
+type NotificationSettings struct {
+	UserID           string    `json:"-" dynamodbav:"user_id"`
+	SessionID        string    `json:"-" dynamodbav:"session_id"`                      // 排程使用此通知專用 session 的 token 讀取行事曆
+	Status           string    `json:"status,omitempty" dynamodbav:"status,omitempty"` // 授權失效時為 disabled，需重新儲存設定以重新授權
+	DisabledReason   string    `json:"disabledReason,omitempty" dynamodbav:"disabled_reason,omitempty"`
+	Email            string    `json:"email" dynamodbav:"email"`
+	DigestEnabled    bool      `json:"digestEnabled" dynamodbav:"digest_enabled"`
+	RemindersEnabled bool      `json:"remindersEnabled" dynamodbav:"reminders_enabled"`
+	ReminderOffsets  []int     `json:"reminderOffsets" dynamodbav:"reminder_offsets"` // 事件開始前幾分鐘提醒
+	TimeZone         string    `json:"timeZone" dynamodbav:"time_zone"`
+	CalendarID       string    `json:"calendarId" dynamodbav:"calendar_id"`
+	UpdateDate       time.Time `json:"updateDate" dynamodbav:"update_date"`
+}
+
+type NotificationSettingsRequest struct {
+	DigestEnabled    *bool   `json:"digestEnabled"`
+	RemindersEnabled *bool   `json:"remindersEnabled"`
+	ReminderOffsets  []int   `json:"reminderOffsets"`
+	TimeZone         *string `json:"timeZone"`
+	CalendarID       *string `json:"calendarId"`
+}
+
+const (
+	NotificationStatusActive   = "active"
+	NotificationStatusDisabled = "disabled"
+
+	// NotificationDisabledRevoked Google 授權已撤銷（refresh token 失效或使用者撤銷存取權）
+	NotificationDisabledRevoked = "credential_revoked"
+	// NotificationDisabledMissing 通知專用 session 已不存在或逾時
+	NotificationDisabledMissing = "credential_missing"
+)
+
+// NotificationMarker 已寄送紀錄，避免重複通知
+type NotificationMarker struct {
+	MarkerID   string    `dynamodbav:"marker_id"`
+	UserID     string    `dynamodbav:"user_id"`
+	CreateDate time.Time `dynamodbav:"create_date"`
+	TTL        int64     `dynamodbav:"ttl"`
+}
+
+// GrantedScopes returns the OAuth scopes granted to the session
+func (s *Session) GrantedScopes() []string {
+	if s == nil || s.Data == nil {
+		return nil
+	}
+	if len(s.Data.Scopes) > 0 {
+		return s.Data.Scopes
+	}
+	// 舊 session 未儲存 scope 集合時，從 token response 解析
+	if s.Data.TokenResponse != nil {
+		return ParseScopes(s.Data.TokenResponse.Scope)
+	}
+	return nil
+}
+
+// Scope ==================================== OAuth Scope ====================================
+
+// ParseScopes 將空白分隔的 scope 字串轉為排序且不重複的集合，簡寫會轉為完整名稱
+func ParseScopes(scope string) []string {
+	return MergeScopes(nil, strings.Fields(scope))
+}
+
+// MergeScopes 合併兩組 scope，回傳排序且不重複的集合
+func MergeScopes(current, added []string) []string {
+	set := make(map[string]struct{}, len(current)+len(added))
+	for _, scope := range append(slices.Clone(current), added...) {
+		if alias, ok := scopeAliases[scope]; ok {
+			scope = alias
+		}
+		set[scope] = struct{}{}
+	}
+
+	merged := make([]string, 0, len(set))
+	for scope := range set {
+		merged = append(merged, scope)
+	}
+	slices.Sort(merged)
+	return merged
+}
+
+// HasAnyScope 檢查是否已授權 candidates 中任一 scope
+func HasAnyScope(granted []string, candidates ...string) bool {
+	for _, scope := range candidates {
+		if alias, ok := scopeAliases[scope]; ok {
+			scope = alias
+		}
+		if slices.Contains(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
+
 // Cookie ==================================== Client Cookie ====================================
 
 type Cookie struct {
@@ -189,4 +676,5 @@ type Cookie struct {
 	Domain   string
 	Secure   bool
 	HttpOnly bool
+	SameSite http.SameSite // 0 代表使用設定的預設值
 }
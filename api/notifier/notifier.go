@@ -0,0 +1,41 @@
+package notifier
+
+import (
+	"context"
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/settings/log"
+	"go.uber.org/zap"
+)
+
+var logger = log.GetLogger()
+
+// Message 通知內容
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Notifier defines the interface for sending notifications
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewNotifier 依設定建立 Notifier，未設定 SMTP host 時只寫入日誌
+func NewNotifier(config env.NotificationConfig) Notifier {
+	if config.SMTP.Host == "" {
+		return &LogNotifier{}
+	}
+	return NewSMTPNotifier(config.SMTP)
+}
+
+// LogNotifier 僅將通知內容寫入日誌，用於本地開發
+type LogNotifier struct{}
+
+func (n *LogNotifier) Send(_ context.Context, msg Message) error {
+	logger.Info("Notification (log only)",
+		zap.Strings("to", msg.To),
+		zap.String("subject", msg.Subject),
+	)
+	return nil
+}
@@ -0,0 +1,127 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"glt-calendar-service/settings/env"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier 透過 SMTP 寄送 Email
+// 未設定帳號時不做驗證，可直接搭配本地 SMTP 模擬器（如 MailHog）使用
+type SMTPNotifier struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPNotifier creates a new SMTPNotifier instance
+func NewSMTPNotifier(config env.SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{
+		addr:     net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		host:     config.Host,
+		username: config.Username,
+		password: config.Password,
+		from:     config.From,
+	}
+}
+
+// Send 寄送郵件，ctx 取消或逾時時關閉連線，不留下進行中的 SMTP 連線
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return fmt.Errorf("no recipient specified")
+	}
+
+	if err := n.send(ctx, msg); err != nil {
+		// 連線因 ctx 結束而中斷時回傳 ctx 的錯誤，連線 deadline 取自 ctx，可能比 ctx 先到期
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return context.DeadlineExceeded
+		}
+		return fmt.Errorf("failed to send mail via %s: %w", n.addr, err)
+	}
+	return nil
+}
+
+// send 與 smtp.SendMail 相同的流程，但連線由 ctx 控制
+func (n *SMTPNotifier) send(ctx context.Context, msg Message) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("server doesn't support AUTH")
+		}
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(n.buildMessage(msg)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage 組成 RFC 5322 格式的郵件內容
+func (n *SMTPNotifier) buildMessage(msg Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + n.from + "\r\n")
+	builder.WriteString("To: " + strings.Join(msg.To, ", ") + "\r\n")
+	builder.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"glt-calendar-service/settings/env"
+)
+
+// smtpStandInOptions 伺服器行為，須在開始接受連線前決定
+type smtpStandInOptions struct {
+	// rejectRcpt 為 true 時拒絕收件者
+	rejectRcpt bool
+	// silent 為 true 時接受連線但不回應
+	silent bool
+}
+
+// smtpStandIn 最小的本地 SMTP 伺服器，記錄收到的指令與郵件內容
+type smtpStandIn struct {
+	listener net.Listener
+	options  smtpStandInOptions
+	// closed 用戶端關閉連線時通知（silent 模式）
+	closed chan struct{}
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newSMTPStandIn(t *testing.T, options smtpStandInOptions) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpStandIn{listener: listener, options: options, closed: make(chan struct{}, 1)}
+	t.Cleanup(func() { _ = listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) config() env.SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return env.SMTPConfig{Host: host, Port: portNumber, From: "calendar@example.com"}
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	if s.options.silent {
+		// 不回應 greeting，直到用戶端關閉連線
+		_, _ = io.Copy(io.Discard, conn)
+		s.closed <- struct{}{}
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "HELO", "MAIL", "RSET", "NOOP":
+			reply("250 OK")
+		case "AUTH":
+			reply("235 Authentication successful")
+		case "RCPT":
+			if s.options.rejectRcpt {
+				reply("550 No such user")
+				continue
+			}
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() ([]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), s.data
+}
+
+func TestSMTPNotifierSend(t *testing.T) {
+	server := newSMTPStandIn(t, smtpStandInOptions{})
+	config := server.config()
+	config.Username = "mailer"
+	config.Password = "secret"
+
+	err := NewSMTPNotifier(config).Send(context.Background(), Message{
+		To:      []string{"alice@example.com", "bob@example.com"},
+		Subject: "每日行程摘要 2026-10-20",
+		Body:    "2026-10-20 的行程：\n\n- 09:00 Standup\n",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	commands, data := server.received()
+	want := []string{
+		"AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret")),
+		"MAIL FROM:<calendar@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"RCPT TO:<bob@example.com>",
+		"DATA",
+	}
+	joined := strings.Join(commands, "\n")
+	for _, command := range want {
+		if !strings.Contains(joined, command) {
+			t.Errorf("commands = %q, missing %q", commands, command)
+		}
+	}
+
+	headers, body, found := strings.Cut(data, "\r\n\r\n")
+	if !found {
+		t.Fatalf("message has no header separator: %q", data)
+	}
+	for _, header := range []string{
+		"From: calendar@example.com",
+		"To: alice@example.com, bob@example.com",
+		"Subject: =?UTF-8?q?",
+		"Content-Type: text/plain; charset=\"UTF-8\"",
+	} {
+		if !strings.Contains(headers, header) {
+			t.Errorf("headers = %q, missing %q", headers, header)
+		}
+	}
+	// 內文換行轉為 CRLF
+	if body != "2026-10-20 的行程：\r\n\r\n- 09:00 Standup\r\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPNotifierSendErrors(t *testing.T) {
+	t.Run("no recipient", func(t *testing.T) {
+		server := newSMTPStandIn(t, smtpStandInOptions{})
+		if err := NewSMTPNotifier(server.config()).Send(context.Background(), Message{Subject: "x"}); err == nil {
+			t.Error("Send() error = nil, want no recipient error")
+		}
+		if commands, _ := server.received(); len(commands) != 0 {
+			t.Errorf("commands = %q, want no connection", commands)
+		}
+	})
+
+	t.Run("recipient rejected", func(t *testing.T) {
+		server := newSMTPStandIn(t, smtpStandInOptions{rejectRcpt: true})
+		err := NewSMTPNotifier(server.config()).Send(context.Background(), Message{To: []string{"nobody@example.com"}, Subject: "x"})
+		if err == nil || !strings.Contains(err.Error(), "550") {
+			t.Errorf("Send() error = %v, want 550", err)
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		server := newSMTPStandIn(t, smtpStandInOptions{silent: true})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := NewSMTPNotifier(server.config()).Send(ctx, Message{To: []string{"alice@example.com"}, Subject: "x"})
+		if err != context.DeadlineExceeded {
+			t.Errorf("Send() error = %v, want context.DeadlineExceeded", err)
+		}
+		// Send 回傳時連線已關閉
+		select {
+		case <-server.closed:
+		case <-time.After(time.Second):
+			t.Error("connection still open after Send returned")
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		server := newSMTPStandIn(t, smtpStandInOptions{silent: true})
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err := NewSMTPNotifier(server.config()).Send(ctx, Message{To: []string{"alice@example.com"}, Subject: "x"})
+		if err != context.Canceled {
+			t.Errorf("Send() error = %v, want context.Canceled", err)
+		}
+		select {
+		case <-server.closed:
+		case <-time.After(time.Second):
+			t.Error("connection still open after Send returned")
+		}
+	})
+}
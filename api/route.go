@@ -11,18 +11,22 @@ import (
 var logger = log.GetLogger()
 
 var routeRegistrations = []func(*gin.RouterGroup){
+	controller.Admin,
 	controller.Authorize,
 	controller.Calendar,
 	controller.Health,
+	controller.Notification,
+	controller.User,
 }
 
 func RegisterRoutes(route *gin.Engine) {
 	route.Use(middleware.InitBaseHandlers()...)
 
-	group := route.Group("/api", middleware.APIHandler())
+	group := route.Group("/api", middleware.APIHandler(), middleware.CSRFHandler())
 	for _, apiSetup := range routeRegistrations {
 		apiSetup(group)
 	}
+	controller.DAV(route)
 
 	route.NoRoute(func(context *gin.Context) {
 		logger.Error(fmt.Sprintf("No route found for method : %s, url :  %s", context.Request.Method, context.Request.URL.Path))
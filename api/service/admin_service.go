@@ -0,0 +1,94 @@
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/metrics"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 100
+)
+
+// AdminListUsers 分頁列出使用者，query limit、cursor（上一頁回傳的 nextCursor）
+func AdminListUsers(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", strconv.Itoa(defaultAdminPageSize)))
+	if err != nil || limit < 1 || limit > maxAdminPageSize {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"}, "", err)
+		return
+	}
+
+	users, next, err := userDao.ListUsers(int32(limit), context.Query("cursor"))
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list users"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{"users": users, "nextCursor": next})
+}
+
+// AdminListUserSessions 列出指定使用者的 session
+func AdminListUserSessions(context *gin.Context) {
+	userID := context.Param("id")
+	sessions, err := sessionManager.ListUserSessions(userID, "")
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list sessions"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{"userId": userID, "sessions": sessions})
+}
+
+// AdminForceLogout 強制登出指定使用者：刪除所有 session，撤銷 personal access token 並停用通知
+func AdminForceLogout(context *gin.Context) {
+	principal, err := GetPrincipal(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	userID := context.Param("id")
+	deleted, err := sessionManager.DeleteUserSessions(userID, "")
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign out user"}, "", err)
+		return
+	}
+	revokeUserPersonalAccessTokens(userID)
+	revokeNotifications(userID)
+
+	// 稽核紀錄
+	logger.Info("Admin forced logout",
+		zap.String("adminID", principal.UserID),
+		zap.String("userID", userID),
+		zap.Int("revokedSessions", deleted),
+	)
+	respHandler.SuccessContextMessage(context, gin.H{"message": "User signed out", "revoked": deleted})
+}
+
+// AdminGetStats 系統統計：使用者、session 數量與本執行個體的計數器
+func AdminGetStats(context *gin.Context) {
+	currentTime := utils.GetCurrentTime()
+
+	userStats, err := userDao.GetUserStats(currentTime.Add(-24 * time.Hour))
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get stats"}, "", err)
+		return
+	}
+	sessionStats, err := sessionManager.sessionDao.GetSessionStats(currentTime)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get stats"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{
+		"users":     userStats,
+		"sessions":  sessionStats,
+		"instance":  metrics.Snapshot(),
+		"timestamp": currentTime,
+	})
+}
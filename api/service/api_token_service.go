@@ -0,0 +1,229 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiAccessTokenPrefix  = "glt_at_"
+	apiRefreshTokenPrefix = "glt_rt_"
+
+	apiTokenKindAccess  = "access"
+	apiTokenKindRefresh = "refresh"
+)
+
+var apiTokenDao dao.APITokenDaoInterface = dao.NewAPITokenDao()
+
+// BearerToken 取得 Authorization: Bearer header 的 token，沒有時回傳空字串
+func BearerToken(context *gin.Context) string {
+	scheme, token, ok := strings.Cut(context.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// IssueAPITokens 核發 bearer token 給非瀏覽器用戶端
+// 已登入（cookie 或 bearer）時對應目前的 session；否則以 body 中 provider（預設 Google）的 authorization code 登入後核發
+func IssueAPITokens(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in IssueAPITokens", nil)
+		}
+	}()
+
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		var req model.GoogleTokenRequest
+		if bindErr := context.ShouldBindBodyWith(&req, binding.JSON); bindErr != nil || req.Code == "" {
+			respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "No session or authorization code", err)
+			return
+		}
+		if _, ok := loginWithCode(context, req.Provider); !ok {
+			return
+		}
+		if session, err = utils.GetSessionFromContext(context); err != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign in"}, "", err)
+			return
+		}
+	}
+
+	response, err := issueAPITokenPair(session)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to issue tokens"}, "", err)
+		return
+	}
+	respHandler.SuccessContextMessage(context, response)
+}
+
+// RefreshAPITokens 以 refresh token 換發新的 token，舊的 refresh token 立即失效（rotation）
+func RefreshAPITokens(context *gin.Context) {
+	var req model.APITokenRequest
+	if err := context.ShouldBindJSON(&req); err != nil || !strings.HasPrefix(req.RefreshToken, apiRefreshTokenPrefix) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "refresh_token is required"}, "", err)
+		return
+	}
+
+	// 刪除即使用，同一個 refresh token 只能換發一次
+	refreshToken, err := apiTokenDao.DeleteToken(hashAPIToken(req.RefreshToken))
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to refresh tokens"}, "", err)
+		return
+	}
+	if refreshToken == nil || refreshToken.Kind != apiTokenKindRefresh || utils.GetCurrentTime().After(refreshToken.ExpiryDate) {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid refresh token", "code": "reauth_required"}, "", nil)
+		return
+	}
+	revokePairedToken(refreshToken)
+
+	session, err := sessionManager.GetSessionByID(refreshToken.SessionID)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Session expired, please login again", "code": "reauth_required"}, "", err)
+		return
+	}
+
+	response, err := issueAPITokenPair(session)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to refresh tokens"}, "", err)
+		return
+	}
+	respHandler.SuccessContextMessage(context, response)
+}
+
+// RevokeAPIToken 撤銷 access 或 refresh token（body token / refresh_token，或 Authorization header）
+// 撤銷 refresh token 時一併撤銷對應的 access token；token 不存在時同樣回應成功
+func RevokeAPIToken(context *gin.Context) {
+	var req model.APITokenRequest
+	_ = context.ShouldBindJSON(&req)
+
+	token := req.Token
+	if token == "" {
+		token = req.RefreshToken
+	}
+	if token == "" {
+		token = BearerToken(context)
+	}
+	if token == "" {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "token is required"}, "", nil)
+		return
+	}
+
+	revoked, err := apiTokenDao.DeleteToken(hashAPIToken(token))
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to revoke token"}, "", err)
+		return
+	}
+	if revoked != nil {
+		revokePairedToken(revoked)
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Token revoked"})
+}
+
+// resolveBearerToken 驗證 bearer access token 並回傳對應的紀錄
+func resolveBearerToken(token string) (*model.APIToken, error) {
+	if !strings.HasPrefix(token, apiAccessTokenPrefix) {
+		return nil, fmt.Errorf("unsupported bearer token")
+	}
+
+	apiToken, err := apiTokenDao.GetToken(hashAPIToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if apiToken.Kind != apiTokenKindAccess {
+		return nil, fmt.Errorf("bearer token is not an access token")
+	}
+	if utils.GetCurrentTime().After(apiToken.ExpiryDate) {
+		return nil, fmt.Errorf("bearer token expired")
+	}
+	return apiToken, nil
+}
+
+// issueAPITokenPair 產生對應 session 的 access / refresh token，只儲存雜湊值
+func issueAPITokenPair(session *model.Session) (*model.APITokenResponse, error) {
+	accessToken, err := utils.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	accessToken = apiAccessTokenPrefix + accessToken
+	refreshToken = apiRefreshTokenPrefix + refreshToken
+
+	currentTime := utils.GetCurrentTime()
+	accessExpiry := currentTime.Add(minutesOrDefault(cfg.APIToken.AccessTTL, 60))
+	refreshExpiry := currentTime.Add(hoursOrDefault(cfg.APIToken.RefreshTTL, 30*24))
+	// refresh token 不超過 session 的最長有效時間
+	if !session.AbsoluteExpiryDate.IsZero() && refreshExpiry.After(session.AbsoluteExpiryDate) {
+		refreshExpiry = session.AbsoluteExpiryDate
+	}
+
+	accessHash := hashAPIToken(accessToken)
+	if err := apiTokenDao.InsertToken(model.APIToken{
+		TokenHash:  accessHash,
+		Kind:       apiTokenKindAccess,
+		SessionID:  session.SessionID,
+		UserID:     session.UserID,
+		CreateDate: currentTime,
+		ExpiryDate: accessExpiry,
+		TTL:        accessExpiry.Unix(),
+	}); err != nil {
+		return nil, err
+	}
+	if err := apiTokenDao.InsertToken(model.APIToken{
+		TokenHash:  hashAPIToken(refreshToken),
+		Kind:       apiTokenKindRefresh,
+		SessionID:  session.SessionID,
+		UserID:     session.UserID,
+		PairHash:   accessHash,
+		CreateDate: currentTime,
+		ExpiryDate: refreshExpiry,
+		TTL:        refreshExpiry.Unix(),
+	}); err != nil {
+		return nil, err
+	}
+
+	logger.Info("API tokens issued", zap.String("userID", session.UserID))
+	return &model.APITokenResponse{
+		AccessToken:           accessToken,
+		TokenType:             "Bearer",
+		ExpiresIn:             int(accessExpiry.Sub(currentTime).Seconds()),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresIn: int(refreshExpiry.Sub(currentTime).Seconds()),
+	}, nil
+}
+
+// revokePairedToken 刪除 refresh token 對應的 access token
+func revokePairedToken(token *model.APIToken) {
+	if token.PairHash == "" {
+		return
+	}
+	if _, err := apiTokenDao.DeleteToken(token.PairHash); err != nil {
+		logger.Warn("Failed to revoke paired access token", zap.String("sessionID", token.SessionID), zap.Error(err))
+	}
+}
+
+// hashAPIToken token 只以 SHA-256 雜湊值儲存
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func minutesOrDefault(minutes, defaultMinutes int) time.Duration {
+	if minutes <= 0 {
+		minutes = defaultMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
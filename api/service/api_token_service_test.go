@@ -0,0 +1,160 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+)
+
+// fakeAPITokenDao 以記憶體保存 API token
+type fakeAPITokenDao struct {
+	mu     sync.Mutex
+	tokens map[string]model.APIToken
+}
+
+func (f *fakeAPITokenDao) InsertToken(token model.APIToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (f *fakeAPITokenDao) GetToken(tokenHash string) (*model.APIToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("no api token found")
+	}
+	return &token, nil
+}
+
+func (f *fakeAPITokenDao) DeleteToken(tokenHash string) (*model.APIToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	delete(f.tokens, tokenHash)
+	return &token, nil
+}
+
+// useAPITokenFakes 以 fake DAO 取代 sessionManager 與 apiTokenDao
+func useAPITokenFakes(t *testing.T, sessions *fakeSessionDao) *fakeAPITokenDao {
+	fake := &fakeAPITokenDao{tokens: map[string]model.APIToken{}}
+	originalManager, originalDao := sessionManager, apiTokenDao
+	sessionManager = NewSessionManager(sessions, testSessionPolicy(), zap.NewNop())
+	apiTokenDao = fake
+	t.Cleanup(func() {
+		sessionManager, apiTokenDao = originalManager, originalDao
+	})
+	return fake
+}
+
+func postRefreshAPITokens(refreshToken string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/tokens/refresh", RefreshAPITokens)
+
+	body, _ := json.Marshal(model.APITokenRequest{RefreshToken: refreshToken})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tokens/refresh", strings.NewReader(string(body))))
+	return w
+}
+
+func TestRefreshAPITokens(t *testing.T) {
+	now := time.Now()
+	session := testSession(now)
+
+	tests := []struct {
+		name string
+		// refreshToken 回傳要送出的 refresh token，可修改 DAO 中的資料
+		refreshToken func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string
+		wantStatus   int
+		// wantRevoked 已發出的 refresh token 與對應的 access token 是否失效
+		wantRevoked bool
+	}{
+		{"valid", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			return pair.RefreshToken
+		}, http.StatusOK, true},
+		{"reused", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			if w := postRefreshAPITokens(pair.RefreshToken); w.Code != http.StatusOK {
+				t.Fatalf("first refresh status = %d, body = %s", w.Code, w.Body.String())
+			}
+			return pair.RefreshToken
+		}, http.StatusUnauthorized, true},
+		{"access token", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			return pair.AccessToken
+		}, http.StatusBadRequest, false},
+		{"unknown", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			return apiRefreshTokenPrefix + "unknown"
+		}, http.StatusUnauthorized, false},
+		{"expired", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			hash := hashAPIToken(pair.RefreshToken)
+			token := tokens.tokens[hash]
+			token.ExpiryDate = now.Add(-time.Minute)
+			tokens.tokens[hash] = token
+			return pair.RefreshToken
+		}, http.StatusUnauthorized, false},
+		{"session deleted", func(t *testing.T, tokens *fakeAPITokenDao, pair *model.APITokenResponse) string {
+			if err := sessionManager.DeleteSession(session.SessionID); err != nil {
+				t.Fatalf("DeleteSession() error = %v", err)
+			}
+			return pair.RefreshToken
+		}, http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := useAPITokenFakes(t, newFakeSessionDao(session))
+			pair, err := issueAPITokenPair(&session)
+			if err != nil {
+				t.Fatalf("issueAPITokenPair() error = %v", err)
+			}
+
+			w := postRefreshAPITokens(tt.refreshToken(t, tokens, pair))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnauthorized && !strings.Contains(w.Body.String(), "reauth_required") {
+				t.Errorf("body = %s, want reauth_required", w.Body.String())
+			}
+
+			// refresh token 只能使用一次，使用後舊的 refresh token 與對應的 access token 都失效
+			if tt.wantRevoked {
+				if _, err := tokens.GetToken(hashAPIToken(pair.RefreshToken)); err == nil {
+					t.Error("refresh token still stored after use")
+				}
+				if _, err := resolveBearerToken(pair.AccessToken); err == nil {
+					t.Error("paired access token still valid after refresh")
+				}
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data model.APITokenResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("unmarshal response: %v", err)
+			}
+			apiToken, err := resolveBearerToken(response.Data.AccessToken)
+			if err != nil || apiToken.SessionID != session.SessionID {
+				t.Errorf("new access token = %+v, %v, want bound to %s", apiToken, err, session.SessionID)
+			}
+			if response.Data.RefreshToken == pair.RefreshToken || !strings.HasPrefix(response.Data.RefreshToken, apiRefreshTokenPrefix) {
+				t.Errorf("new refresh token = %q, want a rotated token", response.Data.RefreshToken)
+			}
+		})
+	}
+}
@@ -1,25 +1,55 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/identity"
 	"glt-calendar-service/api/model"
 	"glt-calendar-service/settings/env"
 	"glt-calendar-service/settings/log"
 	"glt-calendar-service/utils"
 	"go.uber.org/zap"
 	"net/http"
-	"time"
 )
 
 var (
 	cfg            = env.GetConfig()
 	respHandler    = utils.NewResponseHandler()
 	logger         = log.GetLogger()
-	sessionManager = NewSessionManager(dao.NewSessionDao(), logger)
+	sessionManager = NewSessionManager(dao.NewSessionDao(), NewSessionPolicy(cfg.SigningConfig), logger)
 	tokenManager   = NewTokenManager()
+	sessionTokens  = NewSessionTokenManager(cfg.SessionToken, dao.NewRevokedSessionTokenDao())
+	signInPolicy   = NewSignInPolicy(cfg.SigningConfig.Restriction)
+	// identityProviders Google 與 identity.providers 設定的 OpenID Connect 登入提供者
+	identityProviders = identity.NewRegistry(cfg.GoogleOAuth2, cfg.Identity)
 )
 
+// loginError 登入流程失敗，message 為回應給前端的錯誤訊息
+type loginError struct {
+	message    string
+	err        error
+	statusCode int    // 0 代表 500
+	code       string // 前端判斷用的錯誤代碼
+}
+
+func (e *loginError) Error() string {
+	return fmt.Sprintf("%s: %v", e.message, e.err)
+}
+
+func (e *loginError) Unwrap() error {
+	return e.err
+}
+
+// loginOptions 登入選項
+type loginOptions struct {
+	provider   identity.IdentityProvider
+	nonce      string // 授權請求時產生的 nonce，空字串代表不檢查
+	rememberMe bool
+}
+
 func GoogleLogin(context *gin.Context) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -27,54 +57,223 @@ func GoogleLogin(context *gin.Context) {
 		}
 	}()
 
-	tokenResponse, err := tokenManager.GetTokenResponse(context)
+	userInfo, ok := loginWithCode(context, identity.GoogleProviderName)
+	if !ok {
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, userInfo)
+}
+
+// ProviderLogin 以前端取得的 authorization code 登入指定的提供者（/:provider/login）
+func ProviderLogin(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in ProviderLogin", nil)
+		}
+	}()
+
+	userInfo, ok := loginWithCode(context, context.Param("provider"))
+	if !ok {
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, userInfo)
+}
+
+// ListIdentityProviders 列出可用的登入提供者，供前端顯示登入按鈕
+func ListIdentityProviders(context *gin.Context) {
+	providers := make([]gin.H, 0)
+	for _, provider := range identityProviders.List() {
+		providers = append(providers, gin.H{
+			"name":         provider.Name(),
+			"display_name": provider.DisplayName(),
+		})
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"providers": providers})
+}
+
+// loginWithCode 以請求中的 authorization code 完成提供者的登入，失敗時已回應錯誤並回傳 false
+func loginWithCode(context *gin.Context, providerName string) (*model.GoogleUserInfo, bool) {
+	provider, ok := identityProviders.Get(providerName)
+	if !ok {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Identity provider not found"}, "Unknown identity provider: "+providerName, nil)
+		return nil, false
+	}
+
+	tokenResponse, err := tokenManager.GetTokenResponse(context, provider)
 	if err != nil {
+		if errors.Is(err, ErrRedirectURINotAllowed) {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Redirect URI is not allowed"}, "", err)
+			return nil, false
+		}
 		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get token"}, "", err)
-		return
+		return nil, false
+	}
+
+	// GetTokenResponse 已讀取 body，這裡使用快取的 body
+	var req model.GoogleTokenRequest
+	_ = context.ShouldBindBodyWith(&req, binding.JSON)
+
+	userInfo, err := completeLogin(context, tokenResponse, loginOptions{provider: provider, rememberMe: req.RememberMe})
+	if err != nil {
+		var loginErr *loginError
+		if errors.As(err, &loginErr) && loginErr.statusCode != 0 {
+			respHandler.FailContextCodeMessage(context, loginErr.statusCode, gin.H{"error": loginErr.message, "code": loginErr.code}, "", loginErr.err)
+			return nil, false
+		}
+		if errors.As(err, &loginErr) {
+			respHandler.FailContextMessage(context, gin.H{"error": loginErr.message}, "", loginErr.err)
+			return nil, false
+		}
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign in"}, "", err)
+		return nil, false
 	}
+	return userInfo, true
+}
 
-	// 使用訪問令牌獲取用戶信息
-	userInfo, err := GetGoogleUserInfo(tokenResponse.AccessToken)
+// completeLogin 以 token 取得使用者資訊，建立或更新 session 並設定 cookie
+func completeLogin(context *gin.Context, tokenResponse *model.GoogleTokenResponse, options loginOptions) (*model.GoogleUserInfo, error) {
+	userInfo, err := resolveUserInfo(context, options.provider, tokenResponse, options.nonce)
 	if err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get user information"}, "", err)
-		return
+		return nil, err
+	}
+
+	// 限制可登入的帳號，拒絕時留下稽核紀錄
+	if reason := signInPolicy.Check(options.provider.Name(), userInfo); reason != "" {
+		logger.Warn("Sign-in rejected",
+			zap.String("audit", "signin_rejected"),
+			zap.String("reason", reason),
+			zap.String("provider", options.provider.Name()),
+			zap.String("userID", userInfo.ID),
+			zap.String("email", userInfo.Email),
+			zap.String("hostedDomain", userInfo.HostedDomain),
+			zap.Bool("verifiedEmail", userInfo.VerifiedEmail),
+			zap.String("ip", context.ClientIP()),
+		)
+		return nil, &loginError{
+			message:    "This account is not allowed to sign in",
+			err:        fmt.Errorf("sign-in rejected: %s", reason),
+			statusCode: http.StatusForbidden,
+			code:       reason,
+		}
+	}
+
+	// 同步使用者資料，失敗時不影響登入
+	if _, err := upsertUser(userInfo); err != nil {
+		logger.Error("Failed to upsert user", zap.String("userID", userInfo.ID), zap.Error(err))
 	}
 
 	// 在保存數據中添加令牌創建時間
 	sessionData := model.SessionData{
 		TokenResponse: tokenResponse,
 		UserInfo:      userInfo,
+		Scopes:        model.ParseScopes(tokenResponse.Scope),
 	}
 
-	var sessionId string
-
 	session, _ := sessionManager.GetContextOrSession(context)
-	if session != nil && session.Data != nil && session.Data.TokenResponse != nil {
-		err = sessionManager.UpdateSession(session)
-		if err != nil {
-			respHandler.FailContextMessage(context, gin.H{"error": "Failed to update session"}, "", err)
-			return
+	if session != nil && session.Data != nil && session.Data.TokenResponse != nil && session.UserID == userInfo.ID && sessionProvider(session) == options.provider.Name() {
+		// 同一使用者以同一提供者重新授權（incremental consent）：更新 token 並合併已授權 scope
+		if tokenResponse.RefreshToken == "" {
+			tokenResponse.RefreshToken = session.Data.TokenResponse.RefreshToken
+		}
+		setGrantedScopes(session, model.MergeScopes(session.GrantedScopes(), sessionData.Scopes))
+		session.Data.TokenResponse = tokenResponse
+		session.Data.UserInfo = userInfo
+
+		// 重新登入時延長效期，改為記住我時重新計算最長有效時間
+		sessionManager.policy.Renew(session, options.rememberMe, utils.GetCurrentTime())
+
+		if err := sessionManager.UpdateSession(session); err != nil {
+			return nil, &loginError{message: "Failed to update session", err: err}
 		}
-		sessionId = session.SessionID
 	} else {
-		sessionId, err = sessionManager.SaveSession(userInfo.ID, &sessionData, 24*time.Hour)
+		session, err = sessionManager.SaveSession(userInfo.ID, options.provider.Name(), &sessionData, DeviceFromContext(context), options.rememberMe)
 		if err != nil {
-			respHandler.FailContextMessage(context, gin.H{"error": "Failed to save session"}, "", err)
-			return
+			return nil, &loginError{message: "Failed to save session", err: err}
 		}
 	}
 
-	sessionManager.SetCookie(context, &model.Cookie{
-		Name:     "session_id",
-		Value:    sessionId,
-		MaxAge:   24 * 60 * 60,
-		Path:     "/",
-		Domain:   "",
-		Secure:   false,
-		HttpOnly: true,
-	})
+	sessionManager.SetSessionCookie(context, session)
+	EnsureCSRFToken(context, session)
+	sessionTokens.Issue(context, session)
+	context.Set("session", session)
 
-	respHandler.SuccessContextMessage(context, userInfo)
+	return userInfo, nil
+}
+
+// resolveUserInfo 優先使用已驗證的 ID token claims，claims 不足時才呼叫提供者的 userinfo 端點
+// Google 以外的提供者使用者 ID 加上提供者名稱前綴（provider|sub），避免與 Google 帳號衝突
+func resolveUserInfo(context *gin.Context, provider identity.IdentityProvider, tokenResponse *model.GoogleTokenResponse, nonce string) (*model.GoogleUserInfo, error) {
+	userInfo, err := providerUserInfo(context, provider, tokenResponse, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Name() != identity.GoogleProviderName {
+		userInfo.ID = provider.Name() + "|" + userInfo.ID
+		// 提供者未回傳 email_verified 時依設定信任 email
+		if userInfo.Email != "" && !userInfo.VerifiedEmail && provider.TrustEmail() {
+			userInfo.VerifiedEmail = true
+			userInfo.TrustedEmail = true
+		}
+	}
+	return userInfo, nil
+}
+
+func providerUserInfo(context *gin.Context, provider identity.IdentityProvider, tokenResponse *model.GoogleTokenResponse, nonce string) (*model.GoogleUserInfo, error) {
+	ctx := context.Request.Context()
+	if tokenResponse.IdToken == "" {
+		// 使用訪問令牌獲取用戶信息
+		userInfo, err := provider.UserInfo(ctx, tokenResponse.AccessToken)
+		if err != nil {
+			return nil, &loginError{message: "Failed to get user information", err: err}
+		}
+		return userInfo, nil
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, tokenResponse.IdToken, nonce)
+	if err != nil {
+		return nil, &loginError{message: "Invalid ID token", err: err}
+	}
+
+	// 未請求 profile scope 時 claims 沒有姓名，改由 userinfo 端點補齊
+	if claims.Email == "" || claims.Name == "" {
+		userInfo, err := provider.UserInfo(ctx, tokenResponse.AccessToken)
+		if err != nil {
+			return nil, &loginError{message: "Failed to get user information", err: err}
+		}
+		if userInfo.ID != claims.Subject {
+			return nil, &loginError{message: "Invalid ID token", err: fmt.Errorf("id token subject does not match userinfo")}
+		}
+		if userInfo.HostedDomain == "" {
+			userInfo.HostedDomain = claims.HostedDomain
+		}
+		if !userInfo.VerifiedEmail && userInfo.Email == claims.Email {
+			userInfo.VerifiedEmail = bool(claims.EmailVerified)
+		}
+		return userInfo, nil
+	}
+
+	return &model.GoogleUserInfo{
+		ID:            claims.Subject,
+		Email:         claims.Email,
+		VerifiedEmail: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Picture:       claims.Picture,
+		Locale:        claims.Locale,
+		HostedDomain:  claims.HostedDomain,
+	}, nil
+}
+
+// sessionProvider session 的登入提供者，舊 session 沒有 provider 時為 Google
+func sessionProvider(session *model.Session) string {
+	if session.Provider == "" {
+		return identity.GoogleProviderName
+	}
+	return session.Provider
 }
 
 // GoogleSignOut SignOut handles user logout by removing the session
@@ -102,15 +301,7 @@ func GoogleSignOut(context *gin.Context) {
 	}
 
 	// delete cookie
-	sessionManager.SetCookie(context, &model.Cookie{
-		Name:     "session_id",
-		Value:    "",
-		MaxAge:   -1,
-		Path:     "/",
-		Domain:   "",
-		Secure:   false,
-		HttpOnly: true,
-	})
+	clearSessionCookie(context)
 
 	respHandler.SuccessContextMessage(context, gin.H{"message": "Successfully signed out"})
 }
@@ -122,13 +313,30 @@ func ValidateSession(context *gin.Context) {
 		}
 	}()
 
-	// 1. Check if a cookie exists
-	sessionID, err := context.Cookie("session_id")
-	if err != nil {
-		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "No session cookie found", err)
+	// Personal access token 只能使用路由宣告 scope 的 API
+	if handled, _ := ResolvePersonalAccessToken(context); handled {
 		return
 	}
 
+	// 1. Check if a bearer token or cookie exists
+	bearer := BearerToken(context) != ""
+	if !bearer {
+		if _, err := context.Cookie("session_id"); err != nil {
+			respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "No session cookie found", err)
+			return
+		}
+	}
+
+	// 無狀態模式：session token 有效時不讀取 DynamoDB，也不延長效期（換發時才延長）
+	if !bearer {
+		if session, err := sessionTokens.SessionFromRequest(context); err == nil && !session.IsSessionExpired() {
+			context.Set("session", session)
+			setPrincipal(context, session)
+			EnsureCSRFToken(context, session)
+			return
+		}
+	}
+
 	// 2. Get session from DynamoDB
 	session, err := sessionManager.GetContextOrSession(context)
 	if err != nil {
@@ -139,12 +347,12 @@ func ValidateSession(context *gin.Context) {
 	// 3. Check if the session is expired
 	if session.IsSessionExpired() {
 		logger.Info("Session expired",
-			zap.String("sessionId", sessionID),
+			zap.String("sessionId", session.SessionID),
 			zap.Time("expiryDate", session.ExpiryDate),
 		)
 
 		// Delete an expired session
-		err := sessionManager.DeleteSession(sessionID)
+		err := sessionManager.DeleteSession(session.SessionID)
 		if err != nil {
 			logger.Error("Failed to delete expired session", zap.Error(err))
 			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Failed to delete expired session", err)
@@ -152,26 +360,175 @@ func ValidateSession(context *gin.Context) {
 		}
 
 		// delete cookie
-		sessionManager.SetCookie(context, &model.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			MaxAge:   -1,
-			Path:     "/",
-			Domain:   "",
-			Secure:   false,
-			HttpOnly: true,
-		})
+		if !bearer {
+			clearSessionCookie(context)
+		}
 
 		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Session expired, please login again"}, "", nil)
 		return
 	}
 
-	// 4. update session expire
-	if err := sessionManager.UpdateSession(session); err != nil {
+	// 4. sliding expiry: only write to DynamoDB when past the refresh threshold
+	session.IPAddress = context.ClientIP()
+	extended, err := sessionManager.ExtendSession(session)
+	if err != nil {
 		logger.Error("Failed to update session", zap.Error(err))
 		respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Failed to update session", err)
+		return
+	}
+	if extended && session.RememberMe && !bearer {
+		// 持久 cookie 需同步延長
+		sessionManager.SetSessionCookie(context, session)
 	}
 
-	// 5. Store session information in context for later use
+	// 5. Store session information and the principal in context for later use
 	context.Set("session", session)
+	setPrincipal(context, session)
+
+	// 6. Issue the CSRF token for cookie-authenticated state-changing requests
+	if !bearer {
+		EnsureCSRFToken(context, session)
+		// 7. Re-issue the session token after checking DynamoDB
+		sessionTokens.Issue(context, session)
+	}
+}
+
+// ListSessions lists the signed-in devices of the current user
+func ListSessions(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	sessions, err := sessionManager.ListUserSessions(session.UserID, session.SessionID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list sessions"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs out one of the current user's sessions by its handle
+func RevokeSession(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	target, err := sessionManager.FindUserSession(session.UserID, context.Param("id"))
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Session not found"}, "", err)
+		return
+	}
+
+	if err := sessionManager.DeleteSession(target.SessionID); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to revoke session"}, "", err)
+		return
+	}
+
+	// 撤銷目前的 session 時同時刪除 cookie
+	if target.SessionID == session.SessionID {
+		clearSessionCookie(context)
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Session revoked"})
+}
+
+// SignOutEverywhere deletes all sessions of the current user
+// Query keepCurrent=true keeps the current session signed in
+func SignOutEverywhere(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	keepSessionID := ""
+	keepCurrent := context.DefaultQuery("keepCurrent", "false") == "true"
+	if keepCurrent {
+		keepSessionID = session.SessionID
+	}
+
+	deleted, err := sessionManager.DeleteUserSessions(session.UserID, keepSessionID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign out everywhere"}, "", err)
+		return
+	}
+
+	// GSI 為最終一致性，確保目前的 session 一定被刪除
+	if !keepCurrent {
+		if err := sessionManager.DeleteSession(session.SessionID); err != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign out everywhere"}, "", err)
+			return
+		}
+		clearSessionCookie(context)
+	}
+
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Signed out everywhere", "revoked": deleted})
+}
+
+// RevokeGoogleAccess 向 session 的登入提供者撤銷授權並登出
+// 撤銷 refresh token 會使該使用者所有 session 的 token 失效，因此一併刪除所有 session
+func RevokeGoogleAccess(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in RevokeGoogleAccess", nil)
+		}
+	}()
+
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		// No session, considered already signed out
+		clearSessionCookie(context)
+		respHandler.SuccessContextMessage(context, gin.H{"message": "Already signed out", "revoked": false})
+		return
+	}
+
+	revoked := false
+	if session.Data != nil && session.Data.TokenResponse != nil {
+		token := session.Data.TokenResponse.RefreshToken
+		if token == "" {
+			token = session.Data.TokenResponse.AccessToken
+		}
+		provider, ok := identityProviders.Get(session.Provider)
+		if !ok {
+			logger.Error("Identity provider is not enabled", zap.String("provider", session.Provider))
+		} else if err := tokenManager.revokeToken(provider, token); err != nil {
+			// 撤銷失敗仍完成本地登出
+			logger.Error("Failed to revoke token", zap.String("provider", provider.Name()), zap.String("userID", session.UserID), zap.Error(err))
+		} else {
+			revoked = true
+		}
+	}
+
+	if _, err := sessionManager.DeleteUserSessions(session.UserID, session.SessionID); err != nil {
+		logger.Error("Failed to delete user sessions", zap.String("userID", session.UserID), zap.Error(err))
+	}
+	revokeUserPersonalAccessTokens(session.UserID)
+	revokeNotifications(session.UserID)
+	if err := sessionManager.DeleteSession(session.SessionID); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to sign out"}, "", err)
+		return
+	}
+	clearSessionCookie(context)
+
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Successfully signed out", "revoked": revoked})
+}
+
+// clearSessionCookie 刪除 session 與 CSRF cookie
+func clearSessionCookie(context *gin.Context) {
+	for _, name := range []string{"session_id", sessionTokenCookie, csrfCookie} {
+		sessionManager.SetCookie(context, &model.Cookie{
+			Name:     name,
+			Value:    "",
+			MaxAge:   -1,
+			Path:     "/",
+			Domain:   "",
+			Secure:   false,
+			HttpOnly: name != csrfCookie,
+		})
+	}
 }
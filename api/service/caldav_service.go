@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/calendar"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+)
+
+var calDAVAccountDao dao.CalDAVAccountDaoInterface = dao.NewCalDAVAccountDao()
+
+// GetCalDAVAccount returns the linked CalDAV account of the current user without the password
+func GetCalDAVAccount(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	account, err := calDAVAccountDao.GetAccount(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get CalDAV account"}, "", err)
+		return
+	}
+	if account == nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "CalDAV account not linked"}, "", nil)
+		return
+	}
+	respHandler.SuccessContextMessage(context, account)
+}
+
+// ConnectCalDAV 以 PROPFIND 驗證帳密並找出行事曆後，加密儲存帳號（重新連結時覆寫）
+func ConnectCalDAV(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	var req model.CalDAVAccountRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "serverUrl, username and password are required"}, "", err)
+		return
+	}
+	if serverURL, err := url.Parse(req.ServerURL); err != nil || (serverURL.Scheme != "https" && !(cfg.Calendar.CalDAVAllowHTTP && serverURL.Scheme == "http")) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "CalDAV server must use https"}, "Invalid CalDAV server url: "+req.ServerURL, err)
+		return
+	}
+
+	provider, err := calendar.NewCalDAVProvider(req.ServerURL, req.Username, req.Password, "", cfg.Calendar.CalDAVAllowPrivateNetworks)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid CalDAV server url"}, "", err)
+		return
+	}
+
+	calendars, err := provider.Discover(context.Request.Context())
+	if err != nil {
+		var apiErr *calendar.APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "CalDAV server rejected the credentials", "code": "caldav_auth_failed"}, "", err)
+			return
+		}
+		if errors.Is(err, calendar.ErrPrivateAddress) {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "CalDAV server must be a public address", "code": "caldav_server_not_allowed"}, "", err)
+			return
+		}
+		respHandler.FailContextCodeMessage(context, http.StatusBadGateway, gin.H{"error": "Failed to discover CalDAV calendars", "code": "caldav_discovery_failed"}, "", err)
+		return
+	}
+
+	// 預設行事曆需為找到的行事曆之一，未指定時使用第一個
+	primary := calendars[0].Href
+	for _, found := range calendars {
+		if req.PrimaryCalendar != "" && (found.Href == req.PrimaryCalendar || found.DisplayName == req.PrimaryCalendar) {
+			primary = found.Href
+		}
+	}
+
+	currentTime := utils.GetCurrentTime()
+	account := model.CalDAVAccount{
+		UserID:          session.UserID,
+		ServerURL:       req.ServerURL,
+		Username:        req.Username,
+		Password:        req.Password,
+		PrimaryCalendar: primary,
+		Calendars:       calendars,
+		CreateDate:      currentTime,
+		UpdateDate:      currentTime,
+	}
+	if existing, err := calDAVAccountDao.GetAccount(session.UserID); err == nil && existing != nil {
+		account.CreateDate = existing.CreateDate
+	}
+
+	if err := calDAVAccountDao.SaveAccount(account); err != nil {
+		if errors.Is(err, dao.ErrEncryptionDisabled) {
+			respHandler.FailContextCodeMessage(context, http.StatusServiceUnavailable, gin.H{"error": "CalDAV accounts require encryption to be configured"}, "", err)
+			return
+		}
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to save CalDAV account"}, "", err)
+		return
+	}
+
+	logger.Info("CalDAV account linked", zap.String("userID", session.UserID), zap.Int("calendars", len(calendars)))
+	respHandler.SuccessContextMessage(context, account)
+}
+
+// DisconnectCalDAV removes the linked CalDAV account of the current user
+func DisconnectCalDAV(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	if err := calDAVAccountDao.DeleteAccount(session.UserID); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to remove CalDAV account"}, "", err)
+		return
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"message": "CalDAV account removed"})
+}
+
+// calDAVProviderFor 使用者已連結的 CalDAV 帳號，尚未連結時回傳 nil
+func calDAVProviderFor(userID string) (*calendar.CalDAVProvider, error) {
+	account, err := calDAVAccountDao.GetAccount(userID)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	return calendar.NewCalDAVProvider(account.ServerURL, account.Username, account.Password, account.PrimaryCalendar, cfg.Calendar.CalDAVAllowPrivateNetworks)
+}
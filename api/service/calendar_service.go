@@ -1,17 +1,58 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/calendar"
 	"glt-calendar-service/api/model"
-	"glt-calendar-service/utils"
-	"io"
+	"go.uber.org/zap"
 	"net/http"
-	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// calendarProviders 行事曆後端，key 為 session 的登入提供者
+var calendarProviders = map[string]calendar.CalendarProvider{
+	calendar.GoogleProviderName:    calendar.NewGoogleProvider(cfg.Calendar.GoogleEndpoint),
+	calendar.MicrosoftProviderName: calendar.NewGraphProvider(cfg.Calendar.MicrosoftEndpoint),
+}
+
+// calendarProviderFor 依 session 登入的帳號選擇行事曆後端
+func calendarProviderFor(session *model.Session) (calendar.CalendarProvider, bool) {
+	provider, ok := calendarProviders[sessionProvider(session)]
+	return provider, ok
+}
+
+// allAccounts accountId=all 合併登入帳號與所有連結帳號的事件（只支援查詢）
+const allAccounts = "all"
+
+// calendarTarget 行事曆請求使用的帳號、後端與 access token（CalDAV 為空字串）
+type calendarTarget struct {
+	provider     calendar.CalendarProvider
+	accessToken  string
+	accountID    string
+	accountEmail string
+}
+
+var (
+	// errCalendarNotSupported 登入提供者沒有行事曆且未連結 CalDAV 帳號
+	errCalendarNotSupported = errors.New("calendar is not available for this account")
+	// errCalDAVAccount 讀取 CalDAV 帳號失敗
+	errCalDAVAccount = errors.New("failed to get CalDAV account")
+)
+
+// tag 標記事件所屬的帳號
+func (t *calendarTarget) tag(event *model.CalendarEvent) {
+	event.AccountID = t.accountID
+	event.AccountEmail = t.accountEmail
+}
+
+// GetCalendarEvents 查詢 accountId（預設登入帳號）的事件，accountId=all 時合併所有帳號
 func GetCalendarEvents(context *gin.Context) {
 	// TODO: 驗證月曆邏輯
 	defer func() {
@@ -20,98 +61,315 @@ func GetCalendarEvents(context *gin.Context) {
 		}
 	}()
 
-	// 獲取訪問令牌
-	accessToken, err := tokenManager.GetAccessToken(context)
-	if err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get access token"}, "", err)
+	// 獲取請求參數
+	query := calendar.DefaultListQuery(time.Now())
+	query.TimeMin = context.DefaultQuery("timeMin", query.TimeMin)
+	query.TimeMax = context.DefaultQuery("timeMax", query.TimeMax)
+	query.OrderBy = context.DefaultQuery("orderBy", query.OrderBy)
+	if maxResults, err := strconv.Atoi(context.DefaultQuery("maxResults", "100")); err == nil && maxResults > 0 {
+		query.MaxResults = maxResults
+	}
+	query.SingleEvents = context.DefaultQuery("singleEvents", "true") == "true"
+	calendarId := context.DefaultQuery("calendarId", calendar.PrimaryCalendarID)
+
+	if context.Query("accountId") == allAccounts {
+		listAllAccountEvents(context, calendarId, query)
 		return
 	}
 
-	// 獲取請求參數
-	timeMin := context.DefaultQuery("timeMin", time.Now().Format(time.RFC3339))
-	timeMax := context.DefaultQuery("timeMax", time.Now().AddDate(0, 1, 0).Format(time.RFC3339))
-	maxResults := context.DefaultQuery("maxResults", "100")
-	singleEvents := context.DefaultQuery("singleEvents", "true")
-	orderBy := context.DefaultQuery("orderBy", "startTime")
-	calendarId := context.DefaultQuery("calendarId", "primary")
-
-	// 構建 Google Calendar API URL
-	baseURL := "https://www.googleapis.com/calendar/v3/calendars"
-	apiURL := fmt.Sprintf("%s/%s/events", baseURL, url.PathEscape(calendarId))
-
-	// 添加查詢參數
-	q := url.Values{}
-	q.Add("timeMin", timeMin)
-	q.Add("timeMax", timeMax)
-	q.Add("maxResults", maxResults)
-	q.Add("singleEvents", singleEvents)
-	q.Add("orderBy", orderBy)
-
-	fullURL := apiURL + "?" + q.Encode()
-
-	// 創建請求
-	req, err := http.NewRequest("GET", fullURL, nil)
+	target, ok := calendarAccess(context)
+	if !ok {
+		return
+	}
+
+	calendarData, err := target.provider.ListEvents(context.Request.Context(), target.accessToken, calendarId, query)
 	if err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to create request"}, "", err)
+		respondCalendarError(context, "Failed to fetch calendar data", err)
 		return
 	}
+	for i := range calendarData.Items {
+		target.tag(&calendarData.Items[i])
+	}
 
-	// 添加認證頭
-	req.Header.Add("Authorization", "Bearer "+accessToken)
+	// 返回日曆數據
+	respHandler.SuccessContextMessage(context, gin.H{
+		"events":    calendarData.Items,
+		"timeZone":  calendarData.TimeZone,
+		"summary":   calendarData.Summary,
+		"provider":  target.provider.Name(),
+		"accountId": target.accountID,
+	})
+}
 
-	// 發送請求
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// listAllAccountEvents 並行查詢所有帳號並依開始時間合併，單一帳號失敗只列在 accounts 中
+// calendarId 除 primary 外通常只屬於單一帳號，其他帳號找不到時同樣列為失敗
+func listAllAccountEvents(context *gin.Context, calendarId string, query calendar.ListQuery) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid session"}, "Failed to get session", err)
+		return
 	}
-	resp, err := client.Do(req)
+
+	linked, err := linkedAccountDao.GetAccountsByUserID(session.UserID)
 	if err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to fetch calendar data"}, "", err)
-		return
-	}
-	defer utils.CloseResponseBody(resp, "GetCalendar")
-
-	// 處理響應（沒有額外的令牌處理，因為我們已經提前檢查並刷新了令牌）
-	if resp.StatusCode != http.StatusOK {
-		// 處理錯誤
-		body, _ := io.ReadAll(resp.Body)
-		var errorResponse map[string]interface{}
-		if err := json.Unmarshal(body, &errorResponse); err != nil {
-			respHandler.FailContextMessage(
-				context,
-				gin.H{"error": "Failed to parse error response"},
-				fmt.Sprintf("Failed to parse error response => body: %s, err: %v", string(body), err),
-				err,
-			)
-			return
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list accounts"}, "", err)
+		return
+	}
+	slices.SortFunc(linked, func(a, b model.LinkedAccount) int {
+		return a.CreateDate.Compare(b.CreateDate)
+	})
+
+	// 取得 token 可能更新 session，依序進行；查詢事件並行
+	type accountResult struct {
+		AccountID string `json:"accountId"`
+		Email     string `json:"email"`
+		Provider  string `json:"provider,omitempty"`
+		Count     int    `json:"count"`
+		Error     string `json:"error,omitempty"`
+	}
+	primary := primaryAccountSummary(session)
+	results := []accountResult{{AccountID: primary.AccountID, Email: primary.Email}}
+	targets := []*calendarTarget{nil}
+	// scope 未記錄（舊 session）或 CalDAV 時不檢查，與 RequireScopes 相同
+	granted := session.GrantedScopes()
+	if missing := missingFeatureScopes(featureScopesFor(sessionProvider(session)), granted, "calendar.read"); len(granted) > 0 && len(missing) > 0 && context.Query("provider") != calendar.CalDAVProviderName {
+		results[0].Error = "missing OAuth scopes: " + strings.Join(missing, " ")
+	} else if target, err := sessionCalendarTarget(context, session); err != nil {
+		results[0].Error = err.Error()
+	} else {
+		targets[0] = target
+	}
+	for i := range linked {
+		result := accountResult{AccountID: linked[i].AccountID, Email: linked[i].Email}
+		var target *calendarTarget
+		if missing := missingFeatureScopes(featureScopes, linked[i].Scopes, "calendar.read"); len(missing) > 0 {
+			result.Error = "missing OAuth scopes: " + strings.Join(missing, " ")
+		} else if target, err = linkedCalendarTarget(context.Request.Context(), &linked[i]); err != nil {
+			result.Error = err.Error()
 		}
+		results = append(results, result)
+		targets = append(targets, target)
+	}
 
-		respHandler.FailContextMessage(
-			context,
-			gin.H{"error": "Failed to fetch calendar data", "details": errorResponse},
-			fmt.Sprintf("statusCode : %v ", resp.StatusCode),
-			fmt.Errorf("response : %v ", errorResponse),
-		)
+	itemsByAccount := make([][]model.CalendarEvent, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		if target == nil {
+			continue
+		}
+		results[i].Provider = target.provider.Name()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			calendarData, err := target.provider.ListEvents(context.Request.Context(), target.accessToken, calendarId, query)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			for j := range calendarData.Items {
+				target.tag(&calendarData.Items[j])
+			}
+			itemsByAccount[i] = calendarData.Items
+		}()
+	}
+	wg.Wait()
+
+	events := make([]model.CalendarEvent, 0)
+	failed := 0
+	for i, items := range itemsByAccount {
+		results[i].Count = len(items)
+		if results[i].Error != "" {
+			failed++
+			logger.Warn("Failed to fetch calendar of account", zap.String("userID", session.UserID), zap.String("accountID", results[i].AccountID), zap.String("error", results[i].Error))
+		}
+		events = append(events, items...)
+	}
+	if failed == len(results) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadGateway, gin.H{"error": "Failed to fetch calendar data", "accounts": results}, "", nil)
+		return
+	}
+
+	calendar.SortEvents(events)
+	if query.MaxResults > 0 && len(events) > query.MaxResults {
+		events = events[:query.MaxResults]
+	}
+	respHandler.SuccessContextMessage(context, gin.H{
+		"events":   events,
+		"accounts": results,
+	})
+}
+
+// CreateCalendarEvent 在 accountId（預設登入帳號）的 calendarId（預設 primary）建立事件
+func CreateCalendarEvent(context *gin.Context) {
+	var event model.CalendarEvent
+	if err := context.ShouldBindJSON(&event); err != nil || event.Summary == "" {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "summary, start and end are required"}, "", err)
+		return
+	}
+	if event.Start == (model.EventTime{}) || event.End == (model.EventTime{}) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "summary, start and end are required"}, "", nil)
+		return
+	}
+
+	target, ok := calendarAccess(context)
+	if !ok {
 		return
 	}
 
-	// 讀取響應
-	body, err := io.ReadAll(resp.Body)
+	created, err := target.provider.CreateEvent(context.Request.Context(), target.accessToken, context.DefaultQuery("calendarId", calendar.PrimaryCalendarID), event)
 	if err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to read response"}, "", fmt.Errorf("failed to read response body : %w", err))
+		respondCalendarError(context, "Failed to create event", err)
 		return
 	}
+	target.tag(created)
+	respHandler.SuccessContextMessage(context, gin.H{"event": created, "provider": target.provider.Name(), "accountId": target.accountID})
+}
 
-	// 解析日曆數據
-	var calendarData model.CalendarResponse
-	if err := json.Unmarshal(body, &calendarData); err != nil {
-		respHandler.FailContextMessage(context, gin.H{"error": "Failed to parse calendar data"}, "", fmt.Errorf("failed to parse calendar data : %w", err))
+// UpdateCalendarEvent 更新事件，只更新 body 中有值的欄位
+func UpdateCalendarEvent(context *gin.Context) {
+	var event model.CalendarEvent
+	if err := context.ShouldBindJSON(&event); err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid event"}, "", err)
 		return
 	}
 
-	// 返回日曆數據
-	respHandler.SuccessContextMessage(context, gin.H{
-		"events":   calendarData.Items,
-		"timeZone": calendarData.TimeZone,
-		"summary":  calendarData.Summary,
-	})
+	target, ok := calendarAccess(context)
+	if !ok {
+		return
+	}
+
+	updated, err := target.provider.UpdateEvent(context.Request.Context(), target.accessToken, context.DefaultQuery("calendarId", calendar.PrimaryCalendarID), context.Param("id"), event)
+	if err != nil {
+		respondCalendarError(context, "Failed to update event", err)
+		return
+	}
+	target.tag(updated)
+	respHandler.SuccessContextMessage(context, gin.H{"event": updated, "provider": target.provider.Name(), "accountId": target.accountID})
+}
+
+// DeleteCalendarEvent 刪除 calendarId（預設 primary）中的事件
+func DeleteCalendarEvent(context *gin.Context) {
+	target, ok := calendarAccess(context)
+	if !ok {
+		return
+	}
+
+	if err := target.provider.DeleteEvent(context.Request.Context(), target.accessToken, context.DefaultQuery("calendarId", calendar.PrimaryCalendarID), context.Param("id")); err != nil {
+		respondCalendarError(context, "Failed to delete event", err)
+		return
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Event deleted", "provider": target.provider.Name(), "accountId": target.accountID})
+}
+
+// calendarAccess 取得 accountId（預設登入帳號）的行事曆後端與有效的 access token，失敗時已回應錯誤
+// ?provider=caldav 或登入提供者沒有行事曆時使用已連結的 CalDAV 帳號，不需要 access token
+func calendarAccess(context *gin.Context) (*calendarTarget, bool) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid session"}, "Failed to get session", err)
+		return nil, false
+	}
+
+	accountID := context.Query("accountId")
+	if accountID == allAccounts {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "accountId=all is only supported when listing events"}, "", nil)
+		return nil, false
+	}
+	if accountID != "" && accountID != session.UserID {
+		account, err := linkedAccountDao.GetAccount(session.UserID, accountID)
+		if err != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Failed to get linked account"}, "", err)
+			return nil, false
+		}
+		if account == nil {
+			respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Linked account not found"}, "", errLinkedAccountNotFound)
+			return nil, false
+		}
+		// scope 已由 RequireScopes 檢查
+		target, err := linkedCalendarTarget(context.Request.Context(), account)
+		if err != nil {
+			respondLinkedAccountTokenError(context, account, err)
+			return nil, false
+		}
+		return target, true
+	}
+
+	target, err := sessionCalendarTarget(context, session)
+	switch {
+	case err == nil:
+		return target, true
+	case errors.Is(err, errCalendarNotSupported):
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{
+			"error": "Calendar is not available for this account",
+			"code":  "calendar_not_supported",
+		}, "No calendar provider for "+sessionProvider(session), nil)
+	case errors.Is(err, errCalDAVAccount):
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get CalDAV account"}, "", err)
+	default:
+		RespondAccessTokenError(context, err)
+	}
+	return nil, false
+}
+
+// sessionCalendarTarget 登入帳號的行事曆，登入提供者沒有行事曆或 ?provider=caldav 時使用 CalDAV 帳號
+func sessionCalendarTarget(context *gin.Context, session *model.Session) (*calendarTarget, error) {
+	target := &calendarTarget{accountID: session.UserID}
+	if session.Data != nil && session.Data.UserInfo != nil {
+		target.accountEmail = session.Data.UserInfo.Email
+	}
+
+	provider, ok := calendarProviderFor(session)
+	if !ok || context.Query("provider") == calendar.CalDAVProviderName {
+		calDAV, err := calDAVProviderFor(session.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errCalDAVAccount, err)
+		}
+		if calDAV == nil {
+			return nil, errCalendarNotSupported
+		}
+		target.provider = calDAV
+		return target, nil
+	}
+
+	// 獲取訪問令牌
+	accessToken, err := tokenManager.GetAccessToken(context)
+	if err != nil {
+		return nil, err
+	}
+	target.provider = provider
+	target.accessToken = accessToken
+	return target, nil
+}
+
+// linkedCalendarTarget 連結帳號的 Google 行事曆
+func linkedCalendarTarget(ctx context.Context, account *model.LinkedAccount) (*calendarTarget, error) {
+	accessToken, err := linkedAccountToken(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	return &calendarTarget{
+		provider:     calendarProviders[calendar.GoogleProviderName],
+		accessToken:  accessToken,
+		accountID:    account.AccountID,
+		accountEmail: account.Email,
+	}, nil
+}
+
+// respondCalendarError 行事曆 API 的 400、404 直接回應，其他錯誤回應 500
+func respondCalendarError(context *gin.Context, message string, err error) {
+	var apiErr *calendar.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusNotFound {
+			respHandler.FailContextCodeMessage(context, apiErr.StatusCode, gin.H{"error": message, "details": apiErr.Details}, "", apiErr)
+			return
+		}
+		respHandler.FailContextMessage(
+			context,
+			gin.H{"error": message, "details": apiErr.Details},
+			fmt.Sprintf("statusCode : %v ", apiErr.StatusCode),
+			fmt.Errorf("response : %v ", apiErr.Details),
+		)
+		return
+	}
+	respHandler.FailContextMessage(context, gin.H{"error": message}, "", err)
 }
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// useCSRFFakes 以 fake DAO 取代 sessionManager 並設定不檢查 CSRF 的路由
+func useCSRFFakes(t *testing.T, sessions *fakeSessionDao, exemptPaths ...string) {
+	originalManager, originalExempt := sessionManager, cfg.CSRF.ExemptPaths
+	sessionManager = NewSessionManager(sessions, testSessionPolicy(), zap.NewNop())
+	cfg.CSRF.ExemptPaths = exemptPaths
+	t.Cleanup(func() {
+		sessionManager, cfg.CSRF.ExemptPaths = originalManager, originalExempt
+	})
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	session := testSession(time.Now())
+	session.CSRFToken = "csrf-1"
+	legacy := testSession(time.Now())
+	legacy.SessionID = "session-legacy"
+	useCSRFFakes(t, newFakeSessionDao(session, legacy), "/api/webhooks/", "/api/authorize/*/login", "")
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		sessionID string
+		header    string
+		bearer    bool
+		wantOK    bool
+	}{
+		{"safe method", http.MethodGet, "/api/events", session.SessionID, "", false, true},
+		{"valid token", http.MethodPost, "/api/events", session.SessionID, "csrf-1", false, true},
+		{"missing token", http.MethodPost, "/api/events", session.SessionID, "", false, false},
+		{"mismatched token", http.MethodDelete, "/api/events/1", session.SessionID, "csrf-2", false, false},
+		{"session without token", http.MethodPost, "/api/events", legacy.SessionID, "csrf-1", false, false},
+		{"exempt prefix", http.MethodPost, "/api/webhooks/google", session.SessionID, "", false, true},
+		{"exempt pattern", http.MethodPost, "/api/authorize/entra/login", session.SessionID, "", false, true},
+		// * 只比對單一路徑段
+		{"pattern does not span segments", http.MethodPost, "/api/authorize/entra/x/login", session.SessionID, "", false, false},
+		{"prefix is not a pattern", http.MethodPost, "/api/webhook", session.SessionID, "", false, false},
+		{"bearer token", http.MethodPost, "/api/events", session.SessionID, "", true, true},
+		{"no session cookie", http.MethodPost, "/api/events", "", "", false, true},
+		// session 無效時由 ValidateSession 回應 401
+		{"unknown session", http.MethodPost, "/api/events", "session-unknown", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			context, _ := gin.CreateTestContext(w)
+			context.Request = httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.sessionID != "" {
+				context.Request.AddCookie(&http.Cookie{Name: "session_id", Value: tt.sessionID})
+			}
+			if tt.header != "" {
+				context.Request.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.bearer {
+				context.Request.Header.Set("Authorization", "Bearer api-token")
+			}
+
+			if got := VerifyCSRF(context); got != tt.wantOK {
+				t.Fatalf("VerifyCSRF() = %v, want %v", got, tt.wantOK)
+			}
+			if !tt.wantOK && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestEnsureCSRFToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantSaved bool
+	}{
+		{"existing token", "csrf-1", false},
+		// 舊 session 補產生並寫回
+		{"legacy session", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := testSession(time.Now())
+			session.CSRFToken = tt.token
+			sessions := newFakeSessionDao(session)
+			useCSRFFakes(t, sessions)
+
+			w := httptest.NewRecorder()
+			context, _ := gin.CreateTestContext(w)
+			context.Request = httptest.NewRequest(http.MethodGet, "/api/authorize/session", nil)
+			EnsureCSRFToken(context, &session)
+
+			if session.CSRFToken == "" || (tt.token != "" && session.CSRFToken != tt.token) {
+				t.Fatalf("session token = %q, want existing %q or a new token", session.CSRFToken, tt.token)
+			}
+			if got := w.Header().Get(CSRFHeader); got != session.CSRFToken {
+				t.Errorf("header = %q, want %q", got, session.CSRFToken)
+			}
+			var cookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == csrfCookie {
+					cookie = c
+				}
+			}
+			// double-submit cookie 需讓前端讀取
+			if cookie == nil || cookie.Value != session.CSRFToken || cookie.HttpOnly {
+				t.Errorf("cookie = %+v, want readable %q", cookie, session.CSRFToken)
+			}
+
+			stored, _ := sessions.GetSessionsBySessionID(session.SessionID)
+			if saved := sessions.updates > 0; saved != tt.wantSaved {
+				t.Errorf("saved = %v, want %v", saved, tt.wantSaved)
+			}
+			if stored.CSRFToken != session.CSRFToken {
+				t.Errorf("stored token = %q, want %q", stored.CSRFToken, session.CSRFToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dav"
+	"glt-calendar-service/utils"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DAVPrefix CalDAV 伺服器的路徑
+	DAVPrefix = "/dav"
+	davRealm  = "glt-calendar-service"
+)
+
+var davHandler = dav.NewHandler(DAVPrefix)
+
+// ServeDAV 讓 Thunderbird、iOS 等原生用戶端以 CalDAV 同步行事曆
+// 以 personal access token 驗證：basic auth 的密碼（使用者名稱不限）或 Authorization: Bearer
+func ServeDAV(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in ServeDAV", nil)
+		}
+	}()
+
+	if context.Request.Method == http.MethodOptions {
+		davHandler.Options(context.Writer)
+		return
+	}
+	if !authenticateDAV(context) {
+		return
+	}
+
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid session"}, "", err)
+		return
+	}
+	provider, ok := calendarProviderFor(session)
+	if !ok {
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{
+			"error": "Calendar is not available for this account",
+			"code":  "calendar_not_supported",
+		}, "No calendar provider for "+sessionProvider(session), nil)
+		return
+	}
+	accessToken, err := tokenManager.GetAccessToken(context)
+	if err != nil {
+		RespondAccessTokenError(context, err)
+		return
+	}
+
+	account := dav.Account{Provider: provider, AccessToken: accessToken}
+	if userInfo := session.Data.UserInfo; userInfo != nil {
+		account.DisplayName = userInfo.Name
+		account.Email = userInfo.Email
+	}
+	davHandler.Serve(context.Writer, context.Request, account)
+}
+
+// WellKnownCalDAV 服務探索（RFC 6764），導向 CalDAV 根目錄
+func WellKnownCalDAV(context *gin.Context) {
+	context.Redirect(http.StatusMovedPermanently, DAVPrefix+"/")
+}
+
+// authenticateDAV 驗證 personal access token，PUT、DELETE 需要 calendar:write，其他需要 calendar:read
+func authenticateDAV(context *gin.Context) bool {
+	rawToken := BearerToken(context)
+	if rawToken == "" {
+		_, rawToken, _ = context.Request.BasicAuth()
+	}
+
+	// 401 需要 WWW-Authenticate，用戶端才會提示輸入帳密
+	context.Header("WWW-Authenticate", `Basic realm="`+davRealm+`", charset="UTF-8"`)
+	if !strings.HasPrefix(rawToken, personalAccessTokenPrefix) {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Personal access token required"}, "", nil)
+		return false
+	}
+	if !resolvePersonalAccessToken(context, rawToken) {
+		return false
+	}
+	context.Writer.Header().Del("WWW-Authenticate")
+
+	scope := TokenScopeCalendarRead
+	if context.Request.Method == http.MethodPut || context.Request.Method == http.MethodDelete {
+		scope = TokenScopeCalendarWrite
+	}
+	return RequireTokenScopes(context, scope)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+)
+
+func TestAuthenticateDAV(t *testing.T) {
+	const (
+		readToken    = personalAccessTokenPrefix + "read"
+		writeToken   = personalAccessTokenPrefix + "write"
+		expiredToken = personalAccessTokenPrefix + "expired"
+	)
+	now := time.Now()
+	credential := testSession(now)
+	credential.SessionID = "pat-session-1"
+	credential.Kind = model.SessionKindPAT
+
+	tokens := &fakePersonalAccessTokenDao{tokens: map[string]model.PersonalAccessToken{}}
+	for rawToken, token := range map[string]model.PersonalAccessToken{
+		readToken:    {Scopes: []string{TokenScopeCalendarRead}, ExpiryDate: now.Add(time.Hour)},
+		writeToken:   {Scopes: []string{TokenScopeCalendarRead, TokenScopeCalendarWrite}, ExpiryDate: now.Add(time.Hour)},
+		expiredToken: {Scopes: []string{TokenScopeCalendarRead}, ExpiryDate: now.Add(-time.Minute)},
+	} {
+		token.TokenHash = hashAPIToken(rawToken)
+		token.UserID = credential.UserID
+		token.SessionID = credential.SessionID
+		_ = tokens.InsertToken(token)
+	}
+	originalManager, originalDao := sessionManager, personalAccessTokenDao
+	sessionManager = NewSessionManager(newFakeSessionDao(credential), testSessionPolicy(), zap.NewNop())
+	personalAccessTokenDao = tokens
+	t.Cleanup(func() {
+		sessionManager, personalAccessTokenDao = originalManager, originalDao
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		basicAuth  string // basic auth 的密碼，使用者名稱不限
+		bearer     string
+		wantStatus int // 0 代表驗證通過
+	}{
+		{"no credentials", http.MethodGet, "", "", http.StatusUnauthorized},
+		{"basic auth with account password", http.MethodGet, "hunter2", "", http.StatusUnauthorized},
+		{"basic auth with API access token", http.MethodGet, apiAccessTokenPrefix + "token", "", http.StatusUnauthorized},
+		{"basic auth with unknown token", http.MethodGet, personalAccessTokenPrefix + "unknown", "", http.StatusUnauthorized},
+		{"basic auth with expired token", http.MethodGet, expiredToken, "", http.StatusUnauthorized},
+		{"basic auth read", http.MethodGet, readToken, "", 0},
+		{"basic auth read token writes", http.MethodPut, readToken, "", http.StatusForbidden},
+		{"basic auth read token deletes", http.MethodDelete, readToken, "", http.StatusForbidden},
+		{"basic auth write", http.MethodPut, writeToken, "", 0},
+		{"bearer read", "PROPFIND", "", readToken, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			context, _ := gin.CreateTestContext(w)
+			context.Request = httptest.NewRequest(tt.method, DAVPrefix+"/calendars/", nil)
+			if tt.basicAuth != "" {
+				context.Request.SetBasicAuth("user@example.com", tt.basicAuth)
+			}
+			if tt.bearer != "" {
+				context.Request.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+
+			ok := authenticateDAV(context)
+			if ok != (tt.wantStatus == 0) {
+				t.Fatalf("authenticateDAV() = %v, want status %d, body = %s", ok, tt.wantStatus, w.Body.String())
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if !ok {
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				// 401 需要 WWW-Authenticate，用戶端才會提示輸入帳密
+				if (w.Code == http.StatusUnauthorized) != (challenge != "") {
+					t.Errorf("status = %d WWW-Authenticate = %q", w.Code, challenge)
+				}
+				return
+			}
+			if challenge != "" {
+				t.Errorf("WWW-Authenticate = %q, want none after authentication", challenge)
+			}
+			if principal, err := GetPrincipal(context); err != nil || principal.SessionID != credential.SessionID {
+				t.Errorf("principal = %+v, %v", principal, err)
+			}
+		})
+	}
+}
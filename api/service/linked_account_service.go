@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/identity"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// linkAccountPrompt 連結帳號時讓使用者選擇其他 Google 帳號，consent 確保取得 refresh token
+const linkAccountPrompt = "select_account consent"
+
+// defaultLinkFeature 連結帳號預設請求的功能 scope
+const defaultLinkFeature = "calendar.write"
+
+// errLinkedAccountNotFound accountId 不是登入帳號也不是連結帳號
+var errLinkedAccountNotFound = errors.New("linked account not found")
+
+var linkedAccountDao dao.LinkedAccountDaoInterface = dao.NewLinkedAccountDao()
+
+// StartLinkAccount 以目前 session 發起 Google 授權，callback 後加入連結帳號，不改變登入狀態
+// Query: returnTo（完成後導回的前端網址）、feature（預設 calendar.write）
+func StartLinkAccount(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	returnTo := context.Query("returnTo")
+	if returnTo != "" && !isAllowedReturnTo(returnTo) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Return URL is not allowed"}, "Return URL is not allowed: "+returnTo, nil)
+		return
+	}
+
+	provider := identityProviders.Google()
+	redirectToAuthorization(context, provider, model.OAuthState{
+		RedirectURI: provider.CallbackURI(),
+		ReturnTo:    returnTo,
+		LinkUserID:  session.UserID,
+	}, withFeatureScopes(provider, provider.Scopes(), context.DefaultQuery("feature", defaultLinkFeature)), linkAccountPrompt)
+}
+
+// linkAccountCallback 交換 token 後儲存為發起使用者的連結帳號
+// callback 必須帶有發起使用者的 session，避免他人的授權被連結到攻擊者的帳號
+func linkAccountCallback(context *gin.Context, oauthState *model.OAuthState, provider identity.IdentityProvider, code string) {
+	session, err := sessionManager.CurrentSession(context)
+	if err != nil || session.UserID != oauthState.LinkUserID {
+		failCallback(context, oauthState, http.StatusForbidden, "link_session_mismatch", fmt.Errorf("link callback without the session of user %s", oauthState.LinkUserID))
+		return
+	}
+
+	tokenResponse, err := tokenManager.exchangeCodeForToken(context.Request.Context(), provider, code, oauthState.RedirectURI, oauthState.CodeVerifier)
+	if err != nil {
+		failCallback(context, oauthState, http.StatusInternalServerError, "token_exchange_failed", err)
+		return
+	}
+
+	// 連結帳號不是登入，不套用登入限制
+	userInfo, err := resolveUserInfo(context, provider, tokenResponse, oauthState.Nonce)
+	if err != nil {
+		failCallback(context, oauthState, http.StatusInternalServerError, "link_failed", err)
+		return
+	}
+	if userInfo.ID == session.UserID {
+		failCallback(context, oauthState, http.StatusConflict, "account_is_primary", fmt.Errorf("account %s is the signed in account", userInfo.ID))
+		return
+	}
+
+	existing, err := linkedAccountDao.GetAccount(session.UserID, userInfo.ID)
+	if err != nil {
+		failCallback(context, oauthState, http.StatusInternalServerError, "link_failed", err)
+		return
+	}
+
+	currentTime := utils.GetCurrentTime()
+	account := model.LinkedAccount{
+		UserID:        session.UserID,
+		AccountID:     userInfo.ID,
+		Provider:      provider.Name(),
+		Email:         userInfo.Email,
+		Name:          userInfo.Name,
+		Picture:       userInfo.Picture,
+		TokenResponse: tokenResponse,
+		Scopes:        model.ParseScopes(tokenResponse.Scope),
+		CreateDate:    currentTime,
+		UpdateDate:    currentTime,
+	}
+	if existing != nil {
+		// 重新連結（增量授權）時保留既有 scope 與 refresh token
+		account.CreateDate = existing.CreateDate
+		account.Scopes = model.MergeScopes(existing.Scopes, account.Scopes)
+		if tokenResponse.RefreshToken == "" && existing.TokenResponse != nil {
+			tokenResponse.RefreshToken = existing.TokenResponse.RefreshToken
+		}
+	}
+
+	if err := linkedAccountDao.SaveAccount(account); err != nil {
+		failCallback(context, oauthState, http.StatusInternalServerError, "link_failed", err)
+		return
+	}
+	logger.Info("Account linked", zap.String("userID", session.UserID), zap.String("accountID", account.AccountID), zap.String("email", account.Email))
+
+	if oauthState.ReturnTo != "" {
+		context.Redirect(http.StatusFound, oauthState.ReturnTo)
+		return
+	}
+	respHandler.SuccessContextMessage(context, linkedAccountSummary(account))
+}
+
+// ListLinkedAccounts 列出登入帳號與所有連結帳號
+func ListLinkedAccounts(context *gin.Context) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	linked, err := linkedAccountDao.GetAccountsByUserID(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list accounts"}, "", err)
+		return
+	}
+	slices.SortFunc(linked, func(a, b model.LinkedAccount) int {
+		return a.CreateDate.Compare(b.CreateDate)
+	})
+
+	accounts := make([]model.LinkedAccountSummary, 0, len(linked)+1)
+	accounts = append(accounts, primaryAccountSummary(session))
+	for _, account := range linked {
+		accounts = append(accounts, linkedAccountSummary(account))
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"accounts": accounts})
+}
+
+// UnlinkAccount 撤銷連結帳號的 Google 授權並刪除，撤銷失敗仍會刪除
+func UnlinkAccount(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	account, err := linkedAccountDao.GetAccount(session.UserID, context.Param("id"))
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to unlink account"}, "", err)
+		return
+	}
+	if account == nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Linked account not found"}, "", nil)
+		return
+	}
+
+	revoked := false
+	if account.TokenResponse != nil {
+		token := account.TokenResponse.RefreshToken
+		if token == "" {
+			token = account.TokenResponse.AccessToken
+		}
+		if err := tokenManager.revokeToken(identityProviders.Google(), token); err != nil {
+			logger.Error("Failed to revoke linked account token", zap.String("userID", session.UserID), zap.String("accountID", account.AccountID), zap.Error(err))
+		} else {
+			revoked = true
+		}
+	}
+
+	if err := linkedAccountDao.DeleteAccount(session.UserID, account.AccountID); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to unlink account"}, "", err)
+		return
+	}
+	logger.Info("Account unlinked", zap.String("userID", session.UserID), zap.String("accountID", account.AccountID))
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Account unlinked", "revoked": revoked})
+}
+
+// requireLinkedAccountScopes 檢查連結帳號是否已授權功能所需 scope，缺少時需以 feature 重新連結
+func requireLinkedAccountScopes(context *gin.Context, userID, accountID string, features ...string) bool {
+	account, err := linkedAccountDao.GetAccount(userID, accountID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get linked account"}, "", err)
+		return false
+	}
+	if account == nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Linked account not found"}, "", errLinkedAccountNotFound)
+		return false
+	}
+
+	missing := missingFeatureScopes(featureScopes, account.Scopes, features...)
+	if len(missing) == 0 {
+		return true
+	}
+	respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{
+		"error":          "Insufficient OAuth scopes",
+		"code":           "link_scope_required",
+		"accountId":      accountID,
+		"missing_scopes": missing,
+	}, "Missing OAuth scopes of linked account: "+strings.Join(missing, " "), nil)
+	return false
+}
+
+// linkedAccountToken 取得連結帳號有效的 access token，過期時以 refresh token 更新並儲存
+func linkedAccountToken(ctx context.Context, account *model.LinkedAccount) (string, error) {
+	if !account.IsTokenExpired() {
+		return account.TokenResponse.AccessToken, nil
+	}
+	if account.TokenResponse == nil || account.TokenResponse.RefreshToken == "" {
+		return "", fmt.Errorf("refresh token not found for linked account %s", account.AccountID)
+	}
+
+	newToken, err := tokenManager.refreshToken(ctx, identityProviders.Google(), account.TokenResponse.RefreshToken)
+	if err != nil {
+		if IsInvalidGrant(err) {
+			logger.Warn("Linked account refresh token is invalid or revoked", zap.String("userID", account.UserID), zap.String("accountID", account.AccountID), zap.Error(err))
+		}
+		return "", fmt.Errorf("failed to refresh linked account token: %w", err)
+	}
+
+	account.TokenResponse.AccessToken = newToken.AccessToken
+	account.TokenResponse.ExpiresIn = newToken.ExpiresIn
+	account.TokenResponse.TokenType = newToken.TokenType
+	account.TokenResponse.CreatedAt = newToken.CreatedAt
+	if newToken.RefreshToken != "" {
+		account.TokenResponse.RefreshToken = newToken.RefreshToken
+	}
+	if newToken.Scope != "" {
+		account.TokenResponse.Scope = newToken.Scope
+		account.Scopes = model.ParseScopes(newToken.Scope)
+	}
+	account.UpdateDate = utils.GetCurrentTime()
+
+	// 儲存失敗下次再更新，不影響本次請求
+	if err := linkedAccountDao.SaveAccount(*account); err != nil {
+		logger.Error("Failed to save linked account token", zap.String("userID", account.UserID), zap.String("accountID", account.AccountID), zap.Error(err))
+	}
+	return newToken.AccessToken, nil
+}
+
+// respondLinkedAccountTokenError 連結帳號的授權失效時回應 403 link_reauth_required，不影響登入 session
+func respondLinkedAccountTokenError(context *gin.Context, account *model.LinkedAccount, err error) {
+	if IsInvalidGrant(err) {
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{
+			"error":     "Google authorization of the linked account expired or was revoked, please link it again",
+			"code":      "link_reauth_required",
+			"accountId": account.AccountID,
+		}, "Linked account refresh token is invalid", err)
+		return
+	}
+
+	var tokenErr *TokenRequestError
+	if errors.As(err, &tokenErr) && tokenErr.Transient() {
+		respHandler.FailContextCodeMessage(context, http.StatusServiceUnavailable, gin.H{"error": "Failed to get access token", "retryable": true}, "", err)
+		return
+	}
+	respHandler.FailContextMessage(context, gin.H{"error": "Failed to get access token"}, "", err)
+}
+
+// primaryAccountSummary 目前登入的帳號
+func primaryAccountSummary(session *model.Session) model.LinkedAccountSummary {
+	summary := model.LinkedAccountSummary{
+		AccountID: session.UserID,
+		Provider:  sessionProvider(session),
+		Primary:   true,
+		Scopes:    session.GrantedScopes(),
+	}
+	if session.Data != nil && session.Data.UserInfo != nil {
+		summary.Email = session.Data.UserInfo.Email
+		summary.Name = session.Data.UserInfo.Name
+		summary.Picture = session.Data.UserInfo.Picture
+	}
+	return summary
+}
+
+func linkedAccountSummary(account model.LinkedAccount) model.LinkedAccountSummary {
+	return model.LinkedAccountSummary{
+		AccountID: account.AccountID,
+		Provider:  account.Provider,
+		Email:     account.Email,
+		Name:      account.Name,
+		Picture:   account.Picture,
+		Scopes:    account.Scopes,
+	}
+}
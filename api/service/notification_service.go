@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/calendar"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/api/notifier"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxReminderOffset 提醒最多提前 7 天
+	maxReminderOffset = 7 * 24 * 60
+	defaultTimeZone   = "UTC"
+	// notificationCredentialLifetime 通知專用 session 的效期，排程使用時滑動延長
+	notificationCredentialLifetime = 90 * 24 * time.Hour
+)
+
+var (
+	notificationDao    dao.NotificationDaoInterface = dao.NewNotificationDao()
+	notificationSender                              = notifier.NewNotifier(cfg.Notification)
+)
+
+// GetNotificationSettings returns the notification settings of the current user
+func GetNotificationSettings(context *gin.Context) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	settings, err := loadNotificationSettings(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get notification settings"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, settings)
+}
+
+// UpdateNotificationSettings updates the opt-in settings of the current user
+func UpdateNotificationSettings(context *gin.Context) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	var req model.NotificationSettingsRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid request format"}, "", err)
+		return
+	}
+
+	settings, err := loadNotificationSettings(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get notification settings"}, "", err)
+		return
+	}
+
+	if req.DigestEnabled != nil {
+		settings.DigestEnabled = *req.DigestEnabled
+	}
+	if req.RemindersEnabled != nil {
+		settings.RemindersEnabled = *req.RemindersEnabled
+	}
+	if req.ReminderOffsets != nil {
+		for _, offset := range req.ReminderOffsets {
+			if offset <= 0 || offset > maxReminderOffset {
+				respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Reminder offset must be between 1 and %d minutes", maxReminderOffset)}, "", nil)
+				return
+			}
+		}
+		settings.ReminderOffsets = req.ReminderOffsets
+	}
+	if req.TimeZone != nil {
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid time zone"}, "", err)
+			return
+		}
+		settings.TimeZone = *req.TimeZone
+	}
+	if req.CalendarID != nil && *req.CalendarID != "" {
+		settings.CalendarID = *req.CalendarID
+	}
+
+	// 排程使用通知專用的 session，複製目前 session 的 token，登出瀏覽器不影響通知
+	// 每次儲存都重新建立，停用的通知也藉此重新授權
+	previousSessionID := settings.SessionID
+	settings.SessionID = ""
+	settings.Status = ""
+	settings.DisabledReason = ""
+	if settings.DigestEnabled || settings.RemindersEnabled {
+		if session.Data == nil || session.Data.TokenResponse == nil {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Calendar access is required for notifications"}, "", nil)
+			return
+		}
+		credential, err := sessionManager.SaveTokenSession(session, model.SessionKindNotification, utils.GetCurrentTime().Add(notificationCredentialLifetime))
+		if err != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Failed to save notification settings"}, "", err)
+			return
+		}
+		settings.SessionID = credential.SessionID
+		settings.Status = model.NotificationStatusActive
+	}
+	if session.Data != nil && session.Data.UserInfo != nil {
+		settings.Email = session.Data.UserInfo.Email
+	}
+	settings.UpdateDate = utils.GetCurrentTime()
+
+	if err := notificationDao.SaveSettings(*settings); err != nil {
+		if settings.SessionID != "" {
+			_ = sessionManager.DeleteSession(settings.SessionID)
+		}
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to save notification settings"}, "", err)
+		return
+	}
+	deleteNotificationCredential(previousSessionID)
+
+	respHandler.SuccessContextMessage(context, settings)
+}
+
+// loadNotificationSettings 取得使用者設定，尚未設定時回傳預設值
+func loadNotificationSettings(userID string) (*model.NotificationSettings, error) {
+	settings, err := notificationDao.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings == nil {
+		settings = &model.NotificationSettings{
+			UserID:          userID,
+			ReminderOffsets: cfg.Notification.ReminderOffsets,
+			TimeZone:        defaultTimeZone,
+			CalendarID:      "primary",
+		}
+
+		// 預設沿用使用者偏好的時區與行事曆
+		if user, err := userDao.GetUserByID(userID); err == nil {
+			if user.Preferences.TimeZone != "" {
+				settings.TimeZone = user.Preferences.TimeZone
+			}
+			if user.Preferences.DefaultCalendar != "" {
+				settings.CalendarID = user.Preferences.DefaultCalendar
+			}
+		}
+	}
+	return settings, nil
+}
+
+// deleteNotificationCredential 刪除通知專用 session，舊設定指向瀏覽器 session 時不刪除
+func deleteNotificationCredential(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	credential, err := sessionManager.GetSessionByID(sessionID)
+	if err != nil || credential.Kind != model.SessionKindNotification {
+		return
+	}
+	if err := sessionManager.DeleteSession(sessionID); err != nil {
+		logger.Warn("Failed to delete notification session", zap.String("userID", credential.UserID), zap.Error(err))
+	}
+}
+
+// disableNotifications 授權失效時停用通知並記錄原因，使用者重新儲存設定後恢復
+func disableNotifications(settings model.NotificationSettings, reason string) {
+	// 期間使用者已重新儲存設定時不覆寫
+	current, err := notificationDao.GetSettings(settings.UserID)
+	if err != nil || current == nil || current.SessionID != settings.SessionID {
+		return
+	}
+
+	current.Status = model.NotificationStatusDisabled
+	current.DisabledReason = reason
+	current.UpdateDate = utils.GetCurrentTime()
+	if err := notificationDao.SaveSettings(*current); err != nil {
+		logger.Error("Failed to disable notifications", zap.String("userID", settings.UserID), zap.Error(err))
+		return
+	}
+	logger.Warn("Notifications disabled", zap.String("userID", settings.UserID), zap.String("reason", reason))
+}
+
+// revokeNotifications 撤銷使用者的通知專用 session 並停用通知
+func revokeNotifications(userID string) {
+	settings, err := notificationDao.GetSettings(userID)
+	if err != nil {
+		logger.Error("Failed to get notification settings", zap.String("userID", userID), zap.Error(err))
+		return
+	}
+	if settings == nil || settings.SessionID == "" {
+		return
+	}
+	deleteNotificationCredential(settings.SessionID)
+	disableNotifications(*settings, model.NotificationDisabledRevoked)
+}
+
+// StartNotificationScheduler 本地開發時以 ticker 代替 EventBridge 排程
+func StartNotificationScheduler(ctx context.Context) {
+	interval := time.Duration(cfg.Notification.ScheduleInterval) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("Notification scheduler started", zap.Duration("interval", interval))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := RunScheduledNotifications(ctx); err != nil {
+				logger.Error("Failed to run scheduled notifications", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunScheduledNotifications 排程進入點：寄送每日摘要與事件提醒
+func RunScheduledNotifications(ctx context.Context) error {
+	if !cfg.Notification.Enabled {
+		logger.Info("Notification is disabled, skip scheduled run")
+		return nil
+	}
+
+	settingsList, err := notificationDao.ListEnabledSettings()
+	if err != nil {
+		return fmt.Errorf("failed to list notification settings: %w", err)
+	}
+
+	now := utils.GetCurrentTime()
+	for _, settings := range settingsList {
+		// 單一使用者失敗不影響其他使用者
+		if err := processUserNotifications(ctx, settings, now); err != nil {
+			logger.Error("Failed to process user notifications", zap.String("userID", settings.UserID), zap.Error(err))
+		}
+	}
+
+	logger.Info("Scheduled notifications finished", zap.Int("users", len(settingsList)))
+	return nil
+}
+
+func processUserNotifications(ctx context.Context, settings model.NotificationSettings, now time.Time) error {
+	if settings.Email == "" {
+		return fmt.Errorf("no email address in notification settings")
+	}
+
+	if settings.SessionID == "" {
+		disableNotifications(settings, model.NotificationDisabledMissing)
+		return fmt.Errorf("no notification session in notification settings")
+	}
+
+	session, err := sessionManager.GetSessionByID(settings.SessionID)
+	if err != nil {
+		if errors.Is(err, dao.ErrSessionNotFound) {
+			disableNotifications(settings, model.NotificationDisabledMissing)
+		}
+		return fmt.Errorf("failed to get notification session: %w", err)
+	}
+
+	if session.IsTokenExpired() {
+		if session, err = tokenManager.RefreshSessionToken(session); err != nil {
+			// refresh token 已失效，session 無法再使用
+			if IsInvalidGrant(err) {
+				if deleteErr := sessionManager.DeleteSession(settings.SessionID); deleteErr != nil {
+					logger.Error("Failed to delete session with revoked token", zap.String("sessionID", settings.SessionID), zap.Error(deleteErr))
+				}
+				disableNotifications(settings, model.NotificationDisabledRevoked)
+			}
+			return err
+		}
+	}
+
+	// 通知專用 session 於使用時滑動延長，剩餘效期不足一半時才寫入
+	if session.Kind == model.SessionKindNotification && session.ExpiryDate.Sub(now) < notificationCredentialLifetime/2 {
+		if err := sessionManager.ExtendTokenSession(session, now.Add(notificationCredentialLifetime)); err != nil {
+			logger.Warn("Failed to extend notification session", zap.String("userID", settings.UserID), zap.Error(err))
+		}
+	}
+	accessToken := session.Data.TokenResponse.AccessToken
+	provider, ok := calendarProviderFor(session)
+	if !ok {
+		return fmt.Errorf("no calendar provider for %s", sessionProvider(session))
+	}
+
+	location, err := time.LoadLocation(settings.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	if settings.DigestEnabled {
+		if err := sendDailyDigest(ctx, settings, provider, accessToken, now.In(location)); err != nil {
+			logger.Error("Failed to send daily digest", zap.String("userID", settings.UserID), zap.Error(err))
+		}
+	}
+
+	if settings.RemindersEnabled {
+		if err := sendEventReminders(ctx, settings, provider, accessToken, now.In(location)); err != nil {
+			logger.Error("Failed to send event reminders", zap.String("userID", settings.UserID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// sendDailyDigest 於設定時段寄送當日行程摘要，每日只寄送一次
+func sendDailyDigest(ctx context.Context, settings model.NotificationSettings, provider calendar.CalendarProvider, accessToken string, now time.Time) error {
+	if now.Hour() != cfg.Notification.DigestHour {
+		return nil
+	}
+
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	calendarData, err := listEventsBetween(ctx, provider, accessToken, settings.CalendarID, dayStart, dayEnd)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("%s 的行程：\n\n", dayStart.Format("2006-01-02")))
+	if len(calendarData.Items) == 0 {
+		body.WriteString("今天沒有行程。\n")
+	}
+	for _, event := range calendarData.Items {
+		if event.Status == "cancelled" {
+			continue
+		}
+		body.WriteString(fmt.Sprintf("- %s %s\n", formatEventTime(event.Start, now.Location()), event.Summary))
+	}
+
+	markerID := fmt.Sprintf("%s#digest#%s", settings.UserID, dayStart.Format("2006-01-02"))
+	return sendOnce(ctx, settings.UserID, markerID, dayEnd.AddDate(0, 0, 1), notifier.Message{
+		To:      []string{settings.Email},
+		Subject: fmt.Sprintf("每日行程摘要 %s", dayStart.Format("2006-01-02")),
+		Body:    body.String(),
+	})
+}
+
+// sendEventReminders 寄送事件開始前的提醒，每個事件與提醒時間只寄送一次
+func sendEventReminders(ctx context.Context, settings model.NotificationSettings, provider calendar.CalendarProvider, accessToken string, now time.Time) error {
+	offsets := settings.ReminderOffsets
+	if len(offsets) == 0 {
+		offsets = cfg.Notification.ReminderOffsets
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	maxOffset := 0
+	for _, offset := range offsets {
+		if offset > maxOffset {
+			maxOffset = offset
+		}
+	}
+
+	// 只提醒落在本次排程區間內的提醒時間，避免首次啟用時補寄過去的提醒
+	window := time.Duration(cfg.Notification.ScheduleInterval) * time.Minute
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+
+	calendarData, err := listEventsBetween(ctx, provider, accessToken, settings.CalendarID, now, now.Add(time.Duration(maxOffset)*time.Minute+window))
+	if err != nil {
+		return err
+	}
+
+	for _, event := range calendarData.Items {
+		// 全天事件沒有開始時間，不提醒
+		if event.Status == "cancelled" || event.Start.DateTime == "" {
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, event.Start.DateTime)
+		if err != nil {
+			logger.Warn("Failed to parse event start time", zap.String("eventID", event.ID), zap.Error(err))
+			continue
+		}
+
+		for _, offset := range offsets {
+			remindAt := start.Add(-time.Duration(offset) * time.Minute)
+			if remindAt.After(now) || !remindAt.After(now.Add(-window)) {
+				continue
+			}
+
+			markerID := fmt.Sprintf("%s#reminder#%s#%d#%d", settings.UserID, event.ID, start.Unix(), offset)
+			err := sendOnce(ctx, settings.UserID, markerID, start.AddDate(0, 0, 1), notifier.Message{
+				To:      []string{settings.Email},
+				Subject: fmt.Sprintf("提醒：%s 將於 %d 分鐘後開始", event.Summary, offset),
+				Body: fmt.Sprintf("%s\n開始時間：%s\n地點：%s\n\n%s\n",
+					event.Summary,
+					start.In(now.Location()).Format("2006-01-02 15:04"),
+					event.Location,
+					event.Description,
+				),
+			})
+			if err != nil {
+				logger.Error("Failed to send event reminder", zap.String("eventID", event.ID), zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+// sendOnce 先寫入寄送紀錄再寄送，紀錄已存在代表已寄送過；寄送失敗時移除紀錄以便下次重試
+func sendOnce(ctx context.Context, userID, markerID string, expiry time.Time, msg notifier.Message) error {
+	claimed, err := notificationDao.InsertMarker(model.NotificationMarker{
+		MarkerID:   markerID,
+		UserID:     userID,
+		CreateDate: utils.GetCurrentTime(),
+		TTL:        expiry.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	if err := notificationSender.Send(ctx, msg); err != nil {
+		if deleteErr := notificationDao.DeleteMarker(markerID); deleteErr != nil {
+			logger.Error("Failed to delete notification marker", zap.String("markerID", markerID), zap.Error(deleteErr))
+		}
+		return err
+	}
+
+	logger.Info("Notification sent", zap.String("markerID", markerID))
+	return nil
+}
+
+func listEventsBetween(ctx context.Context, provider calendar.CalendarProvider, accessToken, calendarId string, timeMin, timeMax time.Time) (*model.CalendarResponse, error) {
+	query := calendar.ListQuery{
+		TimeMin:      timeMin.Format(time.RFC3339),
+		TimeMax:      timeMax.Format(time.RFC3339),
+		MaxResults:   100,
+		SingleEvents: true,
+		OrderBy:      "startTime",
+	}
+
+	if calendarId == "" {
+		calendarId = calendar.PrimaryCalendarID
+	}
+	return provider.ListEvents(ctx, accessToken, calendarId, query)
+}
+
+func formatEventTime(eventTime model.EventTime, location *time.Location) string {
+	if eventTime.DateTime == "" {
+		return "全天"
+	}
+	start, err := time.Parse(time.RFC3339, eventTime.DateTime)
+	if err != nil {
+		return eventTime.DateTime
+	}
+	return start.In(location).Format("15:04")
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+)
+
+// fakeNotificationDao 以記憶體保存通知設定
+type fakeNotificationDao struct {
+	settings map[string]model.NotificationSettings
+}
+
+func (f *fakeNotificationDao) GetSettings(userID string) (*model.NotificationSettings, error) {
+	settings, ok := f.settings[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &settings, nil
+}
+
+func (f *fakeNotificationDao) SaveSettings(settings model.NotificationSettings) error {
+	f.settings[settings.UserID] = settings
+	return nil
+}
+
+func (f *fakeNotificationDao) ListEnabledSettings() ([]model.NotificationSettings, error) {
+	return nil, nil
+}
+
+func (f *fakeNotificationDao) InsertMarker(marker model.NotificationMarker) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeNotificationDao) DeleteMarker(markerID string) error {
+	return nil
+}
+
+// useNotificationFakes 以 fake DAO 取代 sessionManager 與 notificationDao
+func useNotificationFakes(t *testing.T, sessions *fakeSessionDao, settings ...model.NotificationSettings) *fakeNotificationDao {
+	fake := &fakeNotificationDao{settings: map[string]model.NotificationSettings{}}
+	for _, s := range settings {
+		fake.settings[s.UserID] = s
+	}
+
+	originalManager, originalDao := sessionManager, notificationDao
+	sessionManager = NewSessionManager(sessions, testSessionPolicy(), zap.NewNop())
+	notificationDao = fake
+	t.Cleanup(func() {
+		sessionManager, notificationDao = originalManager, originalDao
+	})
+	return fake
+}
+
+func putNotificationSettings(t *testing.T, session *model.Session, body string) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/api/notifications", func(context *gin.Context) {
+		context.Set("session", session)
+		UpdateNotificationSettings(context)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/notifications", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /api/notifications %s status = %d, body = %s", body, w.Code, w.Body.String())
+	}
+}
+
+func TestNotificationSettingsUseDedicatedSession(t *testing.T) {
+	now := time.Now()
+	browser := testSession(now)
+	browser.Data.UserInfo = &model.GoogleUserInfo{Email: "user@example.com"}
+	sessions := newFakeSessionDao(browser)
+	notifications := useNotificationFakes(t, sessions, model.NotificationSettings{UserID: "user-1", TimeZone: "UTC", CalendarID: "primary"})
+
+	putNotificationSettings(t, &browser, `{"digestEnabled":true}`)
+
+	settings := notifications.settings["user-1"]
+	if settings.SessionID == "" || settings.SessionID == browser.SessionID {
+		t.Fatalf("settings session = %q, want a dedicated session", settings.SessionID)
+	}
+	if settings.Status != model.NotificationStatusActive || settings.Email != "user@example.com" {
+		t.Errorf("settings = %+v", settings)
+	}
+	credential, err := sessions.GetSessionsBySessionID(settings.SessionID)
+	if err != nil {
+		t.Fatalf("notification session not stored: %v", err)
+	}
+	if credential.Kind != model.SessionKindNotification || credential.Data.TokenResponse.RefreshToken != "refresh-1" {
+		t.Errorf("notification session = %+v", credential)
+	}
+	if credential.ExpiryDate.Before(now.Add(notificationCredentialLifetime - time.Minute)) {
+		t.Errorf("notification session expiry = %v, want about %v", credential.ExpiryDate, notificationCredentialLifetime)
+	}
+
+	// 登出所有裝置不影響通知
+	deleted, err := sessionManager.DeleteUserSessions("user-1", "")
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteUserSessions() = %d, %v, want only the browser session", deleted, err)
+	}
+	if _, err := sessions.GetSessionsBySessionID(settings.SessionID); err != nil {
+		t.Errorf("notification session deleted by sign-out everywhere: %v", err)
+	}
+	summaries, _ := sessionManager.ListUserSessions("user-1", "")
+	if len(summaries) != 0 {
+		t.Errorf("device list = %+v, want notification session hidden", summaries)
+	}
+
+	// 重新儲存時建立新的 session 並刪除舊的
+	previous := settings.SessionID
+	putNotificationSettings(t, &browser, `{"timeZone":"Asia/Taipei"}`)
+	settings = notifications.settings["user-1"]
+	if settings.SessionID == previous {
+		t.Errorf("settings session = %q, want a new session", settings.SessionID)
+	}
+	if _, err := sessions.GetSessionsBySessionID(previous); err == nil {
+		t.Error("previous notification session was not deleted")
+	}
+
+	// 關閉通知時刪除 session
+	previous = settings.SessionID
+	putNotificationSettings(t, &browser, `{"digestEnabled":false}`)
+	settings = notifications.settings["user-1"]
+	if settings.SessionID != "" || settings.Status != "" {
+		t.Errorf("settings = %+v, want no session when notifications are off", settings)
+	}
+	if _, err := sessions.GetSessionsBySessionID(previous); err == nil {
+		t.Error("notification session was not deleted when notifications were turned off")
+	}
+}
+
+func TestNotificationsDisabledWhenCredentialIsGone(t *testing.T) {
+	now := time.Now()
+	sessions := newFakeSessionDao()
+	notifications := useNotificationFakes(t, sessions, model.NotificationSettings{
+		UserID:        "user-1",
+		SessionID:     "deleted-session",
+		Email:         "user@example.com",
+		DigestEnabled: true,
+		Status:        model.NotificationStatusActive,
+	})
+
+	if err := processUserNotifications(t.Context(), notifications.settings["user-1"], now); err == nil {
+		t.Fatal("processUserNotifications() error = nil, want missing session error")
+	}
+	settings := notifications.settings["user-1"]
+	if settings.Status != model.NotificationStatusDisabled || settings.DisabledReason != model.NotificationDisabledMissing {
+		t.Errorf("settings status = %q reason = %q, want disabled credential_missing", settings.Status, settings.DisabledReason)
+	}
+}
+
+func TestRevokeNotificationsDeletesCredential(t *testing.T) {
+	now := time.Now()
+	credential := testSession(now)
+	credential.SessionID = "notification-1"
+	credential.Kind = model.SessionKindNotification
+	sessions := newFakeSessionDao(credential)
+	notifications := useNotificationFakes(t, sessions, model.NotificationSettings{
+		UserID:           "user-1",
+		SessionID:        credential.SessionID,
+		RemindersEnabled: true,
+		Status:           model.NotificationStatusActive,
+	})
+
+	revokeNotifications("user-1")
+
+	if _, err := sessions.GetSessionsBySessionID(credential.SessionID); err == nil {
+		t.Error("notification session was not deleted")
+	}
+	settings := notifications.settings["user-1"]
+	if settings.Status != model.NotificationStatusDisabled || settings.DisabledReason != model.NotificationDisabledRevoked {
+		t.Errorf("settings status = %q reason = %q, want disabled credential_revoked", settings.Status, settings.DisabledReason)
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/identity"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// oauthStateExpiry 授權流程 state 的有效時間
+const oauthStateExpiry = 10 * time.Minute
+
+// oauthStateCookie 發起授權的瀏覽器保存 state 的雜湊，callback 必須帶有相同的 cookie（防止 login CSRF）
+const oauthStateCookie = "oauth_state"
+
+// ErrRedirectURINotAllowed redirect URI 不在允許清單中
+var ErrRedirectURINotAllowed = errors.New("redirect uri is not allowed")
+
+var oauthStateDao dao.OAuthStateDaoInterface = dao.NewOAuthStateDao()
+
+// StartAuthorization 產生 state、PKCE 與 nonce，暫存後導向提供者（/:provider/start）的授權頁
+// Query: redirectUri（預設為後端 callback）、returnTo（登入完成後導回的前端網址）、feature（額外請求的 Google 功能 scope）、rememberMe
+func StartAuthorization(context *gin.Context) {
+	provider, ok := identityProviders.Get(context.Param("provider"))
+	if !ok {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Identity provider not found"}, "Unknown identity provider: "+context.Param("provider"), nil)
+		return
+	}
+
+	redirectURI := context.DefaultQuery("redirectUri", provider.CallbackURI())
+	if !provider.AllowsRedirectURI(redirectURI) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Redirect URI is not allowed"}, "", fmt.Errorf("%w: %s", ErrRedirectURINotAllowed, redirectURI))
+		return
+	}
+
+	returnTo := context.Query("returnTo")
+	if returnTo != "" && !isAllowedReturnTo(returnTo) {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Return URL is not allowed"}, "Return URL is not allowed: "+returnTo, nil)
+		return
+	}
+
+	redirectToAuthorization(context, provider, model.OAuthState{
+		RedirectURI: redirectURI,
+		ReturnTo:    returnTo,
+		RememberMe:  context.DefaultQuery("rememberMe", "false") == "true",
+	}, withFeatureScopes(provider, provider.Scopes(), context.Query("feature")), "")
+}
+
+// withFeatureScopes 加上 feature（逗號分隔）所需的首選 scope，功能 scope 只適用於 Google API
+func withFeatureScopes(provider identity.IdentityProvider, scopes []string, feature string) []string {
+	if feature == "" || provider.Name() != identity.GoogleProviderName {
+		return scopes
+	}
+	for _, name := range strings.Split(feature, ",") {
+		if featureScope, ok := featureScopes[strings.TrimSpace(name)]; ok && len(featureScope) > 0 {
+			scopes = append(slices.Clone(scopes), featureScope[0])
+		}
+	}
+	return scopes
+}
+
+// redirectToAuthorization 產生 state、PKCE 與 nonce，與 oauthState 的其他欄位一起暫存後導向授權頁
+// prompt 為空字串時使用提供者預設值
+func redirectToAuthorization(context *gin.Context, provider identity.IdentityProvider, oauthState model.OAuthState, scopes []string, prompt string) {
+	state, err := utils.RandomString(32)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to start authorization"}, "", err)
+		return
+	}
+	codeVerifier, err := utils.RandomString(32)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to start authorization"}, "", err)
+		return
+	}
+	nonce, err := utils.RandomString(16)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to start authorization"}, "", err)
+		return
+	}
+
+	currentTime := utils.GetCurrentTime()
+	expiryTime := currentTime.Add(oauthStateExpiry)
+	oauthState.State = state
+	oauthState.CodeVerifier = codeVerifier
+	oauthState.Nonce = nonce
+	oauthState.Provider = provider.Name()
+	oauthState.CreateDate = currentTime
+	oauthState.ExpiryDate = expiryTime
+	oauthState.TTL = expiryTime.Unix()
+	if err := oauthStateDao.InsertState(oauthState); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to start authorization"}, "", err)
+		return
+	}
+	// 提供者導回 callback 是跨站的頂層導覽，需要 SameSite=Lax 才會帶上 cookie
+	sessionManager.SetCookie(context, &model.Cookie{
+		Name:     oauthStateCookie,
+		Value:    hashAPIToken(state),
+		MaxAge:   int(oauthStateExpiry.Seconds()),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authorizationURL, err := buildProviderAuthorizationURL(context.Request.Context(), provider, model.AuthorizationRequest{
+		Scopes:        model.MergeScopes(nil, scopes),
+		RedirectURI:   oauthState.RedirectURI,
+		State:         state,
+		CodeChallenge: codeChallengeS256(codeVerifier),
+		Nonce:         nonce,
+		Prompt:        prompt,
+	})
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to start authorization"}, "Failed to discover identity provider "+provider.Name(), err)
+		return
+	}
+	context.Redirect(http.StatusFound, authorizationURL)
+}
+
+// AuthorizationCallback 驗證 state 後以 PKCE verifier 向提供者（/:provider/callback）交換 token 並完成登入
+func AuthorizationCallback(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in AuthorizationCallback", nil)
+		}
+	}()
+
+	state := context.Query("state")
+	if state == "" {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Missing state"}, "", nil)
+		return
+	}
+
+	// state 必須由同一個瀏覽器發起，避免攻擊者以自己的 code、state 讓受害者登入攻擊者的帳號
+	stateCookie, cookieErr := context.Cookie(oauthStateCookie)
+	clearOAuthStateCookie(context)
+	if cookieErr != nil || subtle.ConstantTimeCompare([]byte(stateCookie), []byte(hashAPIToken(state))) != 1 {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid state"}, "OAuth state cookie does not match", cookieErr)
+		return
+	}
+
+	// state 只能使用一次
+	oauthState, err := oauthStateDao.ConsumeState(state)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid state"}, "Failed to consume oauth state", err)
+		return
+	}
+
+	// state 必須由同一個提供者的授權流程產生
+	providerName := oauthState.Provider
+	if providerName == "" {
+		providerName = identity.GoogleProviderName
+	}
+	if providerName != strings.ToLower(context.Param("provider")) {
+		failCallback(context, oauthState, http.StatusBadRequest, "provider_mismatch", fmt.Errorf("oauth state belongs to provider %s", providerName))
+		return
+	}
+	provider, ok := identityProviders.Get(providerName)
+	if !ok {
+		failCallback(context, oauthState, http.StatusBadRequest, "provider_not_found", fmt.Errorf("identity provider %s is not enabled", providerName))
+		return
+	}
+
+	if utils.GetCurrentTime().After(oauthState.ExpiryDate) {
+		failCallback(context, oauthState, http.StatusBadRequest, "authorization_expired", fmt.Errorf("oauth state expired"))
+		return
+	}
+
+	// 使用者拒絕授權
+	if authErr := context.Query("error"); authErr != "" {
+		failCallback(context, oauthState, http.StatusBadRequest, authErr, fmt.Errorf("authorization denied: %s", authErr))
+		return
+	}
+
+	code := context.Query("code")
+	if code == "" {
+		failCallback(context, oauthState, http.StatusBadRequest, "missing_code", fmt.Errorf("authorization code is required"))
+		return
+	}
+
+	// 連結帳號流程不改變登入狀態
+	if oauthState.LinkUserID != "" {
+		linkAccountCallback(context, oauthState, provider, code)
+		return
+	}
+
+	tokenResponse, err := tokenManager.exchangeCodeForToken(context.Request.Context(), provider, code, oauthState.RedirectURI, oauthState.CodeVerifier)
+	if err != nil {
+		failCallback(context, oauthState, http.StatusInternalServerError, "token_exchange_failed", err)
+		return
+	}
+
+	userInfo, err := completeLogin(context, tokenResponse, loginOptions{provider: provider, nonce: oauthState.Nonce, rememberMe: oauthState.RememberMe})
+	if err != nil {
+		var loginErr *loginError
+		if errors.As(err, &loginErr) && loginErr.statusCode != 0 {
+			failCallback(context, oauthState, loginErr.statusCode, loginErr.code, err)
+			return
+		}
+		failCallback(context, oauthState, http.StatusInternalServerError, "login_failed", err)
+		return
+	}
+
+	if oauthState.ReturnTo != "" {
+		context.Redirect(http.StatusFound, oauthState.ReturnTo)
+		return
+	}
+	respHandler.SuccessContextMessage(context, userInfo)
+}
+
+func clearOAuthStateCookie(context *gin.Context) {
+	sessionManager.SetCookie(context, &model.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// failCallback 有 returnTo 時導回前端並附上錯誤代碼，否則回應 JSON
+func failCallback(context *gin.Context, oauthState *model.OAuthState, statusCode int, errorCode string, err error) {
+	if oauthState == nil || oauthState.ReturnTo == "" {
+		respHandler.FailContextCodeMessage(context, statusCode, gin.H{"error": errorCode}, "Authorization callback failed", err)
+		return
+	}
+
+	logger.Error("Authorization callback failed", zap.String("provider", oauthState.Provider), zap.String("error", errorCode), zap.Error(err))
+	returnTo, parseErr := url.Parse(oauthState.ReturnTo)
+	if parseErr != nil {
+		respHandler.FailContextCodeMessage(context, statusCode, gin.H{"error": errorCode}, "", parseErr)
+		return
+	}
+	q := returnTo.Query()
+	q.Set("error", errorCode)
+	returnTo.RawQuery = q.Encode()
+	context.Redirect(http.StatusFound, returnTo.String())
+}
+
+// IsAllowedRedirectURI 檢查 redirect URI 是否在 Google 設定的允許清單中（完全相符）
+func IsAllowedRedirectURI(redirectURI string) bool {
+	return identityProviders.Google().AllowsRedirectURI(redirectURI)
+}
+
+// isAllowedReturnTo 檢查登入後導回的網址是否屬於允許的前端網域
+func isAllowedReturnTo(returnTo string) bool {
+	parsed, err := url.Parse(returnTo)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	return slices.Contains(cfg.HttpAllows.Origins, parsed.Scheme+"://"+parsed.Host)
+}
+
+// codeChallengeS256 PKCE code_challenge = BASE64URL(SHA256(code_verifier))
+func codeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
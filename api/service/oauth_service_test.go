@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+)
+
+// fakeOAuthStateDao 記錄寫入與取用的 state
+type fakeOAuthStateDao struct {
+	states   map[string]model.OAuthState
+	consumed []string
+}
+
+func (f *fakeOAuthStateDao) InsertState(state model.OAuthState) error {
+	f.states[state.State] = state
+	return nil
+}
+
+func (f *fakeOAuthStateDao) ConsumeState(state string) (*model.OAuthState, error) {
+	f.consumed = append(f.consumed, state)
+	stored, ok := f.states[state]
+	if !ok {
+		return nil, errors.New("no oauth state found")
+	}
+	delete(f.states, state)
+	return &stored, nil
+}
+
+func newOAuthTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/authorize/:provider/start", StartAuthorization)
+	router.GET("/api/authorize/:provider/callback", AuthorizationCallback)
+	return router
+}
+
+func TestAuthorizationCallbackRequiresStateCookie(t *testing.T) {
+	fake := &fakeOAuthStateDao{states: map[string]model.OAuthState{}}
+	original := oauthStateDao
+	oauthStateDao = fake
+	defer func() { oauthStateDao = original }()
+
+	router := newOAuthTestRouter()
+	start := httptest.NewRecorder()
+	router.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/api/authorize/google/start", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("start status = %d, want 302", start.Code)
+	}
+
+	var state string
+	for key := range fake.states {
+		state = key
+	}
+	var stateCookie *http.Cookie
+	for _, cookie := range start.Result().Cookies() {
+		if cookie.Name == oauthStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || stateCookie.Value != hashAPIToken(state) || !stateCookie.HttpOnly || stateCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie = %+v, want HttpOnly SameSite=Lax hash of the state", stateCookie)
+	}
+
+	callback := "/api/authorize/google/callback?code=attacker-code&state=" + state
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{name: "missing cookie"},
+		{name: "other browser", cookie: &http.Cookie{Name: oauthStateCookie, Value: hashAPIToken("other-state")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, callback, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if len(fake.consumed) != 0 {
+				t.Errorf("state consumed = %v, want untouched", fake.consumed)
+			}
+		})
+	}
+
+	// 同一個瀏覽器帶著 cookie 導回時才會取用 state（此處 code 無效，僅確認通過 cookie 檢查）
+	req := httptest.NewRequest(http.MethodGet, "/api/authorize/google/callback?error=access_denied&state="+state, nil)
+	req.AddCookie(stateCookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if len(fake.consumed) != 1 || fake.consumed[0] != state {
+		t.Errorf("state consumed = %v, want [%s]", fake.consumed, state)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 access_denied", w.Code)
+	}
+	cleared := false
+	for _, cookie := range w.Result().Cookies() {
+		cleared = cleared || (cookie.Name == oauthStateCookie && cookie.MaxAge < 0)
+	}
+	if !cleared {
+		t.Error("state cookie was not cleared")
+	}
+}
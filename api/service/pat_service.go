@@ -0,0 +1,261 @@
+package service
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	personalAccessTokenPrefix = "glt_pat_"
+
+	// personal access token 可授權的 scope
+	TokenScopeCalendarRead  = "calendar:read"
+	TokenScopeCalendarWrite = "calendar:write"
+	TokenScopeProfileRead   = "profile:read"
+
+	defaultTokenExpiryDays = 90
+	maxTokenExpiryDays     = 365
+	maxTokenNameLength     = 100
+)
+
+var personalAccessTokenScopes = []string{TokenScopeCalendarRead, TokenScopeCalendarWrite, TokenScopeProfileRead}
+
+var personalAccessTokenDao dao.PersonalAccessTokenDaoInterface = dao.NewPersonalAccessTokenDao()
+
+// CreatePersonalAccessToken 建立 personal access token，token 明文只在此回應中出現一次
+func CreatePersonalAccessToken(context *gin.Context) {
+	session, err := sessionManager.GetContextOrSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	var req model.PersonalAccessTokenRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid request body"}, "", err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxTokenNameLength {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name is required and must be at most %d characters", maxTokenNameLength)}, "", nil)
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenExpiryDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxTokenExpiryDays {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expiresInDays must be between 1 and %d", maxTokenExpiryDays)}, "", nil)
+		return
+	}
+	scopes, err := normalizeTokenScopes(req.Scopes)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": err.Error(), "supported_scopes": personalAccessTokenScopes}, "", nil)
+		return
+	}
+
+	rawToken, err := utils.RandomString(32)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to create token"}, "", err)
+		return
+	}
+	tokenID, err := utils.RandomString(12)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to create token"}, "", err)
+		return
+	}
+	rawToken = personalAccessTokenPrefix + rawToken
+
+	currentTime := utils.GetCurrentTime()
+	expiryDate := currentTime.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+
+	// token 使用專屬的 session 保存 Google token，登出瀏覽器不影響 token
+	tokenSession, err := sessionManager.SaveTokenSession(session, model.SessionKindPAT, expiryDate)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to create token"}, "", err)
+		return
+	}
+
+	token := model.PersonalAccessToken{
+		TokenHash:  hashAPIToken(rawToken),
+		ID:         tokenID,
+		UserID:     session.UserID,
+		SessionID:  tokenSession.SessionID,
+		Name:       req.Name,
+		Scopes:     scopes,
+		CreateDate: currentTime,
+		ExpiryDate: expiryDate,
+		TTL:        expiryDate.Unix(),
+	}
+	if err := personalAccessTokenDao.InsertToken(token); err != nil {
+		_ = sessionManager.DeleteSession(tokenSession.SessionID)
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to create token"}, "", err)
+		return
+	}
+
+	logger.Info("Personal access token created", zap.String("userID", session.UserID), zap.String("tokenID", tokenID), zap.Strings("scopes", scopes))
+	respHandler.SuccessContextMessage(context, model.PersonalAccessTokenResponse{Token: rawToken, PersonalAccessToken: token})
+}
+
+// ListPersonalAccessTokens 列出目前使用者的 personal access token（不含 token 明文）
+func ListPersonalAccessTokens(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	tokens, err := personalAccessTokenDao.GetTokensByUserID(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to list tokens"}, "", err)
+		return
+	}
+
+	// TTL 刪除有延遲，過濾已過期的 token
+	currentTime := utils.GetCurrentTime()
+	active := make([]model.PersonalAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		if currentTime.Before(token.ExpiryDate) {
+			active = append(active, token)
+		}
+	}
+	slices.SortFunc(active, func(a, b model.PersonalAccessToken) int {
+		return b.CreateDate.Compare(a.CreateDate)
+	})
+
+	respHandler.SuccessContextMessage(context, gin.H{"tokens": active})
+}
+
+// RevokePersonalAccessToken 以 id 撤銷目前使用者的 personal access token
+func RevokePersonalAccessToken(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	tokens, err := personalAccessTokenDao.GetTokensByUserID(session.UserID)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to revoke token"}, "", err)
+		return
+	}
+
+	index := slices.IndexFunc(tokens, func(token model.PersonalAccessToken) bool {
+		return token.ID == context.Param("id")
+	})
+	if index < 0 {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "Token not found"}, "", nil)
+		return
+	}
+
+	if err := deletePersonalAccessToken(&tokens[index]); err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to revoke token"}, "", err)
+		return
+	}
+	respHandler.SuccessContextMessage(context, gin.H{"message": "Token revoked"})
+}
+
+// ResolvePersonalAccessToken 驗證 personal access token，通過時記錄於 context 等待路由宣告的 scope 檢查
+// 回應錯誤時回傳 false；非 personal access token 時回傳 handled = false
+func ResolvePersonalAccessToken(context *gin.Context) (handled bool, ok bool) {
+	rawToken := BearerToken(context)
+	if !strings.HasPrefix(rawToken, personalAccessTokenPrefix) {
+		return false, true
+	}
+	return true, resolvePersonalAccessToken(context, rawToken)
+}
+
+// resolvePersonalAccessToken 驗證 token 並記錄於 context，失敗時已回應 401
+func resolvePersonalAccessToken(context *gin.Context, rawToken string) bool {
+	token, err := personalAccessTokenDao.GetToken(hashAPIToken(rawToken))
+	if err != nil || !utils.GetCurrentTime().Before(token.ExpiryDate) {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid token"}, "Failed to resolve personal access token", err)
+		return false
+	}
+
+	session, err := sessionManager.GetSessionByID(token.SessionID)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid token"}, "Failed to get token session", err)
+		return false
+	}
+
+	// session 在路由宣告的 scope 檢查通過後才放入 context，未宣告的路由一律拒絕
+	context.Set("pat", token)
+	context.Set("patSession", session)
+	return true
+}
+
+// RequireTokenScopes 檢查 personal access token 是否具有路由宣告的 scope，非 token 請求直接通過
+func RequireTokenScopes(context *gin.Context, scopes ...string) bool {
+	value, exists := context.Get("pat")
+	if !exists {
+		return true
+	}
+	token := value.(*model.PersonalAccessToken)
+
+	var missing []string
+	for _, scope := range scopes {
+		if !slices.Contains(token.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{"error": "Token is missing required scopes", "code": "insufficient_scope", "missing_scopes": missing}, "", nil)
+		return false
+	}
+
+	session, _ := context.Get("patSession")
+	context.Set("session", session)
+	setPrincipal(context, session.(*model.Session))
+	return true
+}
+
+// revokeUserPersonalAccessTokens 撤銷使用者所有 personal access token 及其 session
+func revokeUserPersonalAccessTokens(userID string) {
+	tokens, err := personalAccessTokenDao.GetTokensByUserID(userID)
+	if err != nil {
+		logger.Error("Failed to list personal access tokens", zap.String("userID", userID), zap.Error(err))
+		return
+	}
+	for i := range tokens {
+		if err := deletePersonalAccessToken(&tokens[i]); err != nil {
+			logger.Error("Failed to revoke personal access token", zap.String("userID", userID), zap.String("tokenID", tokens[i].ID), zap.Error(err))
+		}
+	}
+}
+
+func deletePersonalAccessToken(token *model.PersonalAccessToken) error {
+	if err := personalAccessTokenDao.DeleteToken(token.TokenHash); err != nil {
+		return err
+	}
+	if err := sessionManager.DeleteSession(token.SessionID); err != nil {
+		logger.Warn("Failed to delete personal access token session", zap.String("tokenID", token.ID), zap.Error(err))
+	}
+	logger.Info("Personal access token revoked", zap.String("userID", token.UserID), zap.String("tokenID", token.ID))
+	return nil
+}
+
+// normalizeTokenScopes 檢查 scope 是否支援並去除重複
+func normalizeTokenScopes(scopes []string) ([]string, error) {
+	var normalized []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(personalAccessTokenScopes, scope) {
+			return nil, fmt.Errorf("unsupported scope: %s", scope)
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return normalized, nil
+}
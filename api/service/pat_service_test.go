@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+)
+
+// fakePersonalAccessTokenDao 以記憶體保存 personal access token
+type fakePersonalAccessTokenDao struct {
+	tokens map[string]model.PersonalAccessToken
+}
+
+func (f *fakePersonalAccessTokenDao) InsertToken(token model.PersonalAccessToken) error {
+	f.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (f *fakePersonalAccessTokenDao) GetToken(tokenHash string) (*model.PersonalAccessToken, error) {
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("no personal access token found")
+	}
+	return &token, nil
+}
+
+func (f *fakePersonalAccessTokenDao) GetTokensByUserID(userID string) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	for _, token := range f.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (f *fakePersonalAccessTokenDao) DeleteToken(tokenHash string) error {
+	delete(f.tokens, tokenHash)
+	return nil
+}
+
+func TestPersonalAccessTokenScopesAndExpiry(t *testing.T) {
+	const rawToken = personalAccessTokenPrefix + "token-1"
+	now := time.Now()
+	credential := testSession(now)
+	credential.SessionID = "pat-session-1"
+	credential.Kind = model.SessionKindPAT
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		expiryDate  time.Time
+		deleted     bool
+		routeScopes []string
+		wantStatus  int
+	}{
+		{"scope granted", []string{TokenScopeCalendarRead}, now.Add(time.Hour), false, []string{TokenScopeCalendarRead}, http.StatusOK},
+		{"all scopes granted", []string{TokenScopeCalendarRead, TokenScopeCalendarWrite}, now.Add(time.Hour), false, []string{TokenScopeCalendarRead, TokenScopeCalendarWrite}, http.StatusOK},
+		{"scope missing", []string{TokenScopeCalendarRead}, now.Add(time.Hour), false, []string{TokenScopeCalendarWrite}, http.StatusForbidden},
+		{"one of two scopes missing", []string{TokenScopeCalendarRead}, now.Add(time.Hour), false, []string{TokenScopeCalendarRead, TokenScopeProfileRead}, http.StatusForbidden},
+		// 路由未宣告 scope 時不會呼叫 RequireTokenScopes，session 不放入 context
+		{"route without scopes", []string{TokenScopeCalendarRead}, now.Add(time.Hour), false, nil, http.StatusForbidden},
+		{"expired", []string{TokenScopeCalendarRead}, now.Add(-time.Second), false, []string{TokenScopeCalendarRead}, http.StatusUnauthorized},
+		{"revoked", []string{TokenScopeCalendarRead}, now.Add(time.Hour), true, []string{TokenScopeCalendarRead}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := &fakePersonalAccessTokenDao{tokens: map[string]model.PersonalAccessToken{}}
+			if !tt.deleted {
+				_ = tokens.InsertToken(model.PersonalAccessToken{
+					TokenHash:  hashAPIToken(rawToken),
+					ID:         "token-1",
+					UserID:     credential.UserID,
+					SessionID:  credential.SessionID,
+					Scopes:     tt.scopes,
+					ExpiryDate: tt.expiryDate,
+				})
+			}
+			originalManager, originalDao := sessionManager, personalAccessTokenDao
+			sessionManager = NewSessionManager(newFakeSessionDao(credential), testSessionPolicy(), zap.NewNop())
+			personalAccessTokenDao = tokens
+			t.Cleanup(func() {
+				sessionManager, personalAccessTokenDao = originalManager, originalDao
+			})
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/api/events", func(context *gin.Context) {
+				handled, ok := ResolvePersonalAccessToken(context)
+				if !handled || !ok {
+					return
+				}
+				if tt.routeScopes != nil && !RequireTokenScopes(context, tt.routeScopes...) {
+					return
+				}
+				session, err := utils.GetSessionFromContext(context)
+				if err != nil {
+					context.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+				if principal, err := GetPrincipal(context); err != nil || principal.SessionID != credential.SessionID {
+					t.Errorf("principal = %+v, %v", principal, err)
+				}
+				context.String(http.StatusOK, session.SessionID)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+			req.Header.Set("Authorization", "Bearer "+rawToken)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusForbidden && tt.routeScopes != nil && !strings.Contains(w.Body.String(), "insufficient_scope") {
+				t.Errorf("body = %s, want insufficient_scope", w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != credential.SessionID {
+				t.Errorf("session = %q, want %q", w.Body.String(), credential.SessionID)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// setPrincipal 將目前請求的身分放入 context，角色於 RequireRole 時才讀取
+func setPrincipal(context *gin.Context, session *model.Session) {
+	context.Set("principal", &model.Principal{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+	})
+}
+
+// GetPrincipal 取得 ValidateSession 放入 context 的身分
+func GetPrincipal(context *gin.Context) (*model.Principal, error) {
+	value, exists := context.Get("principal")
+	if !exists {
+		return nil, fmt.Errorf("failed to get principal from context")
+	}
+	principal, ok := value.(*model.Principal)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert principal to *model.Principal")
+	}
+	return principal, nil
+}
+
+// RequireRole 檢查目前使用者是否具有角色，未通過時回應 401/403 並回傳 false
+// 角色以 Users table 為準，變更後立即生效，不需重新登入
+func RequireRole(context *gin.Context, role string) bool {
+	principal, err := GetPrincipal(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return false
+	}
+
+	user, err := userDao.GetUserByID(principal.UserID)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{"error": "Permission denied", "code": "forbidden"}, "Failed to get user for role check", err)
+		return false
+	}
+	principal.Role = user.Role
+
+	if !user.HasRole(role) {
+		logger.Warn("Role check failed",
+			zap.String("userID", principal.UserID),
+			zap.String("role", user.Role),
+			zap.String("required", role),
+			zap.String("path", context.Request.URL.Path),
+		)
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{"error": "Permission denied", "code": "forbidden"}, "", nil)
+		return false
+	}
+	return true
+}
+
+// isBootstrapAdmin 已驗證的 email 在 admin.bootstrap_emails 設定中
+// 依 trust_email 視為已驗證的 email 可能由使用者自行設定，不授予 admin
+func isBootstrapAdmin(userInfo *model.GoogleUserInfo) bool {
+	if !userInfo.VerifiedEmail || userInfo.TrustedEmail || userInfo.Email == "" {
+		return false
+	}
+	for _, email := range cfg.Admin.BootstrapEmails {
+		if strings.EqualFold(email, userInfo.Email) {
+			logger.Info("Bootstrap admin signed in", zap.String("userID", userInfo.ID), zap.String("email", userInfo.Email))
+			return true
+		}
+	}
+	return false
+}
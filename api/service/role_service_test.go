@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"glt-calendar-service/api/model"
+)
+
+func TestIsBootstrapAdminRequiresProviderVerifiedEmail(t *testing.T) {
+	original := cfg.Admin.BootstrapEmails
+	cfg.Admin.BootstrapEmails = []string{"admin@example.com"}
+	defer func() { cfg.Admin.BootstrapEmails = original }()
+
+	tests := []struct {
+		name     string
+		userInfo model.GoogleUserInfo
+		want     bool
+	}{
+		{name: "verified", userInfo: model.GoogleUserInfo{Email: "Admin@example.com", VerifiedEmail: true}, want: true},
+		{name: "unverified", userInfo: model.GoogleUserInfo{Email: "admin@example.com"}, want: false},
+		{name: "trusted by config", userInfo: model.GoogleUserInfo{Email: "admin@example.com", VerifiedEmail: true, TrustedEmail: true}, want: false},
+		{name: "not listed", userInfo: model.GoogleUserInfo{Email: "user@example.com", VerifiedEmail: true}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBootstrapAdmin(&tt.userInfo); got != tt.want {
+				t.Errorf("isBootstrapAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/calendar"
+	"glt-calendar-service/api/identity"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// featureScopes 功能所需的 OAuth scope，任一 scope 已授權即可使用；第一個為請求增量授權時使用的 scope
+var featureScopes = map[string][]string{
+	"calendar.read": {
+		"https://www.googleapis.com/auth/calendar.readonly",
+		"https://www.googleapis.com/auth/calendar.events.readonly",
+		"https://www.googleapis.com/auth/calendar.events",
+		"https://www.googleapis.com/auth/calendar",
+	},
+	"calendar.write": {
+		"https://www.googleapis.com/auth/calendar.events",
+		"https://www.googleapis.com/auth/calendar",
+	},
+	"tasks": {
+		"https://www.googleapis.com/auth/tasks",
+	},
+	"people": {
+		"https://www.googleapis.com/auth/user.phonenumbers.read",
+	},
+}
+
+// graphFeatureScopes Microsoft Graph 的功能 scope，token 回應可能包含或省略 resource 前綴
+var graphFeatureScopes = map[string][]string{
+	"calendar.read": {
+		"https://graph.microsoft.com/Calendars.ReadWrite",
+		"https://graph.microsoft.com/Calendars.Read",
+		"Calendars.ReadWrite",
+		"Calendars.Read",
+	},
+	"calendar.write": {
+		"https://graph.microsoft.com/Calendars.ReadWrite",
+		"Calendars.ReadWrite",
+	},
+}
+
+// featureScopesFor 登入提供者的功能 scope，沒有對應 API 的提供者回傳 nil
+func featureScopesFor(provider string) map[string][]string {
+	switch provider {
+	case identity.GoogleProviderName:
+		return featureScopes
+	case calendar.MicrosoftProviderName:
+		return graphFeatureScopes
+	}
+	return nil
+}
+
+// GetGrantedScopes returns the granted scopes of the session and which features are available
+// Query feature (comma separated) and redirectUri build the incremental consent URL for missing features
+func GetGrantedScopes(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	granted := session.GrantedScopes()
+	providerScopes := featureScopesFor(sessionProvider(session))
+	features := make(map[string]bool, len(providerScopes))
+	for feature, scopes := range providerScopes {
+		features[feature] = model.HasAnyScope(granted, scopes...)
+	}
+
+	result := gin.H{
+		"scopes":   granted,
+		"features": features,
+	}
+
+	if query := context.Query("feature"); query != "" {
+		var requested []string
+		for _, feature := range strings.Split(query, ",") {
+			requested = append(requested, strings.TrimSpace(feature))
+		}
+		missing := missingFeatureScopes(providerScopes, granted, requested...)
+		result["missing_scopes"] = missing
+		// 增量授權網址只支援 Google
+		if len(missing) > 0 && sessionProvider(session) == identity.GoogleProviderName {
+			result["authorization_url"] = BuildAuthorizationURL(model.AuthorizationRequest{Scopes: missing, RedirectURI: context.Query("redirectUri")})
+		}
+	}
+
+	respHandler.SuccessContextMessage(context, result)
+}
+
+// RequireScopes 檢查 session 是否已授權功能所需 scope，未授權時回應 403 並回傳 false
+// 舊 session 沒有 scope 資訊時不阻擋
+func RequireScopes(context *gin.Context, features ...string) bool {
+	session, err := sessionManager.CurrentSession(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid session"}, "Failed to get session", err)
+		return false
+	}
+
+	// 連結帳號檢查該帳號授權的 scope；accountId=all 在查詢時逐一檢查
+	if accountID := context.Query("accountId"); accountID == allAccounts {
+		return true
+	} else if accountID != "" && accountID != session.UserID {
+		return requireLinkedAccountScopes(context, session.UserID, accountID, features...)
+	}
+
+	granted := session.GrantedScopes()
+	// CalDAV 以帳密存取，與 OAuth scope 無關
+	if len(granted) == 0 || context.Query("provider") == calendar.CalDAVProviderName {
+		return true
+	}
+
+	provider := sessionProvider(session)
+	missing := missingFeatureScopes(featureScopesFor(provider), granted, features...)
+	if len(missing) == 0 {
+		return true
+	}
+
+	if provider != identity.GoogleProviderName {
+		// 其他提供者需重新登入並同意新的 scope
+		respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{
+			"error":          "Insufficient OAuth scopes",
+			"missing_scopes": missing,
+		}, "Missing OAuth scopes: "+strings.Join(missing, " "), nil)
+		return false
+	}
+	RespondMissingScopes(context, missing)
+	return false
+}
+
+// RespondMissingScopes 回應標準的 403，包含缺少的 scope 與增量授權網址
+func RespondMissingScopes(context *gin.Context, missing []string) {
+	respHandler.FailContextCodeMessage(context, http.StatusForbidden, gin.H{
+		"error":             "Insufficient OAuth scopes",
+		"missing_scopes":    missing,
+		"authorization_url": BuildAuthorizationURL(model.AuthorizationRequest{Scopes: missing, RedirectURI: context.Query("redirectUri")}),
+	}, "Missing OAuth scopes: "+strings.Join(missing, " "), nil)
+}
+
+// BuildAuthorizationURL 建立 Google 授權網址，include_granted_scopes 讓新授權保留既有 scope
+func BuildAuthorizationURL(request model.AuthorizationRequest) string {
+	if !IsAllowedRedirectURI(request.RedirectURI) {
+		request.RedirectURI = cfg.GoogleOAuth2.RedirectURI
+	}
+	// Google 使用固定端點，不會失敗
+	authorizationURL, _ := buildProviderAuthorizationURL(context.Background(), identityProviders.Google(), request)
+	return authorizationURL
+}
+
+// buildProviderAuthorizationURL 建立提供者的授權網址，redirect URI 需由呼叫端檢查
+func buildProviderAuthorizationURL(ctx context.Context, provider identity.IdentityProvider, request model.AuthorizationRequest) (string, error) {
+	metadata, err := provider.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	for key, values := range provider.AuthorizationParams() {
+		q[key] = values
+	}
+	q.Set("client_id", provider.ClientID())
+	q.Set("redirect_uri", request.RedirectURI)
+	q.Set("response_type", "code")
+	q.Set("scope", strings.Join(request.Scopes, " "))
+	if request.State != "" {
+		q.Set("state", request.State)
+	}
+	if request.CodeChallenge != "" {
+		q.Set("code_challenge", request.CodeChallenge)
+		q.Set("code_challenge_method", "S256")
+	}
+	if request.Nonce != "" {
+		q.Set("nonce", request.Nonce)
+	}
+	if request.Prompt != "" {
+		q.Set("prompt", request.Prompt)
+	}
+	return metadata.AuthorizationEndpoint + "?" + q.Encode(), nil
+}
+
+// missingFeatureScopes 回傳未授權功能的首選 scope，providerScopes 中沒有的功能不檢查
+func missingFeatureScopes(providerScopes map[string][]string, granted []string, features ...string) []string {
+	var missing []string
+	for _, feature := range features {
+		scopes, ok := providerScopes[feature]
+		if !ok || len(scopes) == 0 {
+			continue
+		}
+		if !model.HasAnyScope(granted, scopes...) {
+			missing = append(missing, scopes[0])
+		}
+	}
+	return model.MergeScopes(nil, missing)
+}
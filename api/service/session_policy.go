@@ -0,0 +1,137 @@
+package service
+
+import (
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionPolicy defines session lifetimes: idle timeout, absolute lifetime and sliding refresh
+type SessionPolicy struct {
+	IdleTimeout                time.Duration
+	AbsoluteLifetime           time.Duration
+	RememberMeIdleTimeout      time.Duration
+	RememberMeAbsoluteLifetime time.Duration
+	// RefreshThreshold 距上次延長超過此時間才延長效期，避免每個請求都寫入 DynamoDB
+	RefreshThreshold time.Duration
+	// CookieSameSite cookie 的 SameSite 屬性
+	CookieSameSite http.SameSite
+}
+
+// NewSessionPolicy creates a SessionPolicy from config, missing values fall back to defaults
+func NewSessionPolicy(config env.SigningConfig) SessionPolicy {
+	policy := SessionPolicy{
+		IdleTimeout:                hoursOrDefault(config.TTL, 24),
+		AbsoluteLifetime:           hoursOrDefault(config.AbsoluteTTL, 7*24),
+		RememberMeIdleTimeout:      hoursOrDefault(config.RememberMeTTL, 30*24),
+		RememberMeAbsoluteLifetime: hoursOrDefault(config.RememberMeAbsoluteTTL, 90*24),
+		RefreshThreshold:           time.Duration(config.RefreshThreshold) * time.Minute,
+		CookieSameSite:             parseSameSite(config.CookieSameSite),
+	}
+
+	// 最長有效時間不得小於閒置逾時
+	if policy.AbsoluteLifetime < policy.IdleTimeout {
+		policy.AbsoluteLifetime = policy.IdleTimeout
+	}
+	if policy.RememberMeAbsoluteLifetime < policy.RememberMeIdleTimeout {
+		policy.RememberMeAbsoluteLifetime = policy.RememberMeIdleTimeout
+	}
+	return policy
+}
+
+// parseSameSite 未設定或無法辨識時使用 Lax
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func hoursOrDefault(hours, defaultHours int) time.Duration {
+	if hours <= 0 {
+		hours = defaultHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// Start sets the expiry of a new session
+func (p SessionPolicy) Start(session *model.Session, now time.Time) {
+	absolute := p.AbsoluteLifetime
+	if session.RememberMe {
+		absolute = p.RememberMeAbsoluteLifetime
+	}
+	session.AbsoluteExpiryDate = now.Add(absolute)
+	p.Extend(session, now)
+}
+
+// Extend slides the expiry by the idle timeout, capped at the absolute expiry
+func (p SessionPolicy) Extend(session *model.Session, now time.Time) {
+	idle := p.IdleTimeout
+	if session.RememberMe {
+		idle = p.RememberMeIdleTimeout
+	}
+
+	expiry := now.Add(idle)
+	if absolute := p.absoluteExpiry(session); expiry.After(absolute) {
+		expiry = absolute
+	}
+
+	session.ExpiryDate = expiry
+	session.LastSeenDate = now
+	session.TTL = expiry.Unix()
+}
+
+// Renew extends the session on a new login; turning on remember me restarts the absolute lifetime
+// with the remember me value, otherwise the session stays capped at its current absolute expiry
+func (p SessionPolicy) Renew(session *model.Session, rememberMe bool, now time.Time) {
+	if rememberMe && !session.RememberMe {
+		session.RememberMe = true
+		p.Start(session, now)
+		return
+	}
+	p.Extend(session, now)
+}
+
+// ShouldExtend reports whether the session was last extended longer than the refresh threshold ago
+func (p SessionPolicy) ShouldExtend(session *model.Session, now time.Time) bool {
+	// 已達最長有效時間，無法再延長
+	if !session.ExpiryDate.Before(p.absoluteExpiry(session)) {
+		return false
+	}
+
+	lastExtended := session.LastSeenDate
+	if lastExtended.IsZero() {
+		lastExtended = session.UpdateDate
+	}
+	return now.Sub(lastExtended) >= p.RefreshThreshold
+}
+
+// CookieMaxAge 記住我使用持久 cookie，其餘使用瀏覽器 session cookie（MaxAge 0）
+func (p SessionPolicy) CookieMaxAge(session *model.Session, now time.Time) int {
+	if !session.RememberMe {
+		return 0
+	}
+	maxAge := int(session.ExpiryDate.Sub(now).Seconds())
+	if maxAge <= 0 {
+		return -1
+	}
+	return maxAge
+}
+
+// absoluteExpiry 舊 session 沒有最長有效時間時，以建立時間計算
+func (p SessionPolicy) absoluteExpiry(session *model.Session) time.Time {
+	if !session.AbsoluteExpiryDate.IsZero() {
+		return session.AbsoluteExpiryDate
+	}
+	absolute := p.AbsoluteLifetime
+	if session.RememberMe {
+		absolute = p.RememberMeAbsoluteLifetime
+	}
+	return session.CreateDate.Add(absolute)
+}
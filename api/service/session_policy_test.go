@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"glt-calendar-service/api/model"
+)
+
+func TestSessionPolicyRenew(t *testing.T) {
+	policy := testSessionPolicy()
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	now := created.Add(2 * time.Hour)
+
+	tests := []struct {
+		name         string
+		rememberMe   bool
+		remembered   bool
+		wantAbsolute time.Time
+		wantExpiry   time.Time
+	}{
+		{
+			name:         "upgrade to remember me restarts the absolute lifetime",
+			rememberMe:   true,
+			wantAbsolute: now.Add(policy.RememberMeAbsoluteLifetime),
+			wantExpiry:   now.Add(policy.RememberMeIdleTimeout),
+		},
+		{
+			name:         "without remember me keeps the absolute cap",
+			wantAbsolute: created.Add(policy.AbsoluteLifetime),
+			wantExpiry:   now.Add(policy.IdleTimeout),
+		},
+		{
+			name:         "already remembered keeps the absolute cap",
+			rememberMe:   true,
+			remembered:   true,
+			wantAbsolute: created.Add(policy.RememberMeAbsoluteLifetime),
+			wantExpiry:   now.Add(policy.RememberMeIdleTimeout),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &model.Session{CreateDate: created, RememberMe: tt.remembered}
+			policy.Start(session, created)
+
+			policy.Renew(session, tt.rememberMe, now)
+			if !session.AbsoluteExpiryDate.Equal(tt.wantAbsolute) {
+				t.Errorf("absolute expiry = %v, want %v", session.AbsoluteExpiryDate, tt.wantAbsolute)
+			}
+			if !session.ExpiryDate.Equal(tt.wantExpiry) {
+				t.Errorf("expiry = %v, want %v", session.ExpiryDate, tt.wantExpiry)
+			}
+			if session.RememberMe != (tt.rememberMe || tt.remembered) {
+				t.Errorf("remember me = %v", session.RememberMe)
+			}
+		})
+	}
+}
@@ -1,53 +1,119 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/metrics"
 	"glt-calendar-service/api/model"
 	"glt-calendar-service/utils"
 	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"sort"
 	"time"
 )
 
+// maxSessionUpdateAttempts 版本衝突時的最大嘗試次數
+const maxSessionUpdateAttempts = 3
+
 // SessionManager handles all session-related operations
 type SessionManager struct {
 	sessionDao dao.SessionDaoInterface
+	policy     SessionPolicy
 	logger     *zap.Logger
 }
 
 // NewSessionManager creates a new SessionManager instance
-func NewSessionManager(sessionDao dao.SessionDaoInterface, logger *zap.Logger) *SessionManager {
+func NewSessionManager(sessionDao dao.SessionDaoInterface, policy SessionPolicy, logger *zap.Logger) *SessionManager {
 	return &SessionManager{
 		sessionDao: sessionDao,
+		policy:     policy,
 		logger:     logger,
 	}
 }
 
 // GetContextOrSession retrieves session from context or cookies
+// The session read from DynamoDB is cached in the context, a request reads the session at most once
+// A stateless session restored from the session token is replaced by the full session
 func (sm *SessionManager) GetContextOrSession(context *gin.Context) (*model.Session, error) {
 	session, err := utils.GetSessionFromContext(context)
 	if session != nil && err == nil {
-		return session, nil
+		if !session.Stateless {
+			metrics.Incr(metrics.SessionCacheHit)
+			return session, nil
+		}
+		return sm.loadStatelessSession(context, session)
 	}
 
 	session, err = sm.GetSession(context)
 	if session != nil && err == nil {
+		context.Set("session", session)
 		return session, nil
 	}
 	return nil, err
 }
 
-// GetSession retrieves session from cookies
+// CurrentSession returns the session of the request for identity checks
+// In stateless mode the session may be restored from the session token without reading DynamoDB
+func (sm *SessionManager) CurrentSession(context *gin.Context) (*model.Session, error) {
+	if session, err := utils.GetSessionFromContext(context); err == nil {
+		return session, nil
+	}
+	if BearerToken(context) == "" {
+		if session, err := sessionTokens.SessionFromRequest(context); err == nil {
+			context.Set("session", session)
+			return session, nil
+		}
+	}
+	return sm.GetContextOrSession(context)
+}
+
+// loadStatelessSession 讀取 session token 對應的完整 session，執行個體內有快取時不查詢 DynamoDB
+func (sm *SessionManager) loadStatelessSession(context *gin.Context, stateless *model.Session) (*model.Session, error) {
+	session := sessionTokens.CachedSession(stateless.SessionID)
+	if session != nil {
+		metrics.Incr(metrics.SessionCacheHit)
+	} else {
+		var err error
+		if session, err = sm.GetSessionByID(stateless.SessionID); err != nil {
+			return nil, err
+		}
+		sessionTokens.UpdateCachedSession(session)
+	}
+
+	context.Set("session", session)
+	return session, nil
+}
+
+// GetSession retrieves session from the bearer token or cookies
 func (sm *SessionManager) GetSession(context *gin.Context) (*model.Session, error) {
+	// Bearer token（非瀏覽器用戶端）優先於 cookie
+	if token := BearerToken(context); token != "" {
+		apiToken, err := resolveBearerToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return sm.GetSessionByID(apiToken.SessionID)
+	}
+
 	// From cookie get session_id
 	sessionID, err := context.Cookie("session_id")
 	if err != nil {
 		return nil, err
 	}
 
+	return sm.GetSessionByID(sessionID)
+}
+
+// GetSessionByID retrieves session by session id and removes it if expired
+func (sm *SessionManager) GetSessionByID(sessionID string) (*model.Session, error) {
 	// Get Session Id
+	metrics.Incr(metrics.SessionRead)
 	session, err := sm.sessionDao.GetSessionsBySessionID(sessionID)
 
 	// if not found data
@@ -62,21 +128,19 @@ func (sm *SessionManager) GetSession(context *gin.Context) (*model.Session, erro
 		if err != nil {
 			return nil, err
 		}
-		return nil, fmt.Errorf("session expired")
+		return nil, fmt.Errorf("session expired: %w", dao.ErrSessionNotFound)
 	}
 
 	return session, nil
 }
 
-// SaveSession creates and saves a new session
-func (sm *SessionManager) SaveSession(userId string, data *model.SessionData, expiry time.Duration) (string, error) {
+// SaveSession creates and saves a new session of the identity provider, the expiry follows the session policy
+func (sm *SessionManager) SaveSession(userId, provider string, data *model.SessionData, device model.SessionDevice, rememberMe bool) (*model.Session, error) {
 	sessionID := uuid.New().String()
-
-	// session 效期設置
-	expiryTime := time.Now().Add(expiry)
-
-	// 計算 TTL 值（Unix 時間戳）
-	ttl := expiryTime.Unix()
+	csrfToken, err := utils.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create session Struct
 	currentTime := utils.GetCurrentTime()
@@ -84,37 +148,234 @@ func (sm *SessionManager) SaveSession(userId string, data *model.SessionData, ex
 		SessionID:  sessionID,
 		UserID:     userId,
 		Data:       data,
+		UserAgent:  device.UserAgent,
+		IPAddress:  device.IPAddress,
 		CreateDate: currentTime,
 		UpdateDate: currentTime,
-		ExpiryDate: expiryTime,
-		TTL:        ttl,
+		RememberMe: rememberMe,
+		Version:    1,
+		Provider:   provider,
+		CSRFToken:  csrfToken,
 	}
 
-	err := sm.sessionDao.InsertSession(saveSession)
+	// session 效期設置（閒置逾時與最長有效時間）
+	sm.policy.Start(&saveSession, currentTime)
+
+	metrics.Incr(metrics.SessionWrite)
+	err = sm.sessionDao.InsertSession(saveSession)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	sm.logger.Info("Session created successfully", zap.String("sessionID", sessionID))
 
-	return sessionID, nil
+	return &saveSession, nil
 }
 
-// UpdateSession updates an existing session
+// UpdateSession saves changes of an existing session without extending its expiry
+// On a version conflict the latest session is re-read and merged with the changes, then retried
 func (sm *SessionManager) UpdateSession(session *model.Session) error {
+	// 由 session token 還原的 session 沒有 Google token，寫回會覆蓋資料
+	if session.Stateless {
+		return fmt.Errorf("stateless session %s cannot be saved", session.SessionID)
+	}
+
+	for attempt := 1; ; attempt++ {
+		session.UpdateDate = utils.GetCurrentTime()
+
+		metrics.Incr(metrics.SessionWrite)
+		err := sm.sessionDao.UpdateSession(*session)
+		if err == nil {
+			session.Version++
+			sessionTokens.UpdateCachedSession(session)
+			sm.logger.Info("Session updated successfully", zap.String("sessionID", session.SessionID))
+			return nil
+		}
+		if !errors.Is(err, dao.ErrSessionVersionConflict) || attempt >= maxSessionUpdateAttempts {
+			return err
+		}
+
+		sm.logger.Warn("Session version conflict, merging with the latest session",
+			zap.String("sessionID", session.SessionID),
+			zap.Int64("version", session.Version),
+			zap.Int("attempt", attempt),
+		)
+
+		metrics.Incr(metrics.SessionRead)
+		latest, err := sm.sessionDao.GetSessionsBySessionID(session.SessionID)
+		if err != nil {
+			return err
+		}
+		*session = *mergeSession(latest, session)
+	}
+}
+
+// mergeSession 將本次請求的變更合併到最新的 session，避免覆蓋其他請求寫入的 token
+func mergeSession(latest, local *model.Session) *model.Session {
+	merged := *latest
+
+	// 效期與最後使用時間取較晚者
+	if local.ExpiryDate.After(merged.ExpiryDate) {
+		merged.ExpiryDate = local.ExpiryDate
+		merged.TTL = local.TTL
+	}
+	if local.AbsoluteExpiryDate.After(merged.AbsoluteExpiryDate) {
+		merged.AbsoluteExpiryDate = local.AbsoluteExpiryDate
+	}
+	if local.LastSeenDate.After(merged.LastSeenDate) {
+		merged.LastSeenDate = local.LastSeenDate
+		merged.IPAddress = local.IPAddress
+	}
+	merged.RememberMe = merged.RememberMe || local.RememberMe
+
+	if local.Data == nil {
+		return &merged
+	}
+	if merged.Data == nil {
+		merged.Data = local.Data
+		return &merged
+	}
+
+	data := *merged.Data
+	merged.Data = &data
+	scopes := model.MergeScopes(latest.GrantedScopes(), local.GrantedScopes())
+	if !slices.Equal(scopes, model.MergeScopes(nil, latest.GrantedScopes())) {
+		// 本次請求新增了 scope，最新 session 的 profile 是以較少的 scope 取得
+		data.Profile = nil
+	}
+	data.Scopes = scopes
+	if local.Data.UserInfo != nil {
+		data.UserInfo = local.Data.UserInfo
+	}
+	// 只採用以相同 scope 取得的 profile，FieldErrors 依取得時的 scope 判斷
+	localProfile := local.Data.Profile
+	if localProfile != nil && slices.Equal(scopes, model.MergeScopes(nil, local.GrantedScopes())) &&
+		(data.Profile == nil || localProfile.FetchedAt.After(data.Profile.FetchedAt)) {
+		data.Profile = localProfile
+	}
+
+	// token 取較新取得者；refresh token 只在新的 token 沒有時沿用
+	localToken, latestToken := local.Data.TokenResponse, data.TokenResponse
+	if localToken != nil && (latestToken == nil || localToken.CreatedAt.After(latestToken.CreatedAt)) {
+		token := *localToken
+		if token.RefreshToken == "" && latestToken != nil {
+			token.RefreshToken = latestToken.RefreshToken
+		}
+		data.TokenResponse = &token
+	}
+	return &merged
+}
+
+// setGrantedScopes 更新已授權的 scope，scope 改變時清除快取的 profile
+// profile 的 FieldErrors（例如 missing_scope）依取得時的 scope 判斷，需以新的 scope 重新取得
+func setGrantedScopes(session *model.Session, scopes []string) {
+	scopes = model.MergeScopes(nil, scopes)
+	if !slices.Equal(scopes, model.MergeScopes(nil, session.GrantedScopes())) {
+		session.Data.Profile = nil
+	}
+	session.Data.Scopes = scopes
+}
+
+// SaveTokenSession creates a non-browser session of the given kind (personal access token or notification)
+// The Google token is copied from the source session, the expiry follows the caller instead of the session policy
+func (sm *SessionManager) SaveTokenSession(source *model.Session, kind string, expiryDate time.Time) (*model.Session, error) {
+	// 複製 Data 與 TokenResponse，避免與來源 session 共用同一份資料
+	var data model.Session
+	copySession(&data, &model.Session{Data: source.Data})
+
+	currentTime := utils.GetCurrentTime()
+	tokenSession := model.Session{
+		SessionID:          uuid.New().String(),
+		UserID:             source.UserID,
+		Data:               data.Data,
+		UserAgent:          tokenSessionUserAgent(kind),
+		CreateDate:         currentTime,
+		UpdateDate:         currentTime,
+		LastSeenDate:       currentTime,
+		ExpiryDate:         expiryDate,
+		AbsoluteExpiryDate: expiryDate,
+		Version:            1,
+		Kind:               kind,
+		Provider:           source.Provider,
+		TTL:                expiryDate.Unix(),
+	}
+
+	metrics.Incr(metrics.SessionWrite)
+	if err := sm.sessionDao.InsertSession(tokenSession); err != nil {
+		return nil, err
+	}
+	return &tokenSession, nil
+}
+
+// tokenSessionUserAgent 非瀏覽器 session 沒有 User-Agent，以用途代替
+func tokenSessionUserAgent(kind string) string {
+	if kind == model.SessionKindNotification {
+		return "notification-scheduler"
+	}
+	return "personal-access-token"
+}
+
+// ExtendTokenSession extends the expiry of a non-browser session, only expiry and TTL are written
+func (sm *SessionManager) ExtendTokenSession(session *model.Session, expiryDate time.Time) error {
+	session.ExpiryDate = expiryDate
+	session.AbsoluteExpiryDate = expiryDate
 	session.UpdateDate = utils.GetCurrentTime()
-	session.ExpiryDate = utils.GetCurrentTime().Add(24 * time.Hour)
-	session.TTL = session.ExpiryDate.Unix()
+	session.TTL = expiryDate.Unix()
 
-	err := sm.sessionDao.UpdateSession(*session)
+	metrics.Incr(metrics.SessionWrite)
+	version, err := sm.sessionDao.TouchSession(*session)
 	if err != nil {
 		return err
 	}
-
-	sm.logger.Info("Session updated successfully", zap.String("sessionID", session.SessionID))
+	if version == session.Version+1 {
+		session.Version = version
+	}
 	return nil
 }
 
+// ExtendSession slides the session expiry when past the refresh threshold
+// Only last seen, expiry and TTL are written (partial update), returns whether the session was extended
+func (sm *SessionManager) ExtendSession(session *model.Session) (bool, error) {
+	// personal access token 與通知排程的 session 效期另外管理，不滑動延長
+	if session.IsCredentialSession() {
+		return false, nil
+	}
+
+	currentTime := utils.GetCurrentTime()
+	if !sm.policy.ShouldExtend(session, currentTime) {
+		metrics.Incr(metrics.SessionExtendSkipped)
+		return false, nil
+	}
+
+	sm.policy.Extend(session, currentTime)
+	session.UpdateDate = currentTime
+
+	metrics.Incr(metrics.SessionWrite)
+	version, err := sm.sessionDao.TouchSession(*session)
+	if err != nil {
+		return false, err
+	}
+	// 期間有其他寫入時保留舊版本，之後的 UpdateSession 會重新讀取並合併
+	if version == session.Version+1 {
+		session.Version = version
+	}
+	sessionTokens.UpdateCachedSession(session)
+	return true, nil
+}
+
+// SetSessionCookie sets the session cookie, MaxAge follows the session policy
+func (sm *SessionManager) SetSessionCookie(context *gin.Context, session *model.Session) {
+	sm.SetCookie(context, &model.Cookie{
+		Name:     "session_id",
+		Value:    session.SessionID,
+		MaxAge:   sm.policy.CookieMaxAge(session, utils.GetCurrentTime()),
+		Path:     "/",
+		Domain:   "",
+		Secure:   false,
+		HttpOnly: true,
+	})
+}
+
 // DeleteSession deletes a session and its cookie
 func (sm *SessionManager) DeleteSession(sessionID string) error {
 	err := sm.sessionDao.DeleteSession(sessionID)
@@ -122,19 +383,116 @@ func (sm *SessionManager) DeleteSession(sessionID string) error {
 		return err
 	}
 
+	// 無狀態模式下已簽發的 session token 需加入撤銷清單，否則其他執行個體仍會接受
+	if err := sessionTokens.RevokeSession(sessionID); err != nil {
+		return err
+	}
+
 	sm.logger.Info("Session deleted successfully", zap.String("sessionID", sessionID))
 
 	return nil
 }
 
+// ListUserSessions lists the active sessions of a user, the current session is flagged
+func (sm *SessionManager) ListUserSessions(userID, currentSessionID string) ([]model.SessionSummary, error) {
+	sessions, err := sm.sessionDao.ListSessionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]model.SessionSummary, 0, len(sessions))
+	for _, session := range sessions {
+		// TTL 刪除有延遲，過濾已過期的 session
+		// personal access token 與通知排程的 session 另外管理
+		if session.IsSessionExpired() || session.IsCredentialSession() {
+			continue
+		}
+		summaries = append(summaries, model.SessionSummary{
+			ID:           SessionHandle(session.SessionID),
+			UserAgent:    session.UserAgent,
+			IPAddress:    session.IPAddress,
+			CreateDate:   session.CreateDate,
+			LastSeenDate: session.LastSeenDate,
+			ExpiryDate:   session.ExpiryDate,
+			Current:      session.SessionID == currentSessionID,
+		})
+	}
+
+	// 最近使用的排在前面
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastSeenDate.After(summaries[j].LastSeenDate)
+	})
+	return summaries, nil
+}
+
+// FindUserSession finds a session of the user by its handle, the returned session has no data
+func (sm *SessionManager) FindUserSession(userID, handle string) (*model.Session, error) {
+	sessions, err := sm.sessionDao.ListSessionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		if !sessions[i].IsCredentialSession() && SessionHandle(sessions[i].SessionID) == handle {
+			return &sessions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no session found")
+}
+
+// DeleteUserSessions deletes all sessions of a user except keepSessionID, returns the deleted count
+// Sessions backing personal access tokens and notifications are kept, they are revoked with the token or the notification settings
+func (sm *SessionManager) DeleteUserSessions(userID, keepSessionID string) (int, error) {
+	sessions, err := sm.sessionDao.ListSessionsByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, session := range sessions {
+		if session.SessionID == keepSessionID || session.IsCredentialSession() {
+			continue
+		}
+		if err := sm.DeleteSession(session.SessionID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// SessionHandle 以 session id 的雜湊值作為對外識別，避免將 session id 暴露給前端
+func SessionHandle(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// DeviceFromContext 取得請求的裝置資訊
+func DeviceFromContext(context *gin.Context) model.SessionDevice {
+	return model.SessionDevice{
+		UserAgent: context.Request.UserAgent(),
+		IPAddress: context.ClientIP(),
+	}
+}
+
 // SetCookie sets a cookie in the response
+// SameSite defaults to the session policy, SameSite=None always requires Secure
 func (sm *SessionManager) SetCookie(context *gin.Context, cookie *model.Cookie) {
 	secure, httpOnly := cookie.Secure, cookie.HttpOnly
 
 	if gin.Mode() == gin.ReleaseMode {
-		secure, httpOnly = true, true
+		secure = true
+	}
+
+	sameSite := cookie.SameSite
+	if sameSite == 0 {
+		sameSite = sm.policy.CookieSameSite
+	}
+	if sameSite == http.SameSiteNoneMode {
+		secure = true
 	}
 
+	context.SetSameSite(sameSite)
 	context.SetCookie(
 		cookie.Name,
 		cookie.Value,
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/model"
+	"go.uber.org/zap"
+)
+
+// fakeSessionDao 以記憶體模擬 Sessions 資料表的 version 條件寫入
+// beforeUpdate 在每次 UpdateSession 檢查版本前、持有鎖時執行，用來模擬其他請求搶先寫入
+type fakeSessionDao struct {
+	mu           sync.Mutex
+	sessions     map[string]model.Session
+	updates      int
+	beforeUpdate func(f *fakeSessionDao, attempt int)
+}
+
+func newFakeSessionDao(sessions ...model.Session) *fakeSessionDao {
+	f := &fakeSessionDao{sessions: map[string]model.Session{}}
+	for _, session := range sessions {
+		f.sessions[session.SessionID] = cloneSession(session)
+	}
+	return f
+}
+
+func (f *fakeSessionDao) GetSessionsBySessionID(sessionID string) (*model.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, dao.ErrSessionNotFound
+	}
+	clone := cloneSession(session)
+	return &clone, nil
+}
+
+// ListSessionsByUserID 與 DAO 相同，不回傳 data
+func (f *fakeSessionDao) ListSessionsByUserID(userID string) ([]model.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var sessions []model.Session
+	for _, session := range f.sessions {
+		if session.UserID == userID {
+			session.Data = nil
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionDao) InsertSession(session model.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions[session.SessionID] = cloneSession(session)
+	return nil
+}
+
+func (f *fakeSessionDao) UpdateSession(session model.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	if f.beforeUpdate != nil {
+		f.beforeUpdate(f, f.updates)
+	}
+
+	stored, ok := f.sessions[session.SessionID]
+	if !ok || stored.Version != session.Version {
+		return dao.ErrSessionVersionConflict
+	}
+	session.Version++
+	f.sessions[session.SessionID] = cloneSession(session)
+	return nil
+}
+
+func (f *fakeSessionDao) TouchSession(session model.Session) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, ok := f.sessions[session.SessionID]
+	if !ok {
+		return 0, errors.New("no session found")
+	}
+	stored.LastSeenDate = session.LastSeenDate
+	stored.ExpiryDate = session.ExpiryDate
+	stored.UpdateDate = session.UpdateDate
+	stored.IPAddress = session.IPAddress
+	stored.TTL = session.TTL
+	stored.Version++
+	f.sessions[session.SessionID] = stored
+	return stored.Version, nil
+}
+
+func (f *fakeSessionDao) DeleteSession(sessionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, sessionID)
+	return nil
+}
+
+func (f *fakeSessionDao) GetSessionStats(now time.Time) (*model.SessionStats, error) {
+	return &model.SessionStats{}, nil
+}
+
+// store 模擬其他請求直接寫入資料表（版本 +1），只在 beforeUpdate 內呼叫（已持有鎖）
+func (f *fakeSessionDao) store(sessionID string, change func(session *model.Session)) {
+	session := cloneSession(f.sessions[sessionID])
+	change(&session)
+	session.Version++
+	f.sessions[sessionID] = session
+}
+
+// cloneSession 複製 Data 與 token，避免測試中共用指標
+func cloneSession(session model.Session) model.Session {
+	if session.Data != nil {
+		data := *session.Data
+		if data.TokenResponse != nil {
+			token := *data.TokenResponse
+			data.TokenResponse = &token
+		}
+		data.Scopes = append([]string(nil), data.Scopes...)
+		session.Data = &data
+	}
+	return session
+}
+
+func testSessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		IdleTimeout:                time.Hour,
+		AbsoluteLifetime:           24 * time.Hour,
+		RememberMeIdleTimeout:      24 * time.Hour,
+		RememberMeAbsoluteLifetime: 30 * 24 * time.Hour,
+	}
+}
+
+func testSession(now time.Time) model.Session {
+	return model.Session{
+		SessionID:  "session-1",
+		UserID:     "user-1",
+		CreateDate: now,
+		UpdateDate: now,
+		ExpiryDate: now.Add(time.Hour),
+		Version:    1,
+		Data: &model.SessionData{
+			TokenResponse: &model.GoogleTokenResponse{
+				AccessToken:  "access-1",
+				RefreshToken: "refresh-1",
+				ExpiresIn:    3600,
+				CreatedAt:    now,
+			},
+			Scopes: []string{"openid"},
+		},
+	}
+}
+
+func TestUpdateSessionMergesConcurrentRefreshTokenRotation(t *testing.T) {
+	now := time.Now()
+	fake := newFakeSessionDao(testSession(now))
+	manager := NewSessionManager(fake, testSessionPolicy(), zap.NewNop())
+
+	// 本次請求讀取 version 1 後增加 scope
+	local, _ := fake.GetSessionsBySessionID("session-1")
+	local.Data.Scopes = append(local.Data.Scopes, "https://www.googleapis.com/auth/calendar")
+
+	// 寫入前另一個請求更新了 token，Google 輪替了 refresh token
+	fake.beforeUpdate = func(f *fakeSessionDao, attempt int) {
+		if attempt != 1 {
+			return
+		}
+		f.store("session-1", func(session *model.Session) {
+			session.Data.TokenResponse = &model.GoogleTokenResponse{
+				AccessToken:  "access-2",
+				RefreshToken: "refresh-2",
+				ExpiresIn:    3600,
+				CreatedAt:    now.Add(time.Minute),
+			}
+		})
+	}
+
+	if err := manager.UpdateSession(local); err != nil {
+		t.Fatalf("UpdateSession() error = %v", err)
+	}
+	if fake.updates != 2 {
+		t.Errorf("updates = %d, want 2 (conflict then merged retry)", fake.updates)
+	}
+
+	stored, _ := fake.GetSessionsBySessionID("session-1")
+	token := stored.Data.TokenResponse
+	if token.AccessToken != "access-2" || token.RefreshToken != "refresh-2" {
+		t.Errorf("stored token = %s/%s, want the other writer's access-2/refresh-2", token.AccessToken, token.RefreshToken)
+	}
+	if !model.HasAnyScope(stored.Data.Scopes, "https://www.googleapis.com/auth/calendar") || !model.HasAnyScope(stored.Data.Scopes, "openid") {
+		t.Errorf("stored scopes = %v, want local scope merged", stored.Data.Scopes)
+	}
+	if stored.Version != 3 || local.Version != 3 {
+		t.Errorf("version stored = %d local = %d, want 3", stored.Version, local.Version)
+	}
+}
+
+func TestUpdateSessionConcurrentWritersBothSurvive(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		now := time.Now()
+		fake := newFakeSessionDao(testSession(now))
+		manager := NewSessionManager(fake, testSessionPolicy(), zap.NewNop())
+
+		// 兩個請求都讀到 version 1，後寫入者必定版本衝突並合併
+		scopeWriter, _ := fake.GetSessionsBySessionID("session-1")
+		scopeWriter.Data.Scopes = append(scopeWriter.Data.Scopes, "https://www.googleapis.com/auth/calendar")
+		tokenWriter, _ := fake.GetSessionsBySessionID("session-1")
+		tokenWriter.Data.TokenResponse = &model.GoogleTokenResponse{
+			AccessToken:  "access-2",
+			RefreshToken: "refresh-2",
+			ExpiresIn:    3600,
+			CreatedAt:    now.Add(time.Minute),
+		}
+
+		start := make(chan struct{})
+		errs := make(chan error, 2)
+		var wg sync.WaitGroup
+		for _, session := range []*model.Session{scopeWriter, tokenWriter} {
+			wg.Add(1)
+			go func(session *model.Session) {
+				defer wg.Done()
+				<-start
+				errs <- manager.UpdateSession(session)
+			}(session)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("UpdateSession() error = %v", err)
+			}
+		}
+
+		stored, _ := fake.GetSessionsBySessionID("session-1")
+		if fake.updates != 3 || stored.Version != 3 {
+			t.Errorf("updates = %d version = %d, want 3 writes (one conflict) and version 3", fake.updates, stored.Version)
+		}
+		token := stored.Data.TokenResponse
+		if token.AccessToken != "access-2" || token.RefreshToken != "refresh-2" {
+			t.Errorf("stored token = %s/%s, want access-2/refresh-2", token.AccessToken, token.RefreshToken)
+		}
+		if !model.HasAnyScope(stored.Data.Scopes, "https://www.googleapis.com/auth/calendar") {
+			t.Errorf("stored scopes = %v, want the calendar scope", stored.Data.Scopes)
+		}
+	}
+}
+
+func TestUpdateSessionGivesUpAfterMaxAttempts(t *testing.T) {
+	now := time.Now()
+	fake := newFakeSessionDao(testSession(now))
+	manager := NewSessionManager(fake, testSessionPolicy(), zap.NewNop())
+
+	local, _ := fake.GetSessionsBySessionID("session-1")
+	// 每次寫入前都有其他請求搶先寫入
+	fake.beforeUpdate = func(f *fakeSessionDao, attempt int) {
+		f.store("session-1", func(session *model.Session) {})
+	}
+
+	err := manager.UpdateSession(local)
+	if !errors.Is(err, dao.ErrSessionVersionConflict) {
+		t.Fatalf("UpdateSession() error = %v, want ErrSessionVersionConflict", err)
+	}
+	if fake.updates != maxSessionUpdateAttempts {
+		t.Errorf("updates = %d, want %d", fake.updates, maxSessionUpdateAttempts)
+	}
+}
+
+func TestUpdateSessionDoesNotRollBackTouchedExpiry(t *testing.T) {
+	now := time.Now()
+	fake := newFakeSessionDao(testSession(now))
+	manager := NewSessionManager(fake, testSessionPolicy(), zap.NewNop())
+
+	// 請求 A 讀取後變更 token；請求 B 同時滑動延長效期
+	stale, _ := fake.GetSessionsBySessionID("session-1")
+	stale.Data.TokenResponse.AccessToken = "access-a"
+	stale.Data.TokenResponse.CreatedAt = now.Add(time.Second)
+
+	touched, _ := fake.GetSessionsBySessionID("session-1")
+	touched.LastSeenDate = now.Add(-2 * time.Hour)
+	extended, err := manager.ExtendSession(touched)
+	if err != nil || !extended {
+		t.Fatalf("ExtendSession() = %v, %v", extended, err)
+	}
+	if touched.Version != 2 {
+		t.Errorf("touched version = %d, want 2", touched.Version)
+	}
+
+	if err := manager.UpdateSession(stale); err != nil {
+		t.Fatalf("UpdateSession() error = %v", err)
+	}
+	stored, _ := fake.GetSessionsBySessionID("session-1")
+	if !stored.ExpiryDate.Equal(touched.ExpiryDate) {
+		t.Errorf("expiry = %v, want touched expiry %v", stored.ExpiryDate, touched.ExpiryDate)
+	}
+	if stored.Data.TokenResponse.AccessToken != "access-a" {
+		t.Errorf("access token = %s, want access-a", stored.Data.TokenResponse.AccessToken)
+	}
+}
+
+func TestGrantedScopeChangeClearsCachedProfile(t *testing.T) {
+	const calendarScope = "https://www.googleapis.com/auth/calendar"
+	now := time.Now()
+	missingScopeProfile := func(fetchedAt time.Time) *model.UserProfile {
+		return &model.UserProfile{
+			PersonFields: []string{"phoneNumbers"},
+			FieldErrors:  map[string]model.ProfileFieldError{"phoneNumbers": {Reason: reasonMissingScope}},
+			FetchedAt:    fetchedAt,
+		}
+	}
+
+	t.Run("scopes unchanged", func(t *testing.T) {
+		session := testSession(now)
+		session.Data.Profile = missingScopeProfile(now)
+		setGrantedScopes(&session, []string{"openid"})
+		if session.Data.Profile == nil {
+			t.Error("profile cleared, want kept when scopes are unchanged")
+		}
+	})
+
+	t.Run("scope added", func(t *testing.T) {
+		session := testSession(now)
+		session.Data.Profile = missingScopeProfile(now)
+		setGrantedScopes(&session, []string{"openid", calendarScope})
+		if session.Data.Profile != nil {
+			t.Errorf("profile = %+v, want cleared", session.Data.Profile)
+		}
+	})
+
+	t.Run("concurrent profile fetch with fewer scopes", func(t *testing.T) {
+		fake := newFakeSessionDao(testSession(now))
+		manager := NewSessionManager(fake, testSessionPolicy(), zap.NewNop())
+
+		// 重新授權新增 scope 並清除 profile
+		local, _ := fake.GetSessionsBySessionID("session-1")
+		local.Data.Profile = missingScopeProfile(now)
+		setGrantedScopes(local, []string{"openid", calendarScope})
+
+		// 寫入前另一個請求以舊的 scope 取得並寫入 profile
+		fake.beforeUpdate = func(f *fakeSessionDao, attempt int) {
+			if attempt != 1 {
+				return
+			}
+			f.store("session-1", func(session *model.Session) {
+				session.Data.Profile = missingScopeProfile(now.Add(time.Minute))
+			})
+		}
+
+		if err := manager.UpdateSession(local); err != nil {
+			t.Fatalf("UpdateSession() error = %v", err)
+		}
+		stored, _ := fake.GetSessionsBySessionID("session-1")
+		if stored.Data.Profile != nil {
+			t.Errorf("stored profile = %+v, want cleared after the scope change", stored.Data.Profile)
+		}
+		if !model.HasAnyScope(stored.Data.Scopes, calendarScope) {
+			t.Errorf("stored scopes = %v, want %s", stored.Data.Scopes, calendarScope)
+		}
+	})
+}
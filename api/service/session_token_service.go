@@ -0,0 +1,315 @@
+package service
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/metrics"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/api/sessiontoken"
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionTokenCookie 無狀態模式的 session token（JWT）
+	sessionTokenCookie = "session_token"
+	// sessionTokenModeJWT 啟用無狀態 session token
+	sessionTokenModeJWT = "jwt"
+	// revokedSessionPrefix 撤銷清單中代表整個 session 的項目
+	revokedSessionPrefix = "sid:"
+	// maxCachedSessions 執行個體內 session 快取的上限
+	maxCachedSessions = 1000
+	// maxCachedRevocations 執行個體內撤銷查詢結果快取的上限
+	maxCachedRevocations = 5000
+)
+
+// SessionTokenManager 無狀態 session 模式：簽發短效 JWT，請求以 JWT 驗證身分，不讀取 Sessions 資料表
+// JWT 逾時後以 session_id cookie 回 DynamoDB 驗證並換發；換發時撤銷舊 token 的 jti，登出或撤銷 session 時撤銷整個 session
+type SessionTokenManager struct {
+	signer          *sessiontoken.Signer
+	ttl             time.Duration
+	revokedDao      dao.RevokedSessionTokenDaoInterface
+	denylistRefresh time.Duration
+
+	mu         sync.Mutex
+	revoked    map[string]revocation
+	sessions   map[string]cachedSession
+	sessionsMu sync.Mutex
+}
+
+// revocation 撤銷清單查詢結果的快取，已撤銷的項目保留至 token 逾時，未撤銷的項目 denylistRefresh 後重新查詢
+type revocation struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// cachedSession 完整 session 的執行個體快取，讓 JWT 驗證後讀取 Google token 時不需查詢 DynamoDB
+type cachedSession struct {
+	session   *model.Session
+	expiresAt time.Time
+}
+
+// NewSessionTokenManager creates a SessionTokenManager from config, returns nil when stateless mode is disabled
+func NewSessionTokenManager(config env.SessionTokenConfig, revokedDao dao.RevokedSessionTokenDaoInterface) *SessionTokenManager {
+	if !strings.EqualFold(config.Mode, sessionTokenModeJWT) {
+		return nil
+	}
+
+	signer, err := sessiontoken.NewSigner(config)
+	if err != nil {
+		// 金鑰設定錯誤時無法驗證 session，讓部署立即發現錯誤
+		panic(fmt.Sprintf("init session token signer failed: %v", err))
+	}
+
+	denylistRefresh := time.Duration(config.DenylistRefresh) * time.Second
+	if denylistRefresh <= 0 {
+		denylistRefresh = 30 * time.Second
+	}
+
+	logger.Info("Stateless session tokens enabled", zap.String("algorithm", config.Algorithm), zap.String("keyID", config.CurrentKeyID))
+	return &SessionTokenManager{
+		signer:          signer,
+		ttl:             minutesOrDefault(config.TTL, 15),
+		revokedDao:      revokedDao,
+		denylistRefresh: denylistRefresh,
+		revoked:         make(map[string]revocation),
+		sessions:        make(map[string]cachedSession),
+	}
+}
+
+// Issue signs a session token for the session and sets it as a cookie
+// The token never outlives the session idle expiry
+func (st *SessionTokenManager) Issue(context *gin.Context, session *model.Session) {
+	if st == nil || session.Stateless || session.IsCredentialSession() {
+		return
+	}
+
+	jti, err := utils.RandomString(16)
+	if err != nil {
+		logger.Error("Failed to generate session token id", zap.Error(err))
+		return
+	}
+
+	// 換發時撤銷請求帶來、尚未逾時的舊 token，舊 token 的 scope 等資訊可能已過時
+	st.revokeReplacedToken(context)
+
+	currentTime := utils.GetCurrentTime()
+	expiry := currentTime.Add(st.ttl)
+	if expiry.After(session.ExpiryDate) {
+		expiry = session.ExpiryDate
+	}
+
+	token, err := st.signer.Sign(sessiontoken.Claims{
+		Subject:    session.UserID,
+		SessionID:  session.SessionID,
+		ID:         jti,
+		IssuedAt:   currentTime.Unix(),
+		ExpiresAt:  expiry.Unix(),
+		SessionExp: session.ExpiryDate.Unix(),
+		RememberMe: session.RememberMe,
+		Scopes:     session.GrantedScopes(),
+		CSRFToken:  session.CSRFToken,
+	})
+	if err != nil {
+		logger.Error("Failed to sign session token", zap.String("sessionID", session.SessionID), zap.Error(err))
+		return
+	}
+
+	sessionManager.SetCookie(context, &model.Cookie{
+		Name:     sessionTokenCookie,
+		Value:    token,
+		MaxAge:   int(expiry.Sub(currentTime).Seconds()),
+		Path:     "/",
+		Domain:   "",
+		Secure:   false,
+		HttpOnly: true,
+	})
+	st.cacheSession(session, expiry)
+}
+
+// SessionFromRequest restores the session identity from the session token cookie without reading DynamoDB
+// The returned session is Stateless: it has no Google token and must not be written back
+func (st *SessionTokenManager) SessionFromRequest(context *gin.Context) (*model.Session, error) {
+	if st == nil {
+		return nil, fmt.Errorf("stateless session tokens are disabled")
+	}
+
+	token, err := context.Cookie(sessionTokenCookie)
+	if err != nil || token == "" {
+		return nil, fmt.Errorf("no session token")
+	}
+
+	claims, err := st.signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	// session_id cookie 與 token 不一致時（例如切換帳號）以 DynamoDB 為準
+	if sessionID, err := context.Cookie("session_id"); err == nil && sessionID != claims.SessionID {
+		return nil, fmt.Errorf("session token does not match session cookie")
+	}
+	revoked, err := st.isRevoked(claims)
+	if err != nil {
+		// 無法確認撤銷狀態時不信任 token，改回 DynamoDB 驗證 session
+		logger.Warn("Failed to check session token revocation", zap.Error(err))
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("session token revoked")
+	}
+
+	metrics.Incr(metrics.SessionTokenHit)
+	return &model.Session{
+		SessionID:  claims.SessionID,
+		UserID:     claims.Subject,
+		Data:       &model.SessionData{Scopes: claims.Scopes},
+		ExpiryDate: time.Unix(claims.SessionExp, 0),
+		RememberMe: claims.RememberMe,
+		CSRFToken:  claims.CSRFToken,
+		Stateless:  true,
+	}, nil
+}
+
+// RevokeSession 撤銷 session 簽發的所有 token，保留至最後一個 token 逾時為止
+func (st *SessionTokenManager) RevokeSession(sessionID string) error {
+	if st == nil {
+		return nil
+	}
+	st.evictSession(sessionID)
+	return st.revoke(revokedSessionPrefix+sessionID, utils.GetCurrentTime().Add(st.ttl+time.Minute))
+}
+
+// revokeReplacedToken 撤銷請求 cookie 中仍有效的 session token，逾時或無效的 token 不需撤銷
+func (st *SessionTokenManager) revokeReplacedToken(context *gin.Context) {
+	token, err := context.Cookie(sessionTokenCookie)
+	if err != nil || token == "" {
+		return
+	}
+	claims, err := st.signer.Verify(token)
+	if err != nil {
+		return
+	}
+	if err := st.revoke(claims.ID, time.Unix(claims.ExpiresAt, 0).Add(time.Minute)); err != nil {
+		logger.Error("Failed to revoke replaced session token", zap.String("sessionID", claims.SessionID), zap.Error(err))
+	}
+}
+
+// revoke 將 jti 寫入撤銷清單，執行個體內立即生效；寫入 DynamoDB 失敗時回傳錯誤
+func (st *SessionTokenManager) revoke(jti string, expiresAt time.Time) error {
+	st.rememberRevocation(jti, revocation{revoked: true, expiresAt: expiresAt})
+
+	if err := st.revokedDao.RevokeToken(model.RevokedSessionToken{
+		JTI:       jti,
+		RevokedAt: utils.GetCurrentTime(),
+		TTL:       expiresAt.Unix(),
+	}); err != nil {
+		return fmt.Errorf("failed to revoke session token: %w", err)
+	}
+	return nil
+}
+
+// CachedSession 取得快取的完整 session（複本），沒有或逾時時回傳 nil
+func (st *SessionTokenManager) CachedSession(sessionID string) *model.Session {
+	if st == nil {
+		return nil
+	}
+	st.sessionsMu.Lock()
+	defer st.sessionsMu.Unlock()
+
+	cached, ok := st.sessions[sessionID]
+	if !ok || utils.GetCurrentTime().After(cached.expiresAt) {
+		delete(st.sessions, sessionID)
+		return nil
+	}
+	var session model.Session
+	copySession(&session, cached.session)
+	return &session
+}
+
+// UpdateCachedSession 寫入 DynamoDB 後同步更新快取，沒有快取時不處理
+func (st *SessionTokenManager) UpdateCachedSession(session *model.Session) {
+	if st == nil || session.Stateless {
+		return
+	}
+	st.sessionsMu.Lock()
+	cached, ok := st.sessions[session.SessionID]
+	st.sessionsMu.Unlock()
+	if ok {
+		st.cacheSession(session, cached.expiresAt)
+	}
+}
+
+func (st *SessionTokenManager) cacheSession(session *model.Session, expiresAt time.Time) {
+	var cached model.Session
+	copySession(&cached, session)
+
+	st.sessionsMu.Lock()
+	defer st.sessionsMu.Unlock()
+	if len(st.sessions) >= maxCachedSessions {
+		st.sessions = make(map[string]cachedSession)
+	}
+	st.sessions[session.SessionID] = cachedSession{session: &cached, expiresAt: expiresAt}
+}
+
+func (st *SessionTokenManager) evictSession(sessionID string) {
+	st.sessionsMu.Lock()
+	delete(st.sessions, sessionID)
+	st.sessionsMu.Unlock()
+}
+
+// isRevoked 檢查 jti 或其 session 是否已撤銷
+// 只以 GetItem 查詢這兩個項目並快取結果，其他執行個體的撤銷最多延遲 denylistRefresh 生效
+func (st *SessionTokenManager) isRevoked(claims *sessiontoken.Claims) (bool, error) {
+	for _, jti := range []string{revokedSessionPrefix + claims.SessionID, claims.ID} {
+		revoked, err := st.lookupRevocation(jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	return false, nil
+}
+
+// lookupRevocation 先查執行個體快取，沒有或逾時時查詢 DynamoDB
+func (st *SessionTokenManager) lookupRevocation(jti string) (bool, error) {
+	currentTime := utils.GetCurrentTime()
+	st.mu.Lock()
+	cached, ok := st.revoked[jti]
+	st.mu.Unlock()
+	if ok && currentTime.Before(cached.expiresAt) {
+		return cached.revoked, nil
+	}
+
+	revoked, err := st.revokedDao.IsRevoked(jti)
+	if err != nil {
+		return false, err
+	}
+	entry := revocation{revoked: revoked, expiresAt: currentTime.Add(st.denylistRefresh)}
+	if revoked {
+		// 撤銷不會恢復，保留至 token 逾時
+		entry.expiresAt = currentTime.Add(st.ttl + time.Minute)
+	}
+	st.rememberRevocation(jti, entry)
+	return revoked, nil
+}
+
+func (st *SessionTokenManager) rememberRevocation(jti string, entry revocation) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.revoked) >= maxCachedRevocations {
+		// 先移除逾時的項目，仍超過上限時清空（撤銷紀錄仍在 DynamoDB）
+		currentTime := utils.GetCurrentTime()
+		for key, cached := range st.revoked {
+			if !currentTime.Before(cached.expiresAt) {
+				delete(st.revoked, key)
+			}
+		}
+		if len(st.revoked) >= maxCachedRevocations {
+			st.revoked = make(map[string]revocation)
+		}
+	}
+	st.revoked[jti] = entry
+}
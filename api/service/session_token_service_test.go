@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+	"go.uber.org/zap"
+)
+
+// fakeRevokedTokenDao 以記憶體保存撤銷清單並記錄查詢次數
+type fakeRevokedTokenDao struct {
+	mu       sync.Mutex
+	revoked  map[string]model.RevokedSessionToken
+	lookups  int
+	writeErr error
+	readErr  error
+}
+
+func newFakeRevokedTokenDao() *fakeRevokedTokenDao {
+	return &fakeRevokedTokenDao{revoked: map[string]model.RevokedSessionToken{}}
+}
+
+func (f *fakeRevokedTokenDao) RevokeToken(token model.RevokedSessionToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	f.revoked[token.JTI] = token
+	return nil
+}
+
+func (f *fakeRevokedTokenDao) IsRevoked(jti string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.readErr != nil {
+		return false, f.readErr
+	}
+	_, ok := f.revoked[jti]
+	return ok, nil
+}
+
+func (f *fakeRevokedTokenDao) lookupCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookups
+}
+
+// newTestSessionTokens 建立 HS256 的 SessionTokenManager，並以 fake DAO 取代 sessionManager
+func newTestSessionTokens(t *testing.T, revokedDao *fakeRevokedTokenDao, denylistRefresh int) *SessionTokenManager {
+	originalManager := sessionManager
+	sessionManager = NewSessionManager(newFakeSessionDao(), testSessionPolicy(), zap.NewNop())
+	t.Cleanup(func() { sessionManager = originalManager })
+
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	return NewSessionTokenManager(env.SessionTokenConfig{
+		Mode:            sessionTokenModeJWT,
+		Algorithm:       "HS256",
+		TTL:             15,
+		CurrentKeyID:    "k1",
+		Keys:            map[string]string{"k1": key},
+		DenylistRefresh: denylistRefresh,
+	}, revokedDao)
+}
+
+// issueSessionToken 簽發 token 並回傳 cookie 值，replaced 不為空時請求帶著舊 token
+func issueSessionToken(t *testing.T, st *SessionTokenManager, session *model.Session, replaced string) string {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(w)
+	context.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if replaced != "" {
+		context.Request.AddCookie(&http.Cookie{Name: sessionTokenCookie, Value: replaced})
+	}
+
+	st.Issue(context, session)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionTokenCookie {
+			return cookie.Value
+		}
+	}
+	t.Fatal("Issue() did not set the session token cookie")
+	return ""
+}
+
+func sessionFromToken(st *SessionTokenManager, sessionID, token string) (*model.Session, error) {
+	context, _ := gin.CreateTestContext(httptest.NewRecorder())
+	context.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	context.Request.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	context.Request.AddCookie(&http.Cookie{Name: sessionTokenCookie, Value: token})
+	return st.SessionFromRequest(context)
+}
+
+func TestSessionTokenRevocationLookupIsCached(t *testing.T) {
+	revokedDao := newFakeRevokedTokenDao()
+	st := newTestSessionTokens(t, revokedDao, 3600)
+	session := testSession(time.Now())
+	token := issueSessionToken(t, st, &session, "")
+
+	for i := 0; i < 3; i++ {
+		restored, err := sessionFromToken(st, session.SessionID, token)
+		if err != nil {
+			t.Fatalf("SessionFromRequest() error = %v", err)
+		}
+		if restored.UserID != session.UserID || !restored.Stateless {
+			t.Errorf("SessionFromRequest() = %+v", restored)
+		}
+	}
+	// 只查詢 sid 與 jti 兩個項目一次，之後使用快取
+	if lookups := revokedDao.lookupCount(); lookups != 2 {
+		t.Errorf("IsRevoked calls = %d, want 2", lookups)
+	}
+}
+
+func TestSessionTokenRevokedByAnotherInstance(t *testing.T) {
+	revokedDao := newFakeRevokedTokenDao()
+	// 縮短未撤銷結果的快取時間，模擬 denylistRefresh 已經過
+	st := newTestSessionTokens(t, revokedDao, 1)
+	st.denylistRefresh = time.Nanosecond
+	session := testSession(time.Now())
+	token := issueSessionToken(t, st, &session, "")
+
+	if _, err := sessionFromToken(st, session.SessionID, token); err != nil {
+		t.Fatalf("SessionFromRequest() error = %v", err)
+	}
+
+	// 其他執行個體撤銷 session
+	other := newTestSessionTokens(t, revokedDao, 1)
+	if err := other.RevokeSession(session.SessionID); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	if _, err := sessionFromToken(st, session.SessionID, token); err == nil {
+		t.Error("SessionFromRequest() error = nil, want revoked")
+	}
+}
+
+func TestSessionTokenRevocationErrors(t *testing.T) {
+	t.Run("write fails", func(t *testing.T) {
+		revokedDao := newFakeRevokedTokenDao()
+		st := newTestSessionTokens(t, revokedDao, 1)
+		st.denylistRefresh = time.Nanosecond
+		session := testSession(time.Now())
+		token := issueSessionToken(t, st, &session, "")
+
+		revokedDao.writeErr = errors.New("throttled")
+		if err := st.RevokeSession(session.SessionID); err == nil {
+			t.Error("RevokeSession() error = nil, want write error")
+		}
+		// 寫入失敗時本執行個體仍拒絕 token
+		if _, err := sessionFromToken(st, session.SessionID, token); err == nil {
+			t.Error("SessionFromRequest() error = nil, want revoked")
+		}
+	})
+
+	t.Run("lookup fails", func(t *testing.T) {
+		revokedDao := newFakeRevokedTokenDao()
+		st := newTestSessionTokens(t, revokedDao, 1)
+		session := testSession(time.Now())
+		token := issueSessionToken(t, st, &session, "")
+
+		revokedDao.readErr = errors.New("unavailable")
+		if _, err := sessionFromToken(st, session.SessionID, token); err == nil {
+			t.Error("SessionFromRequest() error = nil, want lookup error")
+		}
+	})
+}
+
+func TestSessionTokenReissueRevokesReplacedToken(t *testing.T) {
+	revokedDao := newFakeRevokedTokenDao()
+	st := newTestSessionTokens(t, revokedDao, 3600)
+	session := testSession(time.Now())
+
+	replaced := issueSessionToken(t, st, &session, "")
+	current := issueSessionToken(t, st, &session, replaced)
+
+	if _, err := sessionFromToken(st, session.SessionID, replaced); err == nil {
+		t.Error("SessionFromRequest(replaced) error = nil, want revoked")
+	}
+	if _, err := sessionFromToken(st, session.SessionID, current); err != nil {
+		t.Errorf("SessionFromRequest(current) error = %v", err)
+	}
+	if len(revokedDao.revoked) != 1 {
+		t.Errorf("revoked = %+v, want the replaced jti only", revokedDao.revoked)
+	}
+}
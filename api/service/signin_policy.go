@@ -0,0 +1,67 @@
+package service
+
+import (
+	"glt-calendar-service/api/identity"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+	"strings"
+)
+
+// SignInPolicy 限制可登入的帳號：驗證 email、拒絕清單、允許的網域與 email
+// 允許的網域只比對 Google 的 hd claim，其他提供者只以已驗證的 email 比對允許清單
+type SignInPolicy struct {
+	allowedDomains       map[string]bool
+	allowedEmails        map[string]bool
+	deniedEmails         map[string]bool
+	requireVerifiedEmail bool
+}
+
+// NewSignInPolicy creates a SignInPolicy from config, domains and emails are compared case-insensitively
+func NewSignInPolicy(config env.SignInRestrictionConfig) SignInPolicy {
+	return SignInPolicy{
+		allowedDomains:       lowerSet(config.AllowedDomains),
+		allowedEmails:        lowerSet(config.AllowedEmails),
+		deniedEmails:         lowerSet(config.DeniedEmails),
+		requireVerifiedEmail: config.RequireVerifiedEmail,
+	}
+}
+
+// Check 回傳拒絕原因，允許登入時回傳空字串，provider 為登入提供者名稱
+func (p SignInPolicy) Check(provider string, userInfo *model.GoogleUserInfo) string {
+	email := strings.ToLower(userInfo.Email)
+
+	if p.requireVerifiedEmail && !userInfo.VerifiedEmail {
+		return "email_not_verified"
+	}
+	if p.deniedEmails[email] {
+		return "email_denied"
+	}
+
+	// 未設定允許清單時不限制
+	if len(p.allowedDomains) == 0 && len(p.allowedEmails) == 0 {
+		return ""
+	}
+	if provider != identity.GoogleProviderName {
+		// 其他提供者的 hd claim 由使用者所屬租戶自訂，不能代表 Google Workspace 網域
+		if userInfo.VerifiedEmail && p.allowedEmails[email] {
+			return ""
+		}
+		return "account_not_allowed"
+	}
+	// hd claim 只有 Workspace 帳號才有，不以 email 網域判斷，避免個人帳號冒用
+	if userInfo.HostedDomain != "" && p.allowedDomains[strings.ToLower(userInfo.HostedDomain)] {
+		return ""
+	}
+	if p.allowedEmails[email] {
+		return ""
+	}
+	return "account_not_allowed"
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return set
+}
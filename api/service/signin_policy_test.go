@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"glt-calendar-service/api/identity"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/settings/env"
+)
+
+func TestSignInPolicyCheck(t *testing.T) {
+	policy := NewSignInPolicy(env.SignInRestrictionConfig{
+		AllowedDomains:       []string{"Example.com"},
+		AllowedEmails:        []string{"guest@partner.com"},
+		DeniedEmails:         []string{"fired@example.com"},
+		RequireVerifiedEmail: false,
+	})
+
+	tests := []struct {
+		name     string
+		provider string
+		userInfo model.GoogleUserInfo
+		want     string
+	}{
+		{"google workspace domain", identity.GoogleProviderName, model.GoogleUserInfo{Email: "alice@example.com", HostedDomain: "example.com"}, ""},
+		{"google personal account with domain email", identity.GoogleProviderName, model.GoogleUserInfo{Email: "alice@example.com"}, "account_not_allowed"},
+		{"google allowed email", identity.GoogleProviderName, model.GoogleUserInfo{Email: "Guest@partner.com"}, ""},
+		{"denied email", identity.GoogleProviderName, model.GoogleUserInfo{Email: "fired@example.com", HostedDomain: "example.com"}, "email_denied"},
+		// 其他提供者的 hd claim 不比對允許的網域
+		{"oidc hd claim", "entra", model.GoogleUserInfo{Email: "alice@example.com", VerifiedEmail: true, HostedDomain: "example.com"}, "account_not_allowed"},
+		{"oidc verified allowed email", "entra", model.GoogleUserInfo{Email: "guest@partner.com", VerifiedEmail: true}, ""},
+		{"oidc unverified allowed email", "entra", model.GoogleUserInfo{Email: "guest@partner.com"}, "account_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Check(tt.provider, &tt.userInfo); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("verified email required", func(t *testing.T) {
+		strict := NewSignInPolicy(env.SignInRestrictionConfig{RequireVerifiedEmail: true})
+		if got := strict.Check(identity.GoogleProviderName, &model.GoogleUserInfo{Email: "alice@example.com"}); got != "email_not_verified" {
+			t.Errorf("Check() = %q, want email_not_verified", got)
+		}
+		if got := strict.Check("entra", &model.GoogleUserInfo{Email: "alice@example.com", VerifiedEmail: true}); got != "" {
+			t.Errorf("Check() = %q, want allowed without allow-lists", got)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"glt-calendar-service/api/metrics"
+	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshLeaseDuration 租約有效時間，持有者異常中止時其他執行個體最多等待此時間
+	refreshLeaseDuration = 15 * time.Second
+	// refreshLeasePollInterval 等待其他執行個體更新 token 時重新讀取 session 的間隔
+	refreshLeasePollInterval = 250 * time.Millisecond
+)
+
+// refreshCall 進行中的 token 更新
+type refreshCall struct {
+	done    chan struct{}
+	session *model.Session
+	err     error
+}
+
+// refreshGroup 同一個 session 在同一個執行個體內同時只進行一次 token 更新
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{calls: make(map[string]*refreshCall)}
+}
+
+// do runs fn once per key at a time, concurrent callers wait for and share its result
+// shared reports whether the result came from another caller
+func (g *refreshGroup) do(key string, fn func() (*model.Session, error)) (session *model.Session, shared bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.session, true, call.err
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.session, call.err = fn()
+	return call.session, false, call.err
+}
+
+// refreshWithLease 取得 DynamoDB 租約後才向 Google 更新 token
+// 其他 Lambda 執行個體正在更新時，等待並沿用其更新後的 token
+func (tm *TokenManager) refreshWithLease(session *model.Session) (*model.Session, error) {
+	owner, err := utils.RandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	currentTime := utils.GetCurrentTime()
+	expiryTime := currentTime.Add(refreshLeaseDuration)
+	acquired, err := tm.leaseDao.AcquireLease(model.RefreshLease{
+		SessionID: session.SessionID,
+		Owner:     owner,
+		ExpiresAt: expiryTime.UnixMilli(),
+		TTL:       expiryTime.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		// 租約無法使用時直接更新，避免影響使用者
+		logger.Warn("Failed to acquire token refresh lease, refreshing without lease", zap.String("sessionID", session.SessionID), zap.Error(err))
+		return tm.refreshSession(session)
+	}
+
+	if !acquired {
+		if latest := tm.waitForRefresh(session, expiryTime); latest != nil {
+			logger.Info("Reusing token refreshed by another instance", zap.String("sessionID", session.SessionID))
+			copySession(session, mergeSession(latest, session))
+			return session, nil
+		}
+		// 持有者逾時未完成，自行更新
+		logger.Warn("Timed out waiting for token refresh lease", zap.String("sessionID", session.SessionID))
+		return tm.refreshSession(session)
+	}
+
+	defer func() {
+		if err := tm.leaseDao.ReleaseLease(session.SessionID, owner); err != nil {
+			logger.Warn("Failed to release token refresh lease", zap.String("sessionID", session.SessionID), zap.Error(err))
+		}
+	}()
+
+	// 取得租約前其他執行個體可能剛完成更新
+	if latest := tm.refreshedSession(session); latest != nil {
+		copySession(session, mergeSession(latest, session))
+		return session, nil
+	}
+	return tm.refreshSession(session)
+}
+
+// waitForRefresh 等待持有租約的執行個體完成更新，逾時回傳 nil
+func (tm *TokenManager) waitForRefresh(session *model.Session, deadline time.Time) *model.Session {
+	for utils.GetCurrentTime().Before(deadline) {
+		time.Sleep(refreshLeasePollInterval)
+		if latest := tm.refreshedSession(session); latest != nil {
+			return latest
+		}
+	}
+	return nil
+}
+
+// refreshedSession 重新讀取 session，token 已由他人更新且仍有效時回傳最新的 session
+func (tm *TokenManager) refreshedSession(session *model.Session) *model.Session {
+	metrics.Incr(metrics.SessionRead)
+	latest, err := sessionManager.sessionDao.GetSessionsBySessionID(session.SessionID)
+	if err != nil || latest.Data == nil || latest.Data.TokenResponse == nil {
+		return nil
+	}
+	if latest.IsTokenExpired() || !latest.Data.TokenResponse.CreatedAt.After(session.Data.TokenResponse.CreatedAt) {
+		return nil
+	}
+	return latest
+}
+
+// copySession 複製 session，Data 與 TokenResponse 另外複製，避免多個請求共用同一份資料
+func copySession(dst, src *model.Session) {
+	*dst = *src
+	if src.Data == nil {
+		return
+	}
+	data := *src.Data
+	if src.Data.TokenResponse != nil {
+		token := *src.Data.TokenResponse
+		data.TokenResponse = &token
+	}
+	dst.Data = &data
+}
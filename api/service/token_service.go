@@ -1,20 +1,28 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"glt-calendar-service/api/dao"
+	"glt-calendar-service/api/identity"
 	"glt-calendar-service/api/model"
 	"glt-calendar-service/utils"
+	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
-// TokenManager handles Google OAuth token operations
+// TokenManager handles OAuth token operations of the identity providers
 type TokenManager struct {
-	client *http.Client
+	client    *http.Client
+	leaseDao  dao.RefreshLeaseDaoInterface
+	refreshes *refreshGroup
 }
 
 // NewTokenManager creates a new TokenManager instance
@@ -23,13 +31,62 @@ func NewTokenManager() *TokenManager {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		leaseDao:  dao.NewRefreshLeaseDao(),
+		refreshes: newRefreshGroup(),
 	}
 }
 
-// GetTokenResponse retrieves a token either from session or by exchanging auth code
+// TokenRequestError Google token endpoint 請求失敗
+// StatusCode 為 0 代表請求未送達（網路錯誤）
+type TokenRequestError struct {
+	StatusCode  int
+	Code        string // OAuth 錯誤代碼，例如 invalid_grant
+	Description string
+	Err         error
+}
+
+func (e *TokenRequestError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("token request failed: %v", e.Err)
+	}
+	return fmt.Sprintf("token request failed with status %d: %s - %s", e.StatusCode, e.Code, e.Description)
+}
+
+func (e *TokenRequestError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidGrant refresh token 已失效（撤銷、過期或密碼變更），需重新登入
+func (e *TokenRequestError) InvalidGrant() bool {
+	return e.Code == "invalid_grant"
+}
+
+// Transient 暫時性錯誤（網路錯誤、429、5xx），可稍後重試
+func (e *TokenRequestError) Transient() bool {
+	return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// IsInvalidGrant reports whether err is caused by an invalid or revoked refresh token
+func IsInvalidGrant(err error) bool {
+	var tokenErr *TokenRequestError
+	return errors.As(err, &tokenErr) && tokenErr.InvalidGrant()
+}
+
+// GetTokenResponse retrieves a token either from session or by exchanging auth code with the provider
 // Returns token response and error if any
-func (tm *TokenManager) GetTokenResponse(context *gin.Context) (*model.GoogleTokenResponse, error) {
-	// First check if a token exists in session
+func (tm *TokenManager) GetTokenResponse(context *gin.Context, provider identity.IdentityProvider) (*model.GoogleTokenResponse, error) {
+	// An authorization code in the request takes precedence (new login or incremental consent)
+	var req model.GoogleTokenRequest
+	bindErr := context.ShouldBindBodyWith(&req, binding.JSON)
+	if bindErr == nil && req.Code != "" {
+		if !provider.AllowsRedirectURI(req.RedirectUri) {
+			return nil, fmt.Errorf("%w: %s", ErrRedirectURINotAllowed, req.RedirectUri)
+		}
+		// Exchange authorization code for token
+		return tm.exchangeCodeForToken(context.Request.Context(), provider, req.Code, req.RedirectUri, "")
+	}
+
+	// No code in request, check if a token exists in session
 	session, _ := sessionManager.GetContextOrSession(context)
 	if session != nil && session.Data != nil && session.Data.TokenResponse != nil {
 		if session.Data.TokenResponse.AccessToken != "" {
@@ -42,19 +99,10 @@ func (tm *TokenManager) GetTokenResponse(context *gin.Context) (*model.GoogleTok
 		}
 	}
 
-	// No token in session, get from request
-	var req model.GoogleTokenRequest
-	if err := context.ShouldBindJSON(&req); err != nil {
-		return nil, fmt.Errorf("invalid request format: %w", err)
+	if bindErr != nil {
+		return nil, fmt.Errorf("invalid request format: %w", bindErr)
 	}
-
-	// Exchange authorization code for token
-	tokenResp, err := tm.exchangeCodeForToken(req.Code, req.RedirectUri)
-	if err != nil {
-		return nil, err
-	}
-
-	return tokenResp, nil
+	return nil, fmt.Errorf("authorization code is required")
 }
 
 // GetAccessToken retrieves a valid access token, refreshing if necessary
@@ -84,6 +132,37 @@ func (tm *TokenManager) EnsureValidToken(context *gin.Context, session *model.Se
 		return session, nil
 	}
 
+	if _, err := tm.RefreshSessionToken(session); err != nil {
+		return nil, err
+	}
+
+	// Update cookie
+	sessionManager.SetSessionCookie(context, session)
+
+	// The refreshed session is already saved, cache it instead of reading it again
+	context.Set("session", session)
+
+	return session, nil
+}
+
+// RefreshSessionToken refreshes the session's access token and saves the session
+// Concurrent refreshes of the same session share one request to Google (see token_refresh.go)
+// Used by handlers and scheduled jobs that have no request context
+func (tm *TokenManager) RefreshSessionToken(session *model.Session) (*model.Session, error) {
+	result, shared, err := tm.refreshes.do(session.SessionID, func() (*model.Session, error) {
+		return tm.refreshWithLease(session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		copySession(session, result)
+	}
+	return session, nil
+}
+
+// refreshSession calls the token endpoint of the session's provider and saves the new token to the session
+func (tm *TokenManager) refreshSession(session *model.Session) (*model.Session, error) {
 	logger.Info("Access token is expired or about to expire, refreshing...")
 
 	refreshToken := session.Data.TokenResponse.RefreshToken
@@ -91,11 +170,28 @@ func (tm *TokenManager) EnsureValidToken(context *gin.Context, session *model.Se
 		return nil, fmt.Errorf("refresh token not found in session")
 	}
 
-	newToken, err := tm.refreshToken(refreshToken)
+	provider, ok := identityProviders.Get(session.Provider)
+	if !ok {
+		return nil, fmt.Errorf("identity provider %s is not enabled", session.Provider)
+	}
+
+	newToken, err := tm.refreshToken(context.TODO(), provider, refreshToken)
 	if err != nil {
+		if IsInvalidGrant(err) {
+			logger.Warn("Refresh token is invalid or revoked", zap.String("sessionID", session.SessionID), zap.Error(err))
+		} else {
+			logger.Error("Failed to refresh token", zap.String("sessionID", session.SessionID), zap.Error(err))
+		}
 		return nil, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
+	// The provider returns the currently granted scopes on refresh
+	// 需在更新 TokenResponse.Scope 前比較，舊 session 的 scope 由 token response 解析
+	if newToken.Scope != "" {
+		setGrantedScopes(session, model.ParseScopes(newToken.Scope))
+		session.Data.TokenResponse.Scope = newToken.Scope
+	}
+
 	// Update the session with new token info
 	session.Data.TokenResponse.AccessToken = newToken.AccessToken
 	session.Data.TokenResponse.ExpiresIn = newToken.ExpiresIn
@@ -113,68 +209,128 @@ func (tm *TokenManager) EnsureValidToken(context *gin.Context, session *model.Se
 		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
 
-	// Update cookie
-	sessionManager.SetCookie(context, &model.Cookie{
-		Name:     "session_id",
-		Value:    session.SessionID,
-		MaxAge:   24 * 60 * 60,
-		Path:     "/",
-		Domain:   "",
-		Secure:   false,
-		HttpOnly: true,
-	})
+	return session, nil
+}
+
+// RespondAccessTokenError 回應取得 access token 失敗
+// refresh token 已失效時刪除 session 與 cookie，回應 401 reauth_required 讓前端重新登入
+func RespondAccessTokenError(context *gin.Context, err error) {
+	if !IsInvalidGrant(err) {
+		var tokenErr *TokenRequestError
+		if errors.As(err, &tokenErr) && tokenErr.Transient() {
+			respHandler.FailContextCodeMessage(context, http.StatusServiceUnavailable, gin.H{"error": "Failed to get access token", "retryable": true}, "", err)
+			return
+		}
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get access token"}, "", err)
+		return
+	}
 
-	// Get an updated session
-	updatedSession, err := sessionManager.GetContextOrSession(context)
+	if session, sessionErr := sessionManager.GetContextOrSession(context); sessionErr == nil {
+		if deleteErr := sessionManager.DeleteSession(session.SessionID); deleteErr != nil {
+			logger.Error("Failed to delete session with revoked token", zap.String("sessionID", session.SessionID), zap.Error(deleteErr))
+		}
+	}
+	clearSessionCookie(context)
+
+	respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{
+		"error": "Google authorization expired or was revoked, please login again",
+		"code":  "reauth_required",
+	}, "Refresh token is invalid", err)
+}
+
+// revokeToken revokes a token at the provider (RFC 7009), revoking a refresh token also revokes its access tokens
+// A token that is already invalid is treated as revoked
+func (tm *TokenManager) revokeToken(provider identity.IdentityProvider, token string) error {
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	metadata, err := provider.Metadata(context.TODO())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated session: %w", err)
+		return err
+	}
+	if metadata.RevocationEndpoint == "" {
+		return fmt.Errorf("identity provider %s does not support token revocation", provider.Name())
 	}
 
-	return updatedSession, nil
+	resp, err := tm.client.PostForm(metadata.RevocationEndpoint, url.Values{
+		"token":         {token},
+		"client_id":     {provider.ClientID()},
+		"client_secret": {provider.ClientSecret()},
+	})
+	if err != nil {
+		return &TokenRequestError{Err: err}
+	}
+
+	defer utils.CloseResponseBody(resp, "RevokeToken")
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var errorResp struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &errorResp)
+	if errorResp.Error == "invalid_token" {
+		return nil
+	}
+	return &TokenRequestError{StatusCode: resp.StatusCode, Code: errorResp.Error, Description: errorResp.Description}
 }
 
 // exchangeCodeForToken exchanges authorization code for token
+// codeVerifier is the PKCE verifier, empty when the flow doesn't use PKCE
 // Returns token response and error if any
-func (tm *TokenManager) exchangeCodeForToken(code, redirectUri string) (*model.GoogleTokenResponse, error) {
-	request := map[string]string{
-		"code":          code,
-		"client_id":     cfg.GoogleOAuth2.ClientID,
-		"client_secret": cfg.GoogleOAuth2.ClientSecret,
-		"redirect_uri":  redirectUri,
-		"grant_type":    "authorization_code",
+func (tm *TokenManager) exchangeCodeForToken(ctx context.Context, provider identity.IdentityProvider, code, redirectUri, codeVerifier string) (*model.GoogleTokenResponse, error) {
+	metadata, err := provider.Metadata(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return tm.sendTokenRequest(model.GoogleOAuth2TokenUrl, request)
+	request := url.Values{
+		"code":          {code},
+		"client_id":     {provider.ClientID()},
+		"client_secret": {provider.ClientSecret()},
+		"redirect_uri":  {redirectUri},
+		"grant_type":    {"authorization_code"},
+	}
+	if codeVerifier != "" {
+		request.Set("code_verifier", codeVerifier)
+	}
+
+	return tm.sendTokenRequest(metadata.TokenEndpoint, request)
 }
 
 // refreshToken refreshes an access token using refresh token
 // Returns token response and error if any
-func (tm *TokenManager) refreshToken(refreshToken string) (*model.GoogleTokenResponse, error) {
+func (tm *TokenManager) refreshToken(ctx context.Context, provider identity.IdentityProvider, refreshToken string) (*model.GoogleTokenResponse, error) {
 	if refreshToken == "" {
 		return nil, fmt.Errorf("refresh token is required")
 	}
 
-	data := map[string]string{
-		"client_id":     cfg.GoogleOAuth2.ClientID,
-		"client_secret": cfg.GoogleOAuth2.ClientSecret,
-		"refresh_token": refreshToken,
-		"grant_type":    "refresh_token",
+	metadata, err := provider.Metadata(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return tm.sendTokenRequest(model.GoogleOAuth2RefreshTokenUrl, data)
+	data := url.Values{
+		"client_id":     {provider.ClientID()},
+		"client_secret": {provider.ClientSecret()},
+		"refresh_token": {refreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+
+	return tm.sendTokenRequest(metadata.TokenEndpoint, data)
 }
 
-// sendTokenRequest sends a token request to specified URL
+// sendTokenRequest sends a form encoded token request (RFC 6749) to specified URL
 // Returns token response and error if any
-func (tm *TokenManager) sendTokenRequest(url string, data map[string]string) (*model.GoogleTokenResponse, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode request data: %w", err)
-	}
-
-	resp, err := tm.client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+func (tm *TokenManager) sendTokenRequest(tokenURL string, data url.Values) (*model.GoogleTokenResponse, error) {
+	resp, err := tm.client.PostForm(tokenURL, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send token request: %w", err)
+		return nil, &TokenRequestError{Err: err}
 	}
 
 	defer utils.CloseResponseBody(resp, "TokenRequest")
@@ -191,9 +347,9 @@ func (tm *TokenManager) sendTokenRequest(url string, data map[string]string) (*m
 		}
 
 		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
+			return nil, &TokenRequestError{StatusCode: resp.StatusCode, Description: string(body)}
 		}
-		return nil, fmt.Errorf("token request failed: %s - %s", errorResp.Error, errorResp.Description)
+		return nil, &TokenRequestError{StatusCode: resp.StatusCode, Code: errorResp.Error, Description: errorResp.Description}
 	}
 
 	var tokenResponse model.GoogleTokenResponse
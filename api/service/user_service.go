@@ -2,19 +2,119 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/dao"
 	"glt-calendar-service/api/model"
+	"glt-calendar-service/utils"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
+var userDao dao.UserDaoInterface = dao.NewUserDao()
+
+// upsertUser 登入時將 Google 使用者資料同步至 Users table
+func upsertUser(userInfo *model.GoogleUserInfo) (*model.User, error) {
+	defaults := model.UserPreferences{
+		TimeZone:        defaultTimeZone,
+		DefaultCalendar: "primary",
+		Locale:          userInfo.Locale,
+		WeekStart:       0,
+	}
+	if defaults.Locale == "" {
+		defaults.Locale = "en"
+	}
+
+	return userDao.UpsertLogin(userInfo, defaults, isBootstrapAdmin(userInfo), utils.GetCurrentTime())
+}
+
+// GetCurrentUser returns the persisted user record of the current session
+func GetCurrentUser(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	user, err := userDao.GetUserByID(session.UserID)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "User not found"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, user)
+}
+
+// UpdateCurrentUser updates the preferences of the current user
+func UpdateCurrentUser(context *gin.Context) {
+	session, err := utils.GetSessionFromContext(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Please login first"}, "", err)
+		return
+	}
+
+	var req model.UserPreferencesRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid request format"}, "", err)
+		return
+	}
+
+	user, err := userDao.GetUserByID(session.UserID)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusNotFound, gin.H{"error": "User not found"}, "", err)
+		return
+	}
+
+	preferences := user.Preferences
+	if req.TimeZone != nil {
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "" {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Invalid time zone"}, "", err)
+			return
+		}
+		preferences.TimeZone = *req.TimeZone
+	}
+	if req.DefaultCalendar != nil {
+		if *req.DefaultCalendar == "" {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Default calendar must not be empty"}, "", nil)
+			return
+		}
+		preferences.DefaultCalendar = *req.DefaultCalendar
+	}
+	if req.Locale != nil {
+		if *req.Locale == "" {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Locale must not be empty"}, "", nil)
+			return
+		}
+		preferences.Locale = *req.Locale
+	}
+	if req.WeekStart != nil {
+		if *req.WeekStart < 0 || *req.WeekStart > 6 {
+			respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": "Week start must be between 0 (Sunday) and 6 (Saturday)"}, "", nil)
+			return
+		}
+		preferences.WeekStart = *req.WeekStart
+	}
+
+	updatedUser, err := userDao.UpdatePreferences(session.UserID, preferences, utils.GetCurrentTime())
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to update user"}, "", err)
+		return
+	}
+
+	respHandler.SuccessContextMessage(context, updatedUser)
+}
+
 // GetGoogleUserInfo 通過 access token 獲取用戶資訊
 func GetGoogleUserInfo(accessToken string) (*model.GoogleUserInfo, error) {
 	// 使用 Google 的 userinfo 端點獲取用戶基本資訊
-	userInfoURL := "https://www.googleapis.com/oauth2/v2/userinfo"
-	req, err := http.NewRequest("GET", userInfoURL, nil)
+	req, err := http.NewRequest("GET", model.GoogleUserInfoUrl, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request error: %v", err)
 	}
@@ -53,11 +153,37 @@ func GetGoogleUserInfo(accessToken string) (*model.GoogleUserInfo, error) {
 	return &userInfo, nil
 }
 
-// GetGoogleUserPhone 通過 access token 獲取用戶的電話號碼（需要額外的權限）
-func GetGoogleUserPhone(accessToken string) ([]string, error) {
-	// 使用 Google People API 獲取電話號碼
-	phoneInfoURL := "https://people.googleapis.com/v1/people/me?personFields=phoneNumbers"
-	req, err := http.NewRequest("GET", phoneInfoURL, nil)
+const (
+	googlePeopleMeURL   = "https://people.googleapis.com/v1/people/me"
+	googleProfileScope  = "https://www.googleapis.com/auth/userinfo.profile"
+	reasonMissingScope  = "missing_scope"
+	reasonRequestFailed = "request_failed"
+)
+
+// personFieldScopes People API 欄位所需的 OAuth scope
+var personFieldScopes = map[string][]string{
+	"phoneNumbers":  {"https://www.googleapis.com/auth/user.phonenumbers.read"},
+	"organizations": {"https://www.googleapis.com/auth/user.organization.read"},
+	"birthdays":     {"https://www.googleapis.com/auth/user.birthday.read"},
+	"addresses":     {"https://www.googleapis.com/auth/user.addresses.read"},
+	"locales":       {googleProfileScope},
+	"photos":        {googleProfileScope},
+}
+
+// PeopleAPIError Google People API 回傳非 200 狀態碼時的錯誤
+type PeopleAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *PeopleAPIError) Error() string {
+	return fmt.Sprintf("fetch person info error，statusCode: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// GetGooglePerson 通過 access token 獲取 People API 的用戶資料（需要額外的權限）
+func GetGooglePerson(accessToken string, personFields []string) (*model.GooglePersonInfo, error) {
+	personInfoURL := googlePeopleMeURL + "?personFields=" + url.QueryEscape(strings.Join(personFields, ","))
+	req, err := http.NewRequest("GET", personInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request error: %v", err)
 	}
@@ -71,83 +197,197 @@ func GetGoogleUserPhone(accessToken string) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("send request error: %v", err)
 	}
-
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			if err == nil {
-				logger.Error("Failed to close response body")
-				return
-			}
-		}
-	}()
+	defer utils.CloseResponseBody(resp, "GetGooglePerson")
 
 	// 檢查響應狀態
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("fetch phone info error，statusCode: %d, body: %s", resp.StatusCode, string(body))
+		return nil, &PeopleAPIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// 解析響應
-	var phoneInfo model.GooglePhoneInfo
-	if err := json.NewDecoder(resp.Body).Decode(&phoneInfo); err != nil {
-		return nil, fmt.Errorf("error parsing phone info: %v", err)
-	}
-
-	// 提取電話號碼
-	var phoneNumbers []string
-	for _, phone := range phoneInfo.PhoneNumbers {
-		phoneNumbers = append(phoneNumbers, phone.Value)
+	var personInfo model.GooglePersonInfo
+	if err := json.NewDecoder(resp.Body).Decode(&personInfo); err != nil {
+		return nil, fmt.Errorf("error parsing person info: %v", err)
 	}
 
-	return phoneNumbers, nil
+	return &personInfo, nil
 }
 
-// GetCompleteUserProfile 獲取完整的用戶資料（基本資訊和電話號碼）
-func GetCompleteUserProfile(session *model.Session) (map[string]interface{}, error) {
+// GetCompleteUserProfile 獲取完整的用戶資料（基本資訊與 People API 欄位），兩個 API 同時呼叫
+// granted 為 session 已授權的 scope，缺少權限的欄位不會向 People API 請求
+func GetCompleteUserProfile(accessToken string, granted []string, personFields []string) (*model.UserProfile, error) {
+	fieldErrors := make(map[string]model.ProfileFieldError)
 
-	accessToken := session.Data.TokenResponse.AccessToken
+	// 依已授權 scope 過濾欄位，scope 未知時全部請求
+	var requestFields []string
+	for _, field := range personFields {
+		if len(granted) > 0 && !model.HasAnyScope(granted, personFieldScopes[field]...) {
+			fieldErrors[field] = model.ProfileFieldError{Reason: reasonMissingScope, MissingScopes: personFieldScopes[field]}
+			continue
+		}
+		requestFields = append(requestFields, field)
+	}
 
-	// 獲取用戶基本資訊
-	userInfo, err := GetGoogleUserInfo(accessToken)
-	if err != nil {
-		return nil, err
+	var (
+		wg          sync.WaitGroup
+		userInfo    *model.GoogleUserInfo
+		userInfoErr error
+		personInfo  *model.GooglePersonInfo
+		personErr   error
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 獲取用戶基本資訊
+		userInfo, userInfoErr = GetGoogleUserInfo(accessToken)
+	}()
+	if len(requestFields) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			personInfo, personErr = GetGooglePerson(accessToken, requestFields)
+		}()
 	}
+	wg.Wait()
 
-	// 初始化結果
-	result := map[string]interface{}{
-		"id":             userInfo.ID,
-		"email":          userInfo.Email,
-		"verified_email": userInfo.VerifiedEmail,
-		"name":           userInfo.Name,
-		"given_name":     userInfo.GivenName,
-		"family_name":    userInfo.FamilyName,
-		"picture":        userInfo.Picture,
+	if userInfoErr != nil {
+		return nil, userInfoErr
 	}
 
-	// 嘗試獲取電話號碼（可能會失敗，如果沒有適當的權限）
-	phoneNumbers, err := GetGoogleUserPhone(accessToken)
-	if err == nil && len(phoneNumbers) > 0 {
-		result["phone_numbers"] = phoneNumbers
-	} else {
+	profile := &model.UserProfile{
+		ID:            userInfo.ID,
+		Email:         userInfo.Email,
+		VerifiedEmail: userInfo.VerifiedEmail,
+		Name:          userInfo.Name,
+		GivenName:     userInfo.GivenName,
+		FamilyName:    userInfo.FamilyName,
+		Picture:       userInfo.Picture,
+		PersonFields:  personFields,
+		FetchedAt:     utils.GetCurrentTime(),
+	}
+
+	if personErr != nil {
 		// 記錄錯誤但不阻止返回其他信息
-		result["phone_numbers_error"] = "無法獲取電話號碼，可能缺少權限"
+		logger.Warn("Failed to get person info", zap.Strings("personFields", requestFields), zap.Error(personErr))
+
+		var apiErr *PeopleAPIError
+		insufficientScope := errors.As(personErr, &apiErr) && apiErr.StatusCode == http.StatusForbidden
+		for _, field := range requestFields {
+			if insufficientScope {
+				fieldErrors[field] = model.ProfileFieldError{Reason: reasonMissingScope, MissingScopes: personFieldScopes[field]}
+			} else {
+				fieldErrors[field] = model.ProfileFieldError{Reason: reasonRequestFailed, Message: personErr.Error()}
+			}
+		}
+	} else if personInfo != nil {
+		fillPersonFields(profile, personInfo)
 	}
 
-	return result, nil
+	if len(fieldErrors) > 0 {
+		profile.FieldErrors = fieldErrors
+	}
+	return profile, nil
 }
 
+// fillPersonFields 將 People API 回應轉為 UserProfile 欄位
+func fillPersonFields(profile *model.UserProfile, personInfo *model.GooglePersonInfo) {
+	for _, phone := range personInfo.PhoneNumbers {
+		profile.PhoneNumbers = append(profile.PhoneNumbers, phone.Value)
+	}
+	for _, organization := range personInfo.Organizations {
+		profile.Organizations = append(profile.Organizations, model.ProfileOrganization{
+			Name:       organization.Name,
+			Title:      organization.Title,
+			Department: organization.Department,
+		})
+	}
+	for _, birthday := range personInfo.Birthdays {
+		switch {
+		case birthday.Date != nil && birthday.Date.Year > 0:
+			profile.Birthdays = append(profile.Birthdays, fmt.Sprintf("%04d-%02d-%02d", birthday.Date.Year, birthday.Date.Month, birthday.Date.Day))
+		case birthday.Date != nil:
+			// 未提供年份
+			profile.Birthdays = append(profile.Birthdays, fmt.Sprintf("--%02d-%02d", birthday.Date.Month, birthday.Date.Day))
+		case birthday.Text != "":
+			profile.Birthdays = append(profile.Birthdays, birthday.Text)
+		}
+	}
+	for _, address := range personInfo.Addresses {
+		profile.Addresses = append(profile.Addresses, address.FormattedValue)
+	}
+	for _, locale := range personInfo.Locales {
+		profile.Locales = append(profile.Locales, locale.Value)
+	}
+	for _, photo := range personInfo.Photos {
+		profile.Photos = append(profile.Photos, photo.URL)
+	}
+}
+
+// resolvePersonFields 取得請求的 personFields，未指定時使用設定檔預設值
+func resolvePersonFields(context *gin.Context) ([]string, error) {
+	query := context.Query("personFields")
+	if query == "" {
+		return cfg.GooglePeople.PersonFields, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(query, ",") {
+		field = strings.TrimSpace(field)
+		if _, ok := personFieldScopes[field]; !ok {
+			return nil, fmt.Errorf("unsupported person field: %s", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// FetchCompleteUserProfile returns the user profile cached on the session
+// Query refresh=true forces re-fetching from Google
 func FetchCompleteUserProfile(context *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			respHandler.FailContextMessage(context, gin.H{"error": "Internal server error"}, "Recovered from panic in FetchCompleteUserProfile", nil)
+		}
+	}()
+
 	session, err := sessionManager.GetContextOrSession(context)
 	if err != nil {
-		logger.Error("Failed to get session", zap.Error(err))
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		respHandler.FailContextCodeMessage(context, http.StatusUnauthorized, gin.H{"error": "Invalid session"}, "Failed to get session", err)
+		return
+	}
+
+	personFields, err := resolvePersonFields(context)
+	if err != nil {
+		respHandler.FailContextCodeMessage(context, http.StatusBadRequest, gin.H{"error": err.Error()}, "", err)
 		return
 	}
 
-	userinfo, err := GetCompleteUserProfile(session)
+	// 快取的欄位與本次請求一致時直接回傳
+	refresh := context.DefaultQuery("refresh", "false") == "true"
+	if !refresh && session.Data != nil && session.Data.Profile != nil && slices.Equal(session.Data.Profile.PersonFields, personFields) {
+		respHandler.SuccessContextMessage(context, session.Data.Profile)
+		return
+	}
+
+	accessToken, err := tokenManager.GetAccessToken(context)
 	if err != nil {
-		logger.Error("Failed to get user info", zap.Error(err))
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		RespondAccessTokenError(context, err)
+		return
 	}
-	context.JSON(http.StatusOK, userinfo)
+
+	profile, err := GetCompleteUserProfile(accessToken, session.GrantedScopes(), personFields)
+	if err != nil {
+		respHandler.FailContextMessage(context, gin.H{"error": "Failed to get user info"}, "", err)
+		return
+	}
+
+	// 快取至 session，失敗時仍回傳資料
+	session.Data.Profile = profile
+	if err := sessionManager.UpdateSession(session); err != nil {
+		logger.Error("Failed to cache user profile on session", zap.Error(err))
+	}
+
+	respHandler.SuccessContextMessage(context, profile)
 }
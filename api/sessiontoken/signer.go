@@ -0,0 +1,200 @@
+package sessiontoken
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"glt-calendar-service/settings/env"
+	"glt-calendar-service/utils"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	// minHMACKeySize HS256 金鑰最短長度
+	minHMACKeySize = 32
+	// clockSkew 允許的時間誤差
+	clockSkew = 30 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrTokenExpired = errors.New("session token expired")
+)
+
+// Claims 服務簽發的 session token 內容
+type Claims struct {
+	Subject    string   `json:"sub"`           // user id
+	SessionID  string   `json:"sid"`           // DynamoDB session id，換發與撤銷時使用
+	ID         string   `json:"jti"`           // token id，撤銷單一 token 時使用
+	IssuedAt   int64    `json:"iat"`           // unix 秒
+	ExpiresAt  int64    `json:"exp"`           // unix 秒
+	SessionExp int64    `json:"sxp"`           // session 閒置逾時（unix 秒）
+	RememberMe bool     `json:"rem,omitempty"` // 記住我
+	Scopes     []string `json:"scp,omitempty"` // 已授權的 OAuth scope
+	CSRFToken  string   `json:"csrf,omitempty"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Signer 簽發與驗證 session token，金鑰以 key id 區分以支援輪替
+type Signer struct {
+	algorithm    string
+	currentKeyID string
+	hmacKeys     map[string][]byte
+	privateKeys  map[string]ed25519.PrivateKey
+}
+
+// NewSigner creates a Signer from config, HS256 keys are base64 secrets, EdDSA keys are base64 ed25519 seeds
+// 輪替時新增金鑰並修改 current_key_id，舊金鑰保留至舊 token 全部逾時為止
+func NewSigner(config env.SessionTokenConfig) (*Signer, error) {
+	signer := &Signer{
+		algorithm:    config.Algorithm,
+		currentKeyID: config.CurrentKeyID,
+		hmacKeys:     make(map[string][]byte),
+		privateKeys:  make(map[string]ed25519.PrivateKey),
+	}
+	if signer.algorithm == "" {
+		signer.algorithm = AlgorithmHS256
+	}
+
+	for keyID, encoded := range config.Keys {
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session token key %s: %w", keyID, err)
+		}
+
+		switch signer.algorithm {
+		case AlgorithmHS256:
+			if len(key) < minHMACKeySize {
+				return nil, fmt.Errorf("session token key %s must be at least %d bytes, got %d", keyID, minHMACKeySize, len(key))
+			}
+			signer.hmacKeys[keyID] = key
+		case AlgorithmEdDSA:
+			if len(key) != ed25519.SeedSize {
+				return nil, fmt.Errorf("session token key %s must be a %d bytes ed25519 seed, got %d", keyID, ed25519.SeedSize, len(key))
+			}
+			signer.privateKeys[keyID] = ed25519.NewKeyFromSeed(key)
+		default:
+			return nil, fmt.Errorf("unsupported session token algorithm: %s", signer.algorithm)
+		}
+	}
+
+	if !signer.hasKey(signer.currentKeyID) {
+		return nil, fmt.Errorf("current session token key %s is not configured", signer.currentKeyID)
+	}
+	return signer, nil
+}
+
+// Sign signs the claims with the current key
+func (s *Signer) Sign(claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{Algorithm: s.algorithm, Type: "JWT", KeyID: s.currentKeyID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	signature, err := s.sign(s.currentKeyID, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Verify verifies the signature and expiry of a token and returns its claims
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	// 只接受設定的演算法，避免 alg 置換攻擊
+	if h.Algorithm != s.algorithm || !s.hasKey(h.KeyID) {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !s.verify(h.KeyID, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	claimsJSON, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.SessionID == "" || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if utils.GetCurrentTime().After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return &claims, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (s *Signer) hasKey(keyID string) bool {
+	if s.algorithm == AlgorithmEdDSA {
+		_, ok := s.privateKeys[keyID]
+		return ok
+	}
+	_, ok := s.hmacKeys[keyID]
+	return ok
+}
+
+func (s *Signer) sign(keyID string, input []byte) ([]byte, error) {
+	if s.algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(s.privateKeys[keyID], input), nil
+	}
+	mac := hmac.New(sha256.New, s.hmacKeys[keyID])
+	mac.Write(input)
+	return mac.Sum(nil), nil
+}
+
+func (s *Signer) verify(keyID string, input, signature []byte) bool {
+	if s.algorithm == AlgorithmEdDSA {
+		publicKey := s.privateKeys[keyID].Public().(ed25519.PublicKey)
+		return ed25519.Verify(publicKey, input, signature)
+	}
+	expected, _ := s.sign(keyID, input)
+	return hmac.Equal(expected, signature)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
@@ -0,0 +1,173 @@
+package sessiontoken
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"glt-calendar-service/settings/env"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func newTestSigner(t *testing.T, algorithm string, keys map[string]string, currentKeyID string) *Signer {
+	signer, err := NewSigner(env.SessionTokenConfig{Algorithm: algorithm, CurrentKeyID: currentKeyID, Keys: keys})
+	if err != nil {
+		t.Fatalf("NewSigner(%s) error = %v", algorithm, err)
+	}
+	return signer
+}
+
+func testClaims(expiresAt time.Time) Claims {
+	return Claims{
+		Subject:    "user-1",
+		SessionID:  "session-1",
+		ID:         "jti-1",
+		IssuedAt:   time.Now().Unix(),
+		ExpiresAt:  expiresAt.Unix(),
+		SessionExp: expiresAt.Add(time.Hour).Unix(),
+		Scopes:     []string{"openid", "email"},
+		CSRFToken:  "csrf-1",
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmHS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			signer := newTestSigner(t, algorithm, map[string]string{"k1": testKey('a')}, "k1")
+			want := testClaims(time.Now().Add(15 * time.Minute))
+
+			token, err := signer.Sign(want)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			got, err := signer.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Subject != want.Subject || got.SessionID != want.SessionID || got.ID != want.ID ||
+				got.ExpiresAt != want.ExpiresAt || got.CSRFToken != want.CSRFToken || strings.Join(got.Scopes, " ") != "openid email" {
+				t.Errorf("Verify() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSignerKeyRotation(t *testing.T) {
+	old := newTestSigner(t, AlgorithmHS256, map[string]string{"k1": testKey('a')}, "k1")
+	token, err := old.Sign(testClaims(time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// 輪替後仍接受舊金鑰簽發的 token
+	rotated := newTestSigner(t, AlgorithmHS256, map[string]string{"k1": testKey('a'), "k2": testKey('b')}, "k2")
+	if _, err := rotated.Verify(token); err != nil {
+		t.Errorf("Verify() after rotation error = %v", err)
+	}
+	// 移除舊金鑰後拒絕
+	removed := newTestSigner(t, AlgorithmHS256, map[string]string{"k2": testKey('b')}, "k2")
+	if _, err := removed.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with removed key error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestSignerRejectsInvalidTokens(t *testing.T) {
+	hs256 := newTestSigner(t, AlgorithmHS256, map[string]string{"k1": testKey('a')}, "k1")
+	eddsa := newTestSigner(t, AlgorithmEdDSA, map[string]string{"k1": testKey('a')}, "k1")
+	token, err := hs256.Sign(testClaims(time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	// 竄改內容：替換 sub 但保留原簽章
+	tamperedClaims := testClaims(time.Now().Add(time.Minute))
+	tamperedClaims.Subject = "user-2"
+	forged, _ := hs256.Sign(tamperedClaims)
+	forgedParts := strings.Split(forged, ".")
+
+	// 竄改簽章第一個字元
+	signature := []byte(parts[2])
+	if signature[0] == 'A' {
+		signature[0] = 'B'
+	} else {
+		signature[0] = 'A'
+	}
+
+	noneHeader := encodeSegment([]byte(`{"alg":"none","typ":"JWT","kid":"k1"}`))
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+	}{
+		{"malformed", hs256, "not-a-token"},
+		{"tampered claims", hs256, parts[0] + "." + forgedParts[1] + "." + parts[2]},
+		{"tampered signature", hs256, parts[0] + "." + parts[1] + "." + string(signature)},
+		{"wrong alg", eddsa, token},
+		{"alg none", hs256, noneHeader + "." + parts[1] + "."},
+		{"unknown kid", newTestSigner(t, AlgorithmHS256, map[string]string{"k2": testKey('a')}, "k2"), token},
+		{"other key", newTestSigner(t, AlgorithmHS256, map[string]string{"k1": testKey('b')}, "k1"), token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.signer.Verify(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestSignerExpiryClockSkew(t *testing.T) {
+	signer := newTestSigner(t, AlgorithmEdDSA, map[string]string{"k1": testKey('a')}, "k1")
+
+	tests := []struct {
+		name    string
+		expired time.Duration
+		wantErr error
+	}{
+		{"not expired", -time.Minute, nil},
+		{"within skew", clockSkew - 10*time.Second, nil},
+		{"beyond skew", clockSkew + 10*time.Second, ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := signer.Sign(testClaims(time.Now().Add(-tt.expired)))
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			claims, err := signer.Verify(token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			// 逾時仍回傳 claims，供換發時取得 session id
+			if claims == nil || claims.SessionID != "session-1" {
+				t.Errorf("Verify() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestNewSignerRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config env.SessionTokenConfig
+	}{
+		{"short HS256 key", env.SessionTokenConfig{Algorithm: AlgorithmHS256, CurrentKeyID: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}}},
+		{"EdDSA seed size", env.SessionTokenConfig{Algorithm: AlgorithmEdDSA, CurrentKeyID: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 64)))}}},
+		{"missing current key", env.SessionTokenConfig{Algorithm: AlgorithmHS256, CurrentKeyID: "k2", Keys: map[string]string{"k1": testKey('a')}}},
+		{"unsupported algorithm", env.SessionTokenConfig{Algorithm: "RS256", CurrentKeyID: "k1", Keys: map[string]string{"k1": testKey('a')}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(tt.config); err == nil {
+				t.Error("NewSigner() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package testenv 讓測試在套件目錄執行時也能讀到專案根目錄的設定檔，只供 _test.go 匯入
+//
+// 設定檔在 settings/env 與 settings/log 初始化時就會讀取，早於 TestMain，
+// 因此改由此套件的 init 加入設定檔路徑。此套件不依賴 settings/env，
+// 依 Go 的初始化順序（依 import path 排序）會在 settings/env 之前初始化。
+package testenv
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return
+	}
+	// internal/testenv/testenv.go -> 專案根目錄
+	root := filepath.Join(filepath.Dir(file), "..", "..")
+	viper.AddConfigPath(filepath.Join(root, "settings", "env"))
+}
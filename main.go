@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -11,6 +12,7 @@ import (
 
 	"glt-calendar-service/api"
 	"glt-calendar-service/api/database"
+	"glt-calendar-service/api/service"
 	"glt-calendar-service/settings/env"
 	"glt-calendar-service/settings/log"
 	"go.uber.org/zap"
@@ -42,6 +44,20 @@ func setupGin() *gin.Engine {
 	return instance
 }
 
+// Handler 依事件來源分派：EventBridge 排程事件執行通知排程，其餘視為 API Gateway 請求
+func Handler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var scheduledEvent events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &scheduledEvent); err == nil && scheduledEvent.Source == "aws.events" {
+		return nil, HandlerScheduled(ctx, scheduledEvent)
+	}
+
+	var req events.APIGatewayV2HTTPRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	return HandlerV2(ctx, req)
+}
+
 func HandlerV2(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	if ginLambdaV2 == nil {
 		engine := setupGin()
@@ -50,6 +66,16 @@ func HandlerV2(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.
 	return ginLambdaV2.ProxyWithContext(ctx, req)
 }
 
+// HandlerScheduled 處理 EventBridge 排程事件（每日摘要與事件提醒）
+func HandlerScheduled(ctx context.Context, event events.CloudWatchEvent) error {
+	if ginLambdaV2 == nil {
+		engine := setupGin()
+		ginLambdaV2 = ginadapter.NewV2(engine)
+	}
+	log.GetLogger().Info("Scheduled event received", zap.String("detailType", event.DetailType))
+	return service.RunScheduledNotifications(ctx)
+}
+
 func runningInLambda() bool {
 	// AWS_LAMBDA_FUNCTION_NAME 在 Lambda 執行環境中會存在
 	return os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
@@ -60,11 +86,14 @@ func main() {
 
 	if runningInLambda() {
 		// 在 Lambda 環境一律啟動 Lambda handler（避免因 GIN_MODE 設錯而啟用本地 HTTP 伺服器）
-		lambda.Start(HandlerV2)
+		lambda.Start(Handler)
 		return
 	}
 
 	// 本地開發模式
 	engine := setupGin()
+	if config.Notification.Enabled {
+		go service.StartNotificationScheduler(context.Background())
+	}
 	_ = engine.Run(":" + config.ServerConfig.Port)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"glt-calendar-service/api/metrics"
 	"glt-calendar-service/api/service"
 	"glt-calendar-service/settings/env"
 	"glt-calendar-service/settings/log"
@@ -20,6 +21,7 @@ var (
 func InitBaseHandlers() []gin.HandlerFunc {
 	return []gin.HandlerFunc{
 		CorsHandler(),
+		MetricsHandler(),
 	}
 }
 
@@ -30,13 +32,28 @@ func APIHandler() gin.HandlerFunc {
 	}
 }
 
+// MetricsHandler 以 EMF 輸出每個請求的 session 讀寫次數
+// Lambda 每個執行環境一次只處理一個請求，前後快照的差值即為該請求的次數
+func MetricsHandler() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		before := metrics.Snapshot()
+		context.Next()
+
+		route := context.FullPath()
+		if route == "" {
+			route = "NoRoute"
+		}
+		metrics.Emit(metrics.Delta(before, metrics.Snapshot()), map[string]string{"Route": route})
+	}
+}
+
 // CorsHandler 實際測試後發現，cors 機制在 lambda 環境會失效，需再 API Gateway 手動新增
 func CorsHandler() gin.HandlerFunc {
 	f := zap.String("domain", strings.Join(cfg.HttpAllows.Origins, ", "))
 	logger.Info("Allow Origins", f)
 	return cors.New(cors.Config{
 		AllowOrigins: cfg.HttpAllows.Origins, // 允許的前端域名
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders: []string{
 			"Origin",
 			"Content-Type",
@@ -44,8 +61,9 @@ func CorsHandler() gin.HandlerFunc {
 			"Accept",
 			"X-Requested-With",
 			"Cookie",
+			service.CSRFHeader,
 		},
-		ExposeHeaders:    []string{"Content-Length", "Set-Cookie"},
+		ExposeHeaders:    []string{"Content-Length", "Set-Cookie", service.CSRFHeader},
 		AllowCredentials: true,           // 是否允許 Cookie
 		MaxAge:           12 * time.Hour, // 預檢請求的緩存時間
 	})
@@ -54,6 +72,46 @@ func CorsHandler() gin.HandlerFunc {
 func ValidateSessionHandler() gin.HandlerFunc {
 	return func(context *gin.Context) {
 		service.ValidateSession(context)
-		// 修正 S1023: 移除冗餘的 return 語句
+		// 驗證失敗時已回應錯誤，停止後續 handler
+		if context.Writer.Written() {
+			context.Abort()
+		}
+	}
+}
+
+// CSRFHandler 檢查 cookie 驗證的 POST/PUT/PATCH/DELETE 請求是否帶有正確的 CSRF token
+func CSRFHandler() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !service.VerifyCSRF(context) {
+			context.Abort()
+		}
+	}
+}
+
+// RequireScopesHandler 檢查 session 是否已授權功能所需的 OAuth scope
+func RequireScopesHandler(features ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !service.RequireScopes(context, features...) {
+			context.Abort()
+		}
+	}
+}
+
+// TokenScopes 宣告路由允許 personal access token 使用時所需的 scope，未宣告的路由拒絕 token
+// 需放在讀取 session 的 handler 之前
+func TokenScopes(scopes ...string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !service.RequireTokenScopes(context, scopes...) {
+			context.Abort()
+		}
+	}
+}
+
+// RequireRole 檢查目前使用者是否具有角色，需放在 ValidateSessionHandler 之後
+func RequireRole(role string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !service.RequireRole(context, role) {
+			context.Abort()
+		}
 	}
 }
@@ -38,7 +38,18 @@ func InitConfig() *Config {
 	config := Config{
 		ServerConfig: ServerConfig{Port: viper.GetString("server.port")},
 		SigningConfig: SigningConfig{
-			TTL: viper.GetInt("signin.ttl"),
+			TTL:                   viper.GetInt("signin.ttl"),
+			AbsoluteTTL:           viper.GetInt("signin.absolute_ttl"),
+			RememberMeTTL:         viper.GetInt("signin.remember_me.ttl"),
+			RememberMeAbsoluteTTL: viper.GetInt("signin.remember_me.absolute_ttl"),
+			RefreshThreshold:      viper.GetInt("signin.refresh_threshold"),
+			CookieSameSite:        viper.GetString("signin.cookie.same_site"),
+			Restriction: SignInRestrictionConfig{
+				AllowedDomains:       splitList(viper.GetString("signin.restriction.allowed_domains")),
+				AllowedEmails:        splitList(viper.GetString("signin.restriction.allowed_emails")),
+				DeniedEmails:         splitList(viper.GetString("signin.restriction.denied_emails")),
+				RequireVerifiedEmail: viper.GetBool("signin.restriction.require_verified_email"),
+			},
 		},
 		GinConfig: GinConfig{Mode: viper.GetString("gin.mode")},
 		DynamodbConfig: DynamodbConfig{
@@ -54,8 +65,17 @@ func InitConfig() *Config {
 			Region: viper.GetString("dynamodb.region"),
 		},
 		GoogleOAuth2: GoogleOAuth2{
-			ClientID:     viper.GetString("google.oauth2.client_id"),
-			ClientSecret: viper.GetString("google.oauth2.client_secret"),
+			ClientID:            viper.GetString("google.oauth2.client_id"),
+			ClientSecret:        viper.GetString("google.oauth2.client_secret"),
+			RedirectURI:         viper.GetString("google.oauth2.redirect_uri"),
+			CallbackURI:         viper.GetString("google.oauth2.callback_uri"),
+			AllowedRedirectURIs: viper.GetStringSlice("google.oauth2.allowed_redirect_uris"),
+			Scopes:              viper.GetStringSlice("google.oauth2.scopes"),
+			JWKSURL:             viper.GetString("google.oauth2.jwks_url"),
+			Issuers:             viper.GetStringSlice("google.oauth2.issuers"),
+		},
+		GooglePeople: GooglePeople{
+			PersonFields: viper.GetStringSlice("google.people.person_fields"),
 		},
 		HttpAllows: HttpAllows{
 			Origins: viper.GetStringSlice("allow.origins"),
@@ -63,11 +83,94 @@ func InitConfig() *Config {
 		LogConfig: LogConfig{
 			Level: viper.GetString("log.level"),
 		},
+		Notification: NotificationConfig{
+			Enabled:          viper.GetBool("notification.enabled"),
+			DigestHour:       viper.GetInt("notification.digest_hour"),
+			ReminderOffsets:  viper.GetIntSlice("notification.reminder_offsets"),
+			ScheduleInterval: viper.GetInt("notification.schedule_interval"),
+			SMTP: SMTPConfig{
+				Host:     viper.GetString("notification.smtp.host"),
+				Port:     viper.GetInt("notification.smtp.port"),
+				Username: viper.GetString("notification.smtp.username"),
+				Password: viper.GetString("notification.smtp.password"),
+				From:     viper.GetString("notification.smtp.from"),
+			},
+		},
+		APIToken: APITokenConfig{
+			AccessTTL:  viper.GetInt("api_token.access_ttl"),
+			RefreshTTL: viper.GetInt("api_token.refresh_ttl"),
+		},
+		SessionToken: SessionTokenConfig{
+			Mode:            viper.GetString("session_token.mode"),
+			Algorithm:       viper.GetString("session_token.algorithm"),
+			TTL:             viper.GetInt("session_token.ttl"),
+			CurrentKeyID:    viper.GetString("session_token.current_key_id"),
+			Keys:            viper.GetStringMapString("session_token.keys"),
+			DenylistRefresh: viper.GetInt("session_token.denylist_refresh"),
+		},
+		Identity: IdentityConfig{
+			Providers: identityProviders(),
+		},
+		Calendar: CalendarConfig{
+			GoogleEndpoint:             viper.GetString("calendar.google.endpoint"),
+			MicrosoftEndpoint:          viper.GetString("calendar.microsoft.endpoint"),
+			CalDAVAllowHTTP:            viper.GetBool("calendar.caldav.allow_http"),
+			CalDAVAllowPrivateNetworks: viper.GetBool("calendar.caldav.allow_private_networks"),
+		},
+		Admin: AdminConfig{
+			BootstrapEmails: splitList(viper.GetString("admin.bootstrap_emails")),
+		},
+		CSRF: CSRFConfig{
+			ExemptPaths: viper.GetStringSlice("csrf.exempt_paths"),
+		},
+		Encryption: EncryptionConfig{
+			Provider: viper.GetString("encryption.provider"),
+			Local: LocalKeyConfig{
+				CurrentKeyID: viper.GetString("encryption.local.current_key_id"),
+				Keys:         viper.GetStringMapString("encryption.local.keys"),
+			},
+			KMS: KMSConfig{
+				KeyID:    viper.GetString("encryption.kms.key_id"),
+				Region:   viper.GetString("encryption.kms.region"),
+				Endpoint: viper.GetString("encryption.kms.endpoint"),
+			},
+		},
 	}
 
 	return &config
 }
 
+// identityProviders 讀取 identity.providers 下的每個提供者設定
+func identityProviders() map[string]IdentityProviderConfig {
+	providers := make(map[string]IdentityProviderConfig)
+	for name := range viper.GetStringMap("identity.providers") {
+		key := "identity.providers." + name
+		providers[name] = IdentityProviderConfig{
+			DisplayName:         viper.GetString(key + ".display_name"),
+			Issuer:              viper.GetString(key + ".issuer"),
+			DiscoveryURL:        viper.GetString(key + ".discovery_url"),
+			ClientID:            viper.GetString(key + ".client_id"),
+			ClientSecret:        viper.GetString(key + ".client_secret"),
+			Scopes:              viper.GetStringSlice(key + ".scopes"),
+			CallbackURI:         viper.GetString(key + ".callback_uri"),
+			AllowedRedirectURIs: splitList(viper.GetString(key + ".allowed_redirect_uris")),
+			TrustEmail:          viper.GetBool(key + ".trust_email"),
+		}
+	}
+	return providers
+}
+
+// splitList 將逗號分隔的字串（環境變數或 SSM 參數）轉為 slice，忽略空白項目
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 var (
 	config     *Config
 	configOnce sync.Once
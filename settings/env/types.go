@@ -5,7 +5,29 @@ type ServerConfig struct {
 }
 
 type SigningConfig struct {
-	TTL int
+	TTL                   int    // 閒置逾時（小時）
+	AbsoluteTTL           int    // 最長有效時間（小時）
+	RememberMeTTL         int    // 記住我：閒置逾時（小時）
+	RememberMeAbsoluteTTL int    // 記住我：最長有效時間（小時）
+	RefreshThreshold      int    // 距上次延長超過此時間（分鐘）才延長效期
+	CookieSameSite        string // lax、strict、none（前後端不同網域時需使用 none）
+	Restriction           SignInRestrictionConfig
+}
+
+type SignInRestrictionConfig struct {
+	AllowedDomains       []string // 允許的 Google Workspace 網域（Google 的 hd claim），與 AllowedEmails 皆為空時不限制
+	AllowedEmails        []string // 允許的 email（不屬於允許網域的例外）
+	DeniedEmails         []string // 拒絕的 email，優先於允許清單
+	RequireVerifiedEmail bool     // email 需經 Google 驗證
+}
+
+type APITokenConfig struct {
+	AccessTTL  int // bearer access token 有效時間（分鐘）
+	RefreshTTL int // bearer refresh token 有效時間（小時），不會超過 session 效期
+}
+
+type CSRFConfig struct {
+	ExemptPaths []string // 不檢查 CSRF 的路由前綴，例如 webhook
 }
 
 type GinConfig struct {
@@ -22,8 +44,44 @@ type DynamodbConfig struct {
 }
 
 type GoogleOAuth2 struct {
-	ClientID     string
-	ClientSecret string
+	ClientID            string
+	ClientSecret        string
+	RedirectURI         string   // 預設的授權回呼網址
+	CallbackURI         string   // 後端授權流程（/google/callback）的回呼網址
+	AllowedRedirectURIs []string // 允許的回呼網址
+	Scopes              []string // 後端授權流程預設請求的 scope
+	JWKSURL             string   // ID token 驗證使用的 JWKS 端點
+	Issuers             []string // ID token 允許的 issuer
+}
+
+// IdentityProviderConfig OpenID Connect 登入提供者，端點由 issuer 的 discovery 文件取得
+type IdentityProviderConfig struct {
+	DisplayName         string
+	Issuer              string // discovery：{issuer}/.well-known/openid-configuration
+	DiscoveryURL        string // 自訂 discovery 網址（本地模擬器），空字串使用 issuer
+	ClientID            string
+	ClientSecret        string
+	Scopes              []string
+	CallbackURI         string   // 後端授權流程（/:provider/callback）的回呼網址
+	AllowedRedirectURIs []string // 允許的回呼網址
+	TrustEmail          bool     // 提供者未回傳 email_verified 時視為已驗證（自架 Keycloak），不適用於 bootstrap admin
+}
+
+type IdentityConfig struct {
+	Providers map[string]IdentityProviderConfig // provider 名稱 -> 設定，client_id 或 issuer 為空時不啟用
+}
+
+// CalendarConfig 行事曆 API 端點，可指向本地替代服務
+type CalendarConfig struct {
+	GoogleEndpoint    string // Google Calendar API v3
+	MicrosoftEndpoint string // Microsoft Graph v1.0
+	CalDAVAllowHTTP   bool   // 允許以 http 連結 CalDAV 伺服器（本地 Radicale），預設只允許 https
+	// CalDAVAllowPrivateNetworks 允許連線到 loopback、私有網段的 CalDAV 伺服器，預設只允許公開位址（避免 SSRF）
+	CalDAVAllowPrivateNetworks bool
+}
+
+type GooglePeople struct {
+	PersonFields []string
 }
 
 type HttpAllows struct {
@@ -34,12 +92,67 @@ type LogConfig struct {
 	Level string
 }
 
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type NotificationConfig struct {
+	Enabled          bool
+	DigestHour       int   // 每日摘要寄送時間（使用者時區的小時）
+	ReminderOffsets  []int // 事件開始前幾分鐘提醒
+	ScheduleInterval int   // 排程執行間隔（分鐘）
+	SMTP             SMTPConfig
+}
+
+type LocalKeyConfig struct {
+	CurrentKeyID string
+	Keys         map[string]string // key id -> base64 編碼的 256-bit AES 金鑰
+}
+
+type KMSConfig struct {
+	KeyID    string // KMS key ID、ARN 或 alias
+	Region   string
+	Endpoint string // 替代服務（例如 local-kms）的 endpoint，空字串使用 AWS
+}
+
+type EncryptionConfig struct {
+	Provider string // local、kms，空字串代表不加密
+	Local    LocalKeyConfig
+	KMS      KMSConfig
+}
+
+type SessionTokenConfig struct {
+	Mode            string            // dynamodb（預設）、jwt
+	Algorithm       string            // HS256、EdDSA
+	TTL             int               // JWT 有效時間（分鐘），逾時後回 DynamoDB 驗證並換發
+	CurrentKeyID    string            // 簽章使用的金鑰，輪替時新增金鑰並修改此值
+	Keys            map[string]string // key id -> base64 編碼的金鑰（HS256：至少 32 bytes；EdDSA：32 bytes seed）
+	DenylistRefresh int               // 未撤銷查詢結果的快取時間（秒），其他執行個體的撤銷最多延遲此時間生效
+}
+
+type AdminConfig struct {
+	BootstrapEmails []string // 登入時自動設為 admin 的 email（需已驗證）
+}
+
 type Config struct {
 	ServerConfig   ServerConfig
 	SigningConfig  SigningConfig
 	GinConfig      GinConfig
 	DynamodbConfig DynamodbConfig
 	GoogleOAuth2   GoogleOAuth2
+	GooglePeople   GooglePeople
 	HttpAllows     HttpAllows
 	LogConfig      LogConfig
+	Notification   NotificationConfig
+	Encryption     EncryptionConfig
+	CSRF           CSRFConfig
+	APIToken       APITokenConfig
+	SessionToken   SessionTokenConfig
+	Admin          AdminConfig
+	Identity       IdentityConfig
+	Calendar       CalendarConfig
 }
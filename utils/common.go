@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"glt-calendar-service/api/model"
@@ -11,6 +13,15 @@ func GetCurrentTime() time.Time {
 	return time.Now()
 }
 
+// RandomString 產生 byteLength 個隨機位元組，以 base64url（無 padding）編碼
+func RandomString(byteLength int) (string, error) {
+	buf := make([]byte, byteLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
 func GetSessionFromContext(context *gin.Context) (*model.Session, error) {
 	session, exists := context.Get("session")
 	if !exists {